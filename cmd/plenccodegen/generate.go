@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/philpearl/plenc/plenccore"
+	"golang.org/x/tools/go/packages"
+)
+
+const (
+	plencImport     = "github.com/philpearl/plenc"
+	plenccoreImport = "github.com/philpearl/plenc/plenccore"
+)
+
+// generate writes codec methods for the named types in the package matching
+// pattern to the file output in the package directory.
+func generate(pattern string, typeNames []string, output string) error {
+	pkg, output, err := loadPackage(pattern, output)
+	if err != nil {
+		return err
+	}
+
+	src, err := newGenerator(pkg).generate(typeNames)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, src, 0o644)
+}
+
+// loadPackage loads the package matching pattern. It returns the package and
+// the path of the output file within the package directory.
+func loadPackage(pattern, output string) (*types.Package, string, error) {
+	// Find the package directory first so we can hide any existing output
+	// file when we load the package properly. The existing methods may no
+	// longer compile.
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName | packages.NeedFiles}, pattern)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not load package. %w", err)
+	}
+	if len(pkgs) != 1 {
+		return nil, "", fmt.Errorf("pattern %s matches %d packages. Specify a single package", pattern, len(pkgs))
+	}
+	if len(pkgs[0].GoFiles) == 0 {
+		return nil, "", fmt.Errorf("package %s has no Go files", pkgs[0].PkgPath)
+	}
+	output = filepath.Join(filepath.Dir(pkgs[0].GoFiles[0]), output)
+
+	pkgs, err = packages.Load(&packages.Config{
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedTypes,
+		Overlay: map[string][]byte{output: []byte("package " + pkgs[0].Name + "\n")},
+	}, pattern)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not load package. %w", err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return nil, "", fmt.Errorf("package contains errors")
+	}
+	return pkgs[0].Types, output, nil
+}
+
+// fieldKind says how a field is encoded
+type fieldKind int
+
+const (
+	// kindCodec fields are encoded by a codec from the default Plenc
+	kindCodec fieldKind = iota
+	kindInt
+	kindFlatInt
+	kindUint
+	kindBool
+	kindFloat32
+	kindFloat64
+	kindString
+	kindBytes
+	// kindStruct fields are structs with generated methods
+	kindStruct
+	// kindStructPtr fields are pointers to structs with generated methods
+	kindStructPtr
+)
+
+type field struct {
+	name   string
+	index  int
+	option string
+	typ    types.Type
+	kind   fieldKind
+	// tag is the encoded tag for fields we encode directly
+	tag []byte
+}
+
+type generator struct {
+	pkg *types.Package
+	// generating records the types we're writing methods for. They won't have
+	// the methods yet.
+	generating map[string]bool
+	imports    map[string]string
+	buf        bytes.Buffer
+}
+
+func newGenerator(pkg *types.Package) *generator {
+	return &generator{
+		pkg:        pkg,
+		generating: make(map[string]bool),
+		imports:    map[string]string{"fmt": "fmt", plenccoreImport: "plenccore"},
+	}
+}
+
+// generate returns formatted Go source for the codec methods of the named
+// types.
+func (g *generator) generate(typeNames []string) ([]byte, error) {
+	for _, name := range typeNames {
+		g.generating[name] = true
+	}
+
+	for _, name := range typeNames {
+		obj := g.pkg.Scope().Lookup(name)
+		if obj == nil {
+			return nil, fmt.Errorf("type %s not found in package %s", name, g.pkg.Path())
+		}
+		tn, ok := obj.(*types.TypeName)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a type", name)
+		}
+		named, ok := tn.Type().(*types.Named)
+		if !ok {
+			return nil, fmt.Errorf("%s is an alias. Generate methods for the type it refers to", name)
+		}
+		st, ok := named.Underlying().(*types.Struct)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a struct", name)
+		}
+		if named.TypeParams().Len() > 0 {
+			return nil, fmt.Errorf("%s is generic. Generic types are not supported", name)
+		}
+		fields, err := g.fields(name, st)
+		if err != nil {
+			return nil, err
+		}
+		g.writeType(name, fields)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by plenccodegen. DO NOT EDIT.\n\npackage %s\n\n", g.pkg.Name())
+	g.writeImports(&out)
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("could not format generated code. %w", err)
+	}
+	return src, nil
+}
+
+func (g *generator) writeImports(out *bytes.Buffer) {
+	var std, other []string
+	for path := range g.imports {
+		if strings.Contains(path, ".") {
+			other = append(other, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	slices.Sort(std)
+	slices.Sort(other)
+
+	out.WriteString("import (\n")
+	for _, path := range std {
+		fmt.Fprintf(out, "%q\n", path)
+	}
+	out.WriteString("\n")
+	for _, path := range other {
+		if name := g.imports[path]; name != filepath.Base(path) {
+			fmt.Fprintf(out, "%s %q\n", name, path)
+		} else {
+			fmt.Fprintf(out, "%q\n", path)
+		}
+	}
+	out.WriteString(")\n")
+}
+
+// fields reads the plenc tags of the struct fields, following the same rules
+// as plenccodec.BuildStructCodec.
+func (g *generator) fields(typeName string, st *types.Struct) ([]field, error) {
+	var fields []field
+	var reserved []int
+	for i := range st.NumFields() {
+		v := st.Field(i)
+
+		r, _ := utf8.DecodeRuneInString(v.Name())
+		if unicode.IsLower(r) {
+			continue
+		}
+
+		tag := reflect.StructTag(st.Tag(i)).Get("plenc")
+		if tag == "" {
+			return nil, fmt.Errorf("no plenc tag on field %d %s of %s", i, v.Name(), typeName)
+		}
+		if tag == "-" {
+			continue
+		}
+		tag, option, _ := strings.Cut(tag, ",")
+		index, err := strconv.Atoi(tag)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse plenc tag on field %d %s of %s. %w", i, v.Name(), typeName, err)
+		}
+		if option == "reserved" {
+			reserved = append(reserved, index)
+			continue
+		}
+
+		f := field{
+			name:   v.Name(),
+			index:  index,
+			option: option,
+			typ:    v.Type(),
+			kind:   g.classify(v.Type(), option),
+		}
+		if wt, ok := f.kind.wireType(); ok {
+			f.tag = plenccore.AppendTag(nil, wt, index)
+		}
+		fields = append(fields, f)
+	}
+
+	for i, f := range fields {
+		if slices.ContainsFunc(fields[:i], func(o field) bool { return o.index == f.index }) {
+			return nil, fmt.Errorf("multiple fields of %s have index %d", typeName, f.index)
+		}
+		if slices.Contains(reserved, f.index) {
+			return nil, fmt.Errorf("field %s of %s uses reserved index %d", f.name, typeName, f.index)
+		}
+	}
+	return fields, nil
+}
+
+// classify decides how we encode a field. We only encode a field directly if
+// plenc would certainly use the default codec for it. Named types from other
+// packages could have codecs registered, so they go via the registry.
+func (g *generator) classify(typ types.Type, option string) fieldKind {
+	if encodesItself(typ) {
+		return kindCodec
+	}
+	if ptr, ok := typ.(*types.Pointer); ok {
+		if option == "" && g.isGenerated(ptr.Elem()) {
+			return kindStructPtr
+		}
+		return kindCodec
+	}
+	if option == "" && g.isGenerated(typ) {
+		return kindStruct
+	}
+	if named, ok := typ.(*types.Named); ok && named.Obj().Pkg() != g.pkg {
+		return kindCodec
+	}
+
+	switch u := typ.Underlying().(type) {
+	case *types.Basic:
+		switch u.Kind() {
+		case types.Int, types.Int8, types.Int16, types.Int32, types.Int64:
+			switch option {
+			case "":
+				return kindInt
+			case "flat":
+				return kindFlatInt
+			}
+		case types.Uint, types.Uint8, types.Uint16, types.Uint32, types.Uint64:
+			if option == "" {
+				return kindUint
+			}
+		case types.Bool:
+			if option == "" {
+				return kindBool
+			}
+		case types.Float32:
+			if option == "" {
+				return kindFloat32
+			}
+		case types.Float64:
+			if option == "" {
+				return kindFloat64
+			}
+		case types.String:
+			if option == "" {
+				return kindString
+			}
+		}
+	case *types.Slice:
+		// Only []byte itself is encoded as bytes. Named byte slice types are
+		// encoded as slices of ints.
+		if _, named := typ.(*types.Named); !named && option == "" && types.Identical(u.Elem(), types.Typ[types.Uint8]) {
+			return kindBytes
+		}
+	}
+	return kindCodec
+}
+
+// isGenerated returns true if typ is a struct that has, or will have,
+// generated codec methods.
+func (g *generator) isGenerated(typ types.Type) bool {
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return false
+	}
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return false
+	}
+	if named.Obj().Pkg() == g.pkg && g.generating[named.Obj().Name()] {
+		return true
+	}
+	ms := types.NewMethodSet(types.NewPointer(named))
+	for _, m := range []string{"PlencGeneratedSize", "PlencGeneratedMarshal", "PlencGeneratedUnmarshal"} {
+		if ms.Lookup(named.Obj().Pkg(), m) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// encodesItself returns true if typ has methods that plenc uses in place of
+// its usual codec for the underlying type.
+func encodesItself(typ types.Type) bool {
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return false
+	}
+	ms := types.NewMethodSet(types.NewPointer(named))
+	for _, m := range []string{"AppendPlenc", "DecimalParts"} {
+		if ms.Lookup(named.Obj().Pkg(), m) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// wireType returns the wire type for fields of this kind. It returns false for
+// fields encoded by a codec.
+func (k fieldKind) wireType() (plenccore.WireType, bool) {
+	switch k {
+	case kindInt, kindFlatInt, kindUint, kindBool:
+		return plenccore.WTVarInt, true
+	case kindFloat32:
+		return plenccore.WT32, true
+	case kindFloat64:
+		return plenccore.WT64, true
+	case kindString, kindBytes, kindStruct, kindStructPtr:
+		return plenccore.WTLength, true
+	}
+	return 0, false
+}
+
+// typeString returns the Go source for typ, adding any imports it needs
+func (g *generator) typeString(typ types.Type) string {
+	return types.TypeString(typ, func(p *types.Package) string {
+		if p == g.pkg {
+			return ""
+		}
+		g.imports[p.Path()] = p.Name()
+		return p.Name()
+	})
+}
+
+// convert returns expr converted to typ. expr has the type basic, so no
+// conversion is needed if typ is that type.
+func (g *generator) convert(typ types.Type, basic, expr string) string {
+	if ts := g.typeString(typ); ts != basic {
+		return ts + "(" + expr + ")"
+	}
+	return expr
+}
+
+// flatType returns the unsigned type plenc uses to encode a flat int of typ
+func flatType(typ types.Type) string {
+	switch typ.Underlying().(*types.Basic).Kind() {
+	case types.Int8:
+		return "uint8"
+	case types.Int16:
+		return "uint16"
+	case types.Int32:
+		return "uint32"
+	case types.Int64:
+		return "uint64"
+	}
+	return "uint"
+}
+
+func tagBytes(tag []byte) string {
+	var b strings.Builder
+	for i, v := range tag {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "0x%02x", v)
+	}
+	return b.String()
+}
+
+// codecVar is the name of the variable holding the GeneratedField for a field
+// encoded with a codec
+func codecVar(typeName string, f *field) string {
+	return "plencField_" + typeName + "_" + f.name
+}
+
+// codecPtr returns an expression for the pointer a codec needs for the field.
+// Codecs are given the map pointer itself for map fields.
+func (g *generator) codecPtr(f *field) string {
+	if _, ok := f.typ.Underlying().(*types.Map); ok {
+		return "*(*unsafe.Pointer)(unsafe.Pointer(&v." + f.name + "))"
+	}
+	return "unsafe.Pointer(&v." + f.name + ")"
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) writeType(name string, fields []field) {
+	for i := range fields {
+		f := &fields[i]
+		switch f.kind {
+		case kindCodec:
+			g.imports["reflect"] = "reflect"
+			g.imports["unsafe"] = "unsafe"
+			g.imports[plencImport] = "plenc"
+			g.printf("\nvar %s = plenc.LazyGeneratedField(reflect.TypeFor[%s](), %d, %q)\n",
+				codecVar(name, f), g.typeString(f.typ), f.index, f.option)
+		case kindFloat32, kindFloat64:
+			g.imports["encoding/binary"] = "binary"
+			g.imports["math"] = "math"
+		}
+	}
+
+	g.writeSize(name, fields)
+	g.writeMarshal(name, fields)
+	g.writeUnmarshal(name, fields)
+}
+
+func (g *generator) writeSize(name string, fields []field) {
+	g.printf("\n// PlencGeneratedSize returns the number of bytes needed to marshal v\n")
+	g.printf("func (v *%s) PlencGeneratedSize() (size int) {\n", name)
+	for i := range fields {
+		f := &fields[i]
+		tl := len(f.tag)
+		switch f.kind {
+		case kindInt:
+			g.printf("if v.%s != 0 {\nsize += %d + plenccore.SizeVarInt(int64(v.%[1]s))\n}\n", f.name, tl)
+		case kindFlatInt:
+			g.printf("if v.%s != 0 {\nsize += %d + plenccore.SizeVarUint(uint64(%s(v.%[1]s)))\n}\n", f.name, tl, flatType(f.typ))
+		case kindUint:
+			g.printf("if v.%s != 0 {\nsize += %d + plenccore.SizeVarUint(uint64(v.%[1]s))\n}\n", f.name, tl)
+		case kindBool:
+			g.printf("if v.%s {\nsize += %d\n}\n", f.name, tl+1)
+		case kindFloat32:
+			g.printf("if v.%s != 0 {\nsize += %d\n}\n", f.name, tl+4)
+		case kindFloat64:
+			g.printf("if v.%s != 0 {\nsize += %d\n}\n", f.name, tl+8)
+		case kindString, kindBytes:
+			g.printf("if l := len(v.%s); l != 0 {\nsize += %d + plenccore.SizeVarUint(uint64(l)) + l\n}\n", f.name, tl)
+		case kindStruct:
+			g.printf("{\nl := v.%s.PlencGeneratedSize()\nsize += %d + plenccore.SizeVarUint(uint64(l)) + l\n}\n", f.name, tl)
+		case kindStructPtr:
+			g.printf("if v.%s != nil {\nl := v.%[1]s.PlencGeneratedSize()\nsize += %d + plenccore.SizeVarUint(uint64(l)) + l\n}\n", f.name, tl)
+		case kindCodec:
+			g.printf("if f, p := %s(), %s; !f.Omit(p) {\nsize += f.Size(p, f.Tag)\n}\n", codecVar(name, f), g.codecPtr(f))
+		}
+	}
+	g.printf("return size\n}\n")
+}
+
+func (g *generator) writeMarshal(name string, fields []field) {
+	g.printf("\n// PlencGeneratedMarshal appends the plenc encoding of v to data\n")
+	g.printf("func (v *%s) PlencGeneratedMarshal(data []byte) []byte {\n", name)
+	for i := range fields {
+		f := &fields[i]
+		tag := tagBytes(f.tag)
+		switch f.kind {
+		case kindInt:
+			g.printf("if v.%s != 0 {\ndata = append(data, %s)\ndata = plenccore.AppendVarInt(data, int64(v.%[1]s))\n}\n", f.name, tag)
+		case kindFlatInt:
+			g.printf("if v.%s != 0 {\ndata = append(data, %s)\ndata = plenccore.AppendVarUint(data, uint64(%s(v.%[1]s)))\n}\n", f.name, tag, flatType(f.typ))
+		case kindUint:
+			g.printf("if v.%s != 0 {\ndata = append(data, %s)\ndata = plenccore.AppendVarUint(data, uint64(v.%[1]s))\n}\n", f.name, tag)
+		case kindBool:
+			g.printf("if v.%s {\ndata = append(data, %s, 1)\n}\n", f.name, tag)
+		case kindFloat32:
+			g.printf("if v.%s != 0 {\ndata = append(data, %s)\ndata = binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(v.%[1]s)))\n}\n", f.name, tag)
+		case kindFloat64:
+			g.printf("if v.%s != 0 {\ndata = append(data, %s)\ndata = binary.LittleEndian.AppendUint64(data, math.Float64bits(float64(v.%[1]s)))\n}\n", f.name, tag)
+		case kindString, kindBytes:
+			g.printf("if len(v.%s) != 0 {\ndata = append(data, %s)\ndata = plenccore.AppendVarUint(data, uint64(len(v.%[1]s)))\ndata = append(data, v.%[1]s...)\n}\n", f.name, tag)
+		case kindStruct:
+			g.printf("data = append(data, %s)\ndata = plenccore.AppendVarUint(data, uint64(v.%s.PlencGeneratedSize()))\ndata = v.%[2]s.PlencGeneratedMarshal(data)\n", tag, f.name)
+		case kindStructPtr:
+			g.printf("if v.%s != nil {\ndata = append(data, %s)\ndata = plenccore.AppendVarUint(data, uint64(v.%[1]s.PlencGeneratedSize()))\ndata = v.%[1]s.PlencGeneratedMarshal(data)\n}\n", f.name, tag)
+		case kindCodec:
+			g.printf("if f, p := %s(), %s; !f.Omit(p) {\ndata = f.Append(data, p, f.Tag)\n}\n", codecVar(name, f), g.codecPtr(f))
+		}
+	}
+	g.printf("return data\n}\n")
+}
+
+func (g *generator) writeUnmarshal(name string, fields []field) {
+	g.printf("\n// PlencGeneratedUnmarshal decodes plenc data into v\n")
+	g.printf("func (v *%s) PlencGeneratedUnmarshal(data []byte) error {\n", name)
+	g.printf(`l := len(data)
+var offset int
+for offset < l {
+wt, index, n := plenccore.ReadTag(data[offset:])
+if n <= 0 || n > l-offset {
+return fmt.Errorf("failed to read tag in %[1]s")
+}
+offset += n
+
+fl := l
+if wt == plenccore.WTLength {
+// For WTLength types we read out the length and ensure the data we
+// read the field from is the right length
+x, n := plenccore.ReadVarUint(data[offset:])
+if n <= 0 || n > l-offset {
+return fmt.Errorf("varuint overflow reading field %%d of %[1]s", index)
+}
+offset += n
+fl = int(x) + offset
+if fl > l || fl < 0 {
+return fmt.Errorf("length %%d of field %%d of %[1]s exceeds data length", fl, index)
+}
+}
+
+switch index {
+`, name)
+
+	for i := range fields {
+		f := &fields[i]
+		g.printf("case %d:\n", f.index)
+		prefix := fmt.Sprintf("failed reading field %d of %s.", f.index, name)
+		switch f.kind {
+		case kindInt:
+			g.printf("x, n := plenccore.ReadVarInt(data[offset:fl])\nif n < 0 {\nreturn fmt.Errorf(%q)\n}\nv.%s = %s(x)\noffset += n\n",
+				prefix+" corrupt var int", f.name, g.typeString(f.typ))
+		case kindFlatInt:
+			g.printf("x, n := plenccore.ReadVarUint(data[offset:fl])\nif n < 0 {\nreturn fmt.Errorf(%q)\n}\nv.%s = %s(%s(x))\noffset += n\n",
+				prefix+" corrupt var int", f.name, g.typeString(f.typ), flatType(f.typ))
+		case kindUint:
+			g.printf("x, n := plenccore.ReadVarUint(data[offset:fl])\nif n < 0 {\nreturn fmt.Errorf(%q)\n}\nv.%s = %s(x)\noffset += n\n",
+				prefix+" corrupt var int", f.name, g.typeString(f.typ))
+		case kindBool:
+			g.printf("x, n := plenccore.ReadVarUint(data[offset:fl])\nif n < 0 {\nreturn fmt.Errorf(%q)\n}\nv.%s = x != 0\noffset += n\n",
+				prefix+" corrupt var int", f.name)
+		case kindFloat32:
+			g.printf("if fl-offset < 4 {\nif fl-offset != 0 {\nreturn fmt.Errorf(%q, fl-offset)\n}\nv.%s = 0\nbreak\n}\n", prefix+" not enough data to read a float32. Have %d bytes", f.name)
+			g.printf("v.%s = %s\noffset += 4\n", f.name, g.convert(f.typ, "float32", "math.Float32frombits(binary.LittleEndian.Uint32(data[offset:]))"))
+		case kindFloat64:
+			g.printf("if fl-offset < 8 {\nif fl-offset != 0 {\nreturn fmt.Errorf(%q, fl-offset)\n}\nv.%s = 0\nbreak\n}\n", prefix+" not enough data to read a float64. Have %d bytes", f.name)
+			g.printf("v.%s = %s\noffset += 8\n", f.name, g.convert(f.typ, "float64", "math.Float64frombits(binary.LittleEndian.Uint64(data[offset:]))"))
+		case kindString:
+			g.printf("v.%s = %s(data[offset:fl])\noffset = fl\n", f.name, g.typeString(f.typ))
+		case kindBytes:
+			// Copy the data so we're safe from the underlying buffer changing
+			g.printf("v.%s = append([]byte(nil), data[offset:fl]...)\noffset = fl\n", f.name)
+		case kindStruct:
+			g.printf("if err := v.%s.PlencGeneratedUnmarshal(data[offset:fl]); err != nil {\nreturn fmt.Errorf(%q, err)\n}\noffset = fl\n", f.name, prefix+" %w")
+		case kindStructPtr:
+			g.printf("if v.%s == nil {\nv.%[1]s = new(%s)\n}\n", f.name, g.typeString(f.typ.(*types.Pointer).Elem()))
+			g.printf("if err := v.%s.PlencGeneratedUnmarshal(data[offset:fl]); err != nil {\nreturn fmt.Errorf(%q, err)\n}\noffset = fl\n", f.name, prefix+" %w")
+		case kindCodec:
+			g.printf("n, err := %s().Read(data[offset:fl], unsafe.Pointer(&v.%s), wt)\nif err != nil {\nreturn fmt.Errorf(%q, err)\n}\noffset += n\n",
+				codecVar(name, f), f.name, prefix+" %w")
+		}
+	}
+
+	g.printf(`default:
+// Field corresponding to index does not exist
+if wt == plenccore.WTLength {
+offset = fl
+continue
+}
+n, err := plenccore.Skip(data[offset:], wt)
+if err != nil {
+return fmt.Errorf("failed to skip field %%d in %[1]s. %%w", index, err)
+}
+if n < 0 || n > l-offset {
+return fmt.Errorf("failed to skip field %%d in %[1]s", index)
+}
+offset += n
+}
+}
+return nil
+}
+`, name)
+}
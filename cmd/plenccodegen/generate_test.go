@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestGenerate checks the generated code in internal/gentest is up to date.
+// The tests in the plenc package check the code is correct.
+func TestGenerate(t *testing.T) {
+	pkg, output, err := loadPackage("../../internal/gentest", "plenc_generated.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := newGenerator(pkg).generate([]string{"Thing", "Sub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(exp), string(out)); diff != "" {
+		t.Fatalf("generated code is out of date. Run go generate in internal/gentest\n%s", diff)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	pkg, _, err := loadPackage("../../internal/gentest", "plenc_generated.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		exp  string
+	}{
+		{name: "Missing", exp: "type Missing not found in package github.com/philpearl/plenc/internal/gentest"},
+		{name: "Colour", exp: "Colour is not a struct"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newGenerator(pkg).generate([]string{test.name})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != test.exp {
+				t.Fatalf("error %q not as expected", err)
+			}
+		})
+	}
+}
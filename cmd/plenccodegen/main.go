@@ -0,0 +1,58 @@
+// plenccodegen writes plenc codec methods for structs with plenc tags, so they
+// can be marshalled and unmarshalled without reflection.
+//
+//	//go:generate plenccodegen -type Thing,Other
+//
+// For each type it writes PlencGeneratedSize, PlencGeneratedMarshal and
+// PlencGeneratedUnmarshal methods, which plenc uses in preference to its
+// reflection-based codecs. The methods encode exactly as plenc would. Ints,
+// floats, bools, strings, []byte and other generated structs are encoded
+// directly. Other fields use the codecs from the default Plenc.
+//
+// The package in the current directory is used unless a package pattern is
+// given as an argument.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var (
+		typeNames string
+		output    string
+	)
+	flag.StringVar(&typeNames, "type", "", "Comma-separated list of the struct types to generate methods for")
+	flag.StringVar(&output, "o", "plenc_generated.go", "File to write, relative to the package directory")
+	flag.Parse()
+
+	if typeNames == "" {
+		fmt.Fprintln(os.Stderr, "specify the types with -type")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if !strings.HasSuffix(output, ".go") {
+		return fmt.Errorf("output file %s should have a .go suffix", output)
+	}
+
+	pattern := "."
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		pattern = flag.Arg(0)
+	default:
+		return fmt.Errorf("specify at most one package")
+	}
+
+	return generate(pattern, strings.Split(typeNames, ","), output)
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/emicklei/proto"
+)
+
+const plenccodecImport = "github.com/philpearl/plenc/plenccodec"
+
+// maxReservedRange is the largest range of reserved field numbers we'll write
+// reserved fields for.
+const maxReservedRange = 64
+
+type generator struct {
+	filename string
+	pkg      string
+	warnings io.Writer
+
+	protoPkg string
+	// types maps the name of each message and enum in the file, qualified by
+	// the names of any enclosing messages, to its Go type.
+	types   map[string]typeInfo
+	imports map[string]bool
+	buf     bytes.Buffer
+}
+
+type typeInfo struct {
+	name string
+	enum bool
+}
+
+// fieldKind describes how plenc encodes a field type. It tells us whether
+// repeated fields need the protobuf layout.
+type fieldKind int
+
+const (
+	kindScalar fieldKind = iota
+	kindLength
+	kindMessage
+)
+
+// generate reads a proto3 file and returns formatted Go source for it
+func (g *generator) generate(r io.Reader) ([]byte, error) {
+	parser := proto.NewParser(r)
+	parser.Filename(g.filename)
+	def, err := parser.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s. %w", g.filename, err)
+	}
+
+	syntax := "proto2"
+	var goPackage string
+	for _, elt := range def.Elements {
+		switch elt := elt.(type) {
+		case *proto.Syntax:
+			syntax = elt.Value
+		case *proto.Package:
+			g.protoPkg = elt.Name
+		case *proto.Option:
+			if elt.Name == "go_package" {
+				goPackage = elt.Constant.Source
+			}
+		}
+	}
+	if syntax != "proto3" {
+		return nil, fmt.Errorf("%s uses %s. Only proto3 is supported", g.filename, syntax)
+	}
+
+	if g.pkg == "" {
+		g.pkg = defaultPackage(goPackage, g.protoPkg)
+		if g.pkg == "" {
+			return nil, fmt.Errorf("no package name. Use -package to set one")
+		}
+	}
+
+	g.types = make(map[string]typeInfo)
+	g.imports = make(map[string]bool)
+	g.collectTypes("", def.Elements)
+
+	for _, elt := range def.Elements {
+		if err := g.writeType("", elt); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by plencgen from %s. DO NOT EDIT.\n\npackage %s\n\n", g.filename, g.pkg)
+	if len(g.imports) > 0 {
+		out.WriteString("import (\n")
+		if g.imports["time"] {
+			out.WriteString("\"time\"\n\n")
+		}
+		if g.imports[plenccodecImport] {
+			fmt.Fprintf(&out, "%q\n", plenccodecImport)
+		}
+		out.WriteString(")\n")
+	}
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("could not format generated code. %w", err)
+	}
+	return src, nil
+}
+
+// defaultPackage picks a Go package name from the go_package option or the
+// protobuf package.
+func defaultPackage(goPackage, protoPkg string) string {
+	if goPackage != "" {
+		if _, name, ok := strings.Cut(goPackage, ";"); ok {
+			return name
+		}
+		return path.Base(goPackage)
+	}
+	return strings.ReplaceAll(protoPkg, ".", "_")
+}
+
+func (g *generator) warn(pos fmt.Stringer, format string, args ...any) {
+	fmt.Fprintf(g.warnings, "%s: warning: %s\n", pos, fmt.Sprintf(format, args...))
+}
+
+// collectTypes records the names of all the messages and enums so that field
+// types can be resolved.
+func (g *generator) collectTypes(scope string, elts []proto.Visitee) {
+	for _, elt := range elts {
+		switch elt := elt.(type) {
+		case *proto.Message:
+			if elt.IsExtend {
+				continue
+			}
+			name := qualify(scope, elt.Name)
+			g.types[name] = typeInfo{name: goTypeName(name)}
+			g.collectTypes(name, elt.Elements)
+		case *proto.Enum:
+			name := qualify(scope, elt.Name)
+			g.types[name] = typeInfo{name: goTypeName(name), enum: true}
+		}
+	}
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// goTypeName converts a qualified protobuf name like Outer.Inner into a Go
+// type name like Outer_Inner
+func goTypeName(name string) string {
+	return strings.ReplaceAll(name, ".", "_")
+}
+
+// goFieldName converts a protobuf field name like user_id into a Go field name
+// like UserId
+func goFieldName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (g *generator) writeComment(c *proto.Comment) {
+	if c == nil {
+		return
+	}
+	for _, line := range c.Lines {
+		fmt.Fprintf(&g.buf, "//%s\n", line)
+	}
+}
+
+func (g *generator) writeType(scope string, elt proto.Visitee) error {
+	switch elt := elt.(type) {
+	case *proto.Message:
+		if elt.IsExtend {
+			g.warn(elt.Position, "ignoring extend %s", elt.Name)
+			return nil
+		}
+		return g.writeMessage(scope, elt)
+	case *proto.Enum:
+		g.writeEnum(scope, elt)
+	}
+	return nil
+}
+
+func (g *generator) writeEnum(scope string, e *proto.Enum) {
+	name := g.types[qualify(scope, e.Name)].name
+
+	g.buf.WriteString("\n")
+	g.writeComment(e.Comment)
+	fmt.Fprintf(&g.buf, "type %s int32\n\nconst (\n", name)
+	for _, elt := range e.Elements {
+		if v, ok := elt.(*proto.EnumField); ok {
+			g.writeComment(v.Comment)
+			fmt.Fprintf(&g.buf, "%s_%s %s = %d\n", name, v.Name, name, v.Integer)
+		}
+	}
+	g.buf.WriteString(")\n")
+}
+
+func (g *generator) writeMessage(scope string, m *proto.Message) error {
+	fullName := qualify(scope, m.Name)
+	name := g.types[fullName].name
+
+	g.buf.WriteString("\n")
+	g.writeComment(m.Comment)
+	fmt.Fprintf(&g.buf, "type %s struct {\n", name)
+
+	for _, elt := range m.Elements {
+		switch elt := elt.(type) {
+		case *proto.NormalField:
+			typ, kind, option, err := g.fieldType(fullName, elt.Type)
+			if err != nil {
+				return err
+			}
+			switch {
+			case elt.Repeated:
+				typ = "[]" + typ
+				switch {
+				case kind != kindScalar:
+					option = "proto"
+				case option == "flat":
+					option = "flatelems"
+				}
+			case kind == kindMessage:
+				typ = "*" + typ
+			case elt.Optional:
+				typ = g.optional(typ)
+			}
+			g.writeField(elt.Field, typ, option)
+
+		case *proto.MapField:
+			keyType, _, keyOption, err := g.fieldType(fullName, elt.KeyType)
+			if err != nil {
+				return err
+			}
+			valueType, _, valueOption, err := g.fieldType(fullName, elt.Type)
+			if err != nil {
+				return err
+			}
+			if keyOption != "" || valueOption != "" {
+				g.warn(elt.Position, "plenc can't use the protobuf encoding of %s for the map key or value of %s.%s",
+					elt.KeyType+","+elt.Type, fullName, elt.Name)
+			}
+			g.writeField(elt.Field, fmt.Sprintf("map[%s]%s", keyType, valueType), "proto")
+
+		case *proto.Oneof:
+			g.writeComment(elt.Comment)
+			fmt.Fprintf(&g.buf, "// The following fields are the oneof %s. At most one is set.\n", elt.Name)
+			for _, elt := range elt.Elements {
+				f, ok := elt.(*proto.OneOfField)
+				if !ok {
+					continue
+				}
+				typ, kind, option, err := g.fieldType(fullName, f.Type)
+				if err != nil {
+					return err
+				}
+				switch {
+				case kind == kindMessage:
+					typ = "*" + typ
+				case typ != "[]byte":
+					typ = g.optional(typ)
+				}
+				g.writeField(f.Field, typ, option)
+			}
+
+		case *proto.Reserved:
+			for _, r := range elt.Ranges {
+				if r.Max || r.To-r.From >= maxReservedRange {
+					g.warn(elt.Position, "not reserving range %s in %s", r.SourceRepresentation(), fullName)
+					continue
+				}
+				for i := r.From; i <= r.To; i++ {
+					fmt.Fprintf(&g.buf, "_ struct{} `plenc:\"%d,reserved\"`\n", i)
+				}
+			}
+		}
+	}
+	g.buf.WriteString("}\n")
+
+	for _, elt := range m.Elements {
+		if err := g.writeType(fullName, elt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) optional(typ string) string {
+	g.imports[plenccodecImport] = true
+	return "plenccodec.Optional[" + typ + "]"
+}
+
+func (g *generator) writeField(f *proto.Field, typ, option string) {
+	g.writeComment(f.Comment)
+	tag := fmt.Sprintf("%d", f.Sequence)
+	if option != "" {
+		tag += "," + option
+	}
+	fmt.Fprintf(&g.buf, "%s %s `plenc:%q`\n", goFieldName(f.Name), typ, tag)
+}
+
+// fieldType returns the Go type for a protobuf type, and the plenc tag option
+// needed to match the protobuf encoding. scope is the qualified name of the
+// message containing the field.
+func (g *generator) fieldType(scope, protoType string) (typ string, kind fieldKind, option string, err error) {
+	switch protoType {
+	case "double":
+		return "float64", kindScalar, "", nil
+	case "float":
+		return "float32", kindScalar, "", nil
+	case "int32":
+		return "int32", kindScalar, "flat", nil
+	case "int64":
+		return "int64", kindScalar, "flat", nil
+	case "uint32":
+		return "uint32", kindScalar, "", nil
+	case "uint64":
+		return "uint64", kindScalar, "", nil
+	case "sint32":
+		return "int32", kindScalar, "", nil
+	case "sint64":
+		return "int64", kindScalar, "", nil
+	case "fixed32":
+		return "uint32", kindScalar, "fixed", nil
+	case "fixed64":
+		return "uint64", kindScalar, "fixed", nil
+	case "sfixed32":
+		return "int32", kindScalar, "fixed", nil
+	case "sfixed64":
+		return "int64", kindScalar, "fixed", nil
+	case "bool":
+		return "bool", kindScalar, "", nil
+	case "string":
+		return "string", kindLength, "", nil
+	case "bytes":
+		return "[]byte", kindLength, "", nil
+	case "google.protobuf.Timestamp", ".google.protobuf.Timestamp":
+		g.imports["time"] = true
+		return "time.Time", kindLength, "", nil
+	}
+
+	name, isEnum, ok := g.resolve(scope, protoType)
+	if !ok {
+		return "", 0, "", fmt.Errorf("unsupported type %s in %s", protoType, scope)
+	}
+	if isEnum {
+		return name, kindScalar, "flat", nil
+	}
+	return name, kindMessage, "", nil
+}
+
+// resolve finds the Go name of a message or enum type, following the
+// protobuf scoping rules: the innermost scope is searched first.
+func (g *generator) resolve(scope, protoType string) (name string, isEnum bool, ok bool) {
+	var candidates []string
+	if abs, ok := strings.CutPrefix(protoType, "."); ok {
+		candidates = []string{abs}
+	} else {
+		for s := scope; s != ""; s = parentScope(s) {
+			candidates = append(candidates, qualify(s, protoType))
+		}
+		candidates = append(candidates, protoType)
+	}
+
+	for _, c := range candidates {
+		if g.protoPkg != "" {
+			c = strings.TrimPrefix(c, g.protoPkg+".")
+		}
+		if t, ok := g.types[c]; ok {
+			return t.name, t.enum, true
+		}
+	}
+	return "", false, false
+}
+
+func parentScope(scope string) string {
+	dot := strings.LastIndexByte(scope, '.')
+	if dot == -1 {
+		return ""
+	}
+	return scope[:dot]
+}
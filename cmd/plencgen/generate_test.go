@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenerate(t *testing.T) {
+	f, err := os.Open("testdata/things.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var warnings bytes.Buffer
+	g := generator{filename: "things.proto", pkg: "things", warnings: &warnings}
+	out, err := g.generate(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp, err := os.ReadFile("testdata/things.go.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(exp), string(out)); diff != "" {
+		t.Fatal(diff)
+	}
+	if warnings.Len() != 0 {
+		t.Fatalf("unexpected warnings %s", warnings.String())
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		exp  string
+	}{
+		{
+			name: "proto2",
+			in:   "syntax = \"proto2\";\nmessage A { optional int32 a = 1; }\n",
+			exp:  "a.proto uses proto2. Only proto3 is supported",
+		},
+		{
+			name: "unknown type",
+			in:   "syntax = \"proto3\";\npackage a;\nmessage A { B b = 1; }\n",
+			exp:  "unsupported type B in A",
+		},
+		{
+			name: "no package",
+			in:   "syntax = \"proto3\";\nmessage A { int32 a = 1; }\n",
+			exp:  "no package name. Use -package to set one",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := generator{filename: "a.proto", warnings: &bytes.Buffer{}}
+			_, err := g.generate(strings.NewReader(test.in))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != test.exp {
+				t.Fatalf("error %q not as expected", err)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	in := `syntax = "proto3";
+package a.b;
+option go_package = "example.com/things;things";
+message Outer {
+  message Inner {
+    message Deep { Inner i = 1; }
+  }
+  Inner inner = 1;
+  .a.b.Outer.Inner.Deep deep = 2;
+  a.b.Top top = 3;
+}
+message Top { Outer.Inner inner = 1; }
+message Inner {}
+`
+	g := generator{filename: "a.proto", warnings: &bytes.Buffer{}}
+	out, err := g.generate(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{
+		"package things\n",
+		"I *Outer_Inner `plenc:\"1\"`",
+		"Inner *Outer_Inner      `plenc:\"1\"`",
+		"Deep  *Outer_Inner_Deep `plenc:\"2\"`",
+		"Top   *Top              `plenc:\"3\"`",
+		"type Top struct {\n\tInner *Outer_Inner `plenc:\"1\"`",
+	} {
+		if !strings.Contains(string(out), exp) {
+			t.Errorf("output does not contain %q\n%s", exp, out)
+		}
+	}
+}
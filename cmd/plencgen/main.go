@@ -0,0 +1,67 @@
+// plencgen generates Go structs with plenc tags from proto3 .proto files.
+//
+//	plencgen -package things -o things.go things.proto
+//
+// Messages become structs and enums become int32 types with constants. Fields
+// use plenc tags that match the protobuf encoding where plenc can express it:
+// optional fields use plenccodec.Optional, and repeated fields and maps use
+// the protobuf layout. Timestamp fields become time.Time, which needs a Plenc
+// with ProtoCompatibleTime set.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var (
+		pkg    string
+		output string
+	)
+	flag.StringVar(&pkg, "package", "", "Go package name for the generated code. Defaults to the protobuf package name")
+	flag.StringVar(&output, "o", "", "File to write. Defaults to stdout")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "specify a single .proto file")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	filename := flag.Arg(0)
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	g := generator{
+		filename: filepath.Base(filename),
+		pkg:      pkg,
+		warnings: os.Stderr,
+	}
+	src, err := g.generate(f)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	if !strings.HasSuffix(output, ".go") {
+		return fmt.Errorf("output file %s should have a .go suffix", output)
+	}
+	return os.WriteFile(output, src, 0o644)
+}
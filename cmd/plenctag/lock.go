@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// lockFileName is the name of the file that records the plenc indexes of the
+// structs in a package. It lives in the package directory.
+const lockFileName = "plenc.lock"
+
+// lockFile records the fields of each struct in a package, and the fields that
+// have been removed. Nested anonymous structs are named after the field that
+// contains them, e.g. "Outer.Field".
+type lockFile struct {
+	Structs map[string]*lockStruct `json:"structs"`
+}
+
+type lockStruct struct {
+	Fields  []lockField `json:"fields,omitempty"`
+	Removed []lockField `json:"removed,omitempty"`
+}
+
+type lockField struct {
+	Name   string `json:"name"`
+	Index  int    `json:"index"`
+	Type   string `json:"type"`
+	Option string `json:"option,omitempty"`
+}
+
+func (f lockField) typeString() string {
+	if f.Option == "" {
+		return f.Type
+	}
+	return f.Type + "," + f.Option
+}
+
+func findField(fields []lockField, match func(f lockField) bool) (lockField, bool) {
+	i := slices.IndexFunc(fields, match)
+	if i < 0 {
+		return lockField{}, false
+	}
+	return fields[i], true
+}
+
+// sourceStruct is a struct found in the package source
+type sourceStruct struct {
+	name   string
+	fields []lockField
+	pos    []token.Pos
+}
+
+// lock runs the lock and check modes for each directory in dirs. lock records
+// the current plenc indexes in the lock file for the directory, and check
+// verifies the lock file is up to date. Both fail if an index has been reused,
+// a field's type has changed, or the index of a removed field is used again.
+func (c *config) lock(dirs []string, check bool) error {
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	var errs rewriteErrors
+	for _, dir := range dirs {
+		errs.Append(c.lockDir(dir, check))
+	}
+
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+func (c *config) lockDir(dir string, check bool) error {
+	structs, err := c.parseDir(dir)
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(dir, lockFileName)
+	existing, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var old lockFile
+	if existing != nil {
+		if err := json.Unmarshal(existing, &old); err != nil {
+			return fmt.Errorf("could not parse %s. %w", filename, err)
+		}
+	}
+
+	updated, err := c.updateLock(&old, structs)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(updated, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if check {
+		if !bytes.Equal(existing, data) {
+			return fmt.Errorf("%s is out of date. Run plenctag lock to update it", filename)
+		}
+		return nil
+	}
+
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// updateLock compares the structs in the source with the lock file and builds
+// an updated lock file. It returns an error if any of the structs break the
+// rules for changing plenc structs.
+func (c *config) updateLock(old *lockFile, structs []sourceStruct) (*lockFile, error) {
+	var errs rewriteErrors
+	updated := &lockFile{Structs: make(map[string]*lockStruct, len(old.Structs))}
+
+	for _, s := range structs {
+		prev := old.Structs[s.name]
+		if prev == nil {
+			if len(s.fields) == 0 {
+				// Not a struct that's used with plenc
+				continue
+			}
+			prev = &lockStruct{}
+		}
+
+		for i, f := range s.fields {
+			report := func(format string, args ...any) {
+				pos := c.fset.Position(s.pos[i])
+				errs.Append(fmt.Errorf("%s:%d:%d:%s.%s %s",
+					pos.Filename, pos.Line, pos.Column, s.name, f.Name, fmt.Sprintf(format, args...)))
+			}
+
+			if other, ok := findField(s.fields[:i], func(o lockField) bool { return o.Index == f.Index }); ok {
+				report("re-uses index %d of field %s", f.Index, other.Name)
+			}
+
+			if was, ok := findField(prev.Fields, func(o lockField) bool { return o.Index == f.Index }); ok {
+				if was.typeString() != f.typeString() {
+					report("(index %d) has changed type from %s to %s", f.Index, was.typeString(), f.typeString())
+				}
+			} else if removed, ok := findField(prev.Removed, func(o lockField) bool { return o.Index == f.Index }); ok {
+				report("re-uses index %d of removed field %s", f.Index, removed.Name)
+			} else if was, ok := findField(prev.Fields, func(o lockField) bool { return o.Name == f.Name }); ok {
+				report("has changed index from %d to %d", was.Index, f.Index)
+			}
+		}
+
+		updated.Structs[s.name] = mergeLock(prev, s.fields)
+	}
+
+	// Structs that have been removed from the source keep their history so
+	// that their indexes are still protected if they come back.
+	for name, prev := range old.Structs {
+		if _, ok := updated.Structs[name]; !ok {
+			updated.Structs[name] = mergeLock(prev, nil)
+		}
+	}
+
+	if errs != nil {
+		return nil, errs
+	}
+	return updated, nil
+}
+
+// mergeLock builds a new lock entry for a struct with the given fields. Fields
+// that were in prev but are no longer present are recorded as removed.
+func mergeLock(prev *lockStruct, fields []lockField) *lockStruct {
+	var ls lockStruct
+	ls.Fields = slices.Clone(fields)
+	ls.Removed = slices.Clone(prev.Removed)
+	for _, f := range prev.Fields {
+		if !slices.ContainsFunc(fields, func(o lockField) bool { return o.Index == f.Index }) {
+			ls.Removed = append(ls.Removed, f)
+		}
+	}
+
+	byIndex := func(a, b lockField) int { return a.Index - b.Index }
+	slices.SortStableFunc(ls.Fields, byIndex)
+	slices.SortStableFunc(ls.Removed, byIndex)
+	return &ls
+}
+
+// parseDir finds the top-level structs in the non-test Go files in dir
+func (c *config) parseDir(dir string) ([]sourceStruct, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c.fset = token.NewFileSet()
+	var structs []sourceStruct
+	var errs rewriteErrors
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(c.fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					structs = c.collectStruct(structs, &errs, ts.Name.Name, st)
+				}
+			}
+		}
+	}
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	slices.SortFunc(structs, func(a, b sourceStruct) int { return strings.Compare(a.name, b.name) })
+	return structs, nil
+}
+
+// collectStruct records the plenc fields of st, and of any anonymous structs
+// nested within its fields.
+func (c *config) collectStruct(structs []sourceStruct, errs *rewriteErrors, name string, st *ast.StructType) []sourceStruct {
+	s := sourceStruct{name: name}
+	for _, f := range st.Fields.List {
+		names := fieldNames(f)
+
+		for _, fieldName := range names {
+			ast.Inspect(f.Type, func(n ast.Node) bool {
+				if nested, ok := n.(*ast.StructType); ok {
+					structs = c.collectStruct(structs, errs, name+"."+fieldName, nested)
+					return false
+				}
+				return true
+			})
+		}
+
+		if f.Tag == nil {
+			continue
+		}
+		tags, err := extractTags(f.Tag.Value)
+		if err != nil {
+			errs.Append(c.positionError(f.Pos(), err))
+			continue
+		}
+		tag, err := tags.Get("plenc")
+		if err != nil || tag.Name == "-" || tag.HasOption("reserved") {
+			continue
+		}
+		index, err := strconv.Atoi(tag.Name)
+		if err != nil {
+			errs.Append(c.positionError(f.Pos(), fmt.Errorf("could not parse plenc tag. %w", err)))
+			continue
+		}
+
+		for _, fieldName := range names {
+			r, _ := utf8.DecodeRuneInString(fieldName)
+			if unicode.IsLower(r) {
+				// plenc ignores unexported fields
+				continue
+			}
+			s.fields = append(s.fields, lockField{
+				Name:   fieldName,
+				Index:  index,
+				Type:   fieldType(f.Type),
+				Option: strings.Join(tag.Options, ","),
+			})
+			s.pos = append(s.pos, f.Pos())
+		}
+	}
+
+	return append(structs, s)
+}
+
+// fieldType returns the type of a field as a string. Nested anonymous structs
+// are checked separately, so their contents are not included.
+func fieldType(typ ast.Expr) string {
+	s := types.ExprString(typ)
+	ast.Inspect(typ, func(n ast.Node) bool {
+		if st, ok := n.(*ast.StructType); ok {
+			s = strings.Replace(s, types.ExprString(st), "struct{...}", 1)
+			return false
+		}
+		return true
+	})
+	return s
+}
+
+// fieldNames returns the names of a field. Embedded fields are named after
+// their type.
+func fieldNames(f *ast.Field) []string {
+	if f.Names != nil {
+		names := make([]string, len(f.Names))
+		for i, n := range f.Names {
+			names[i] = n.Name
+		}
+		return names
+	}
+
+	typ := f.Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.SelectorExpr:
+			return []string{t.Sel.Name}
+		case *ast.IndexExpr:
+			typ = t.X
+		case *ast.IndexListExpr:
+			typ = t.X
+		case *ast.Ident:
+			return []string{t.Name}
+		default:
+			return []string{types.ExprString(f.Type)}
+		}
+	}
+}
+
+func (c *config) positionError(p token.Pos, err error) error {
+	pos := c.fset.Position(p)
+	return fmt.Errorf("%s:%d:%d:%s", pos.Filename, pos.Line, pos.Column, err)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	dir := t.TempDir()
+	write := func(src string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n\n"+src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("type T struct {\n" +
+		"\tA int `plenc:\"1\"`\n" +
+		"\tB string `plenc:\"2\"`\n" +
+		"\tC struct{ D int `plenc:\"1\"` } `plenc:\"3\"`\n" +
+		"\tE uint64 `plenc:\"4,fixed\"`\n" +
+		"\tf int\n" +
+		"}\n\n" +
+		"type notPlenc struct{ a int }\n")
+
+	var c config
+	if err := c.lock([]string{dir}, true); err == nil {
+		t.Fatal("expected check to fail without a lock file")
+	}
+	if err := c.lock([]string{dir}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.lock([]string{dir}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := os.ReadFile(filepath.Join(dir, lockFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{`"T.C"`, `"option": "fixed"`} {
+		if !strings.Contains(string(lock), exp) {
+			t.Fatalf("lock file does not contain %s.\n%s", exp, lock)
+		}
+	}
+	if strings.Contains(string(lock), "notPlenc") {
+		t.Fatalf("lock file should not contain notPlenc.\n%s", lock)
+	}
+
+	// Renaming and adding fields is fine, but check fails until the lock is
+	// updated. Removing B records it as removed.
+	write("type T struct {\n" +
+		"\tRenamed int `plenc:\"1\"`\n" +
+		"\tC struct{ D int `plenc:\"1\"` } `plenc:\"3\"`\n" +
+		"\tE uint64 `plenc:\"4,fixed\"`\n" +
+		"\tF []int `plenc:\"5\"`\n" +
+		"}\n")
+	err = c.lock([]string{dir}, true)
+	if err == nil || !strings.Contains(err.Error(), "out of date") {
+		t.Fatalf("expected lock to be out of date, got %v", err)
+	}
+	if err := c.lock([]string{dir}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		exp  []string
+	}{
+		{
+			name: "changed type",
+			src:  "type T struct {\n\tRenamed int8 `plenc:\"1\"`\n\tC struct{ D int `plenc:\"1\"` } `plenc:\"3\"`\n\tE uint64 `plenc:\"4\"`\n\tF []int `plenc:\"5\"`\n}\n",
+			exp: []string{
+				"a.go:4:2:T.Renamed (index 1) has changed type from int to int8",
+				"a.go:6:2:T.E (index 4) has changed type from uint64,fixed to uint64",
+			},
+		},
+		{
+			name: "removed index",
+			src:  "type T struct {\n\tRenamed int `plenc:\"1\"`\n\tB string `plenc:\"2\"`\n\tC struct{ D int `plenc:\"1\"` } `plenc:\"3\"`\n\tE uint64 `plenc:\"4,fixed\"`\n\tF []int `plenc:\"5\"`\n}\n",
+			exp:  []string{"a.go:5:2:T.B re-uses index 2 of removed field B"},
+		},
+		{
+			name: "reused index",
+			src:  "type T struct {\n\tRenamed int `plenc:\"1\"`\n\tC struct{ D int `plenc:\"1\"`; G int `plenc:\"1\"` } `plenc:\"3\"`\n\tE uint64 `plenc:\"4,fixed\"`\n\tF []int `plenc:\"6\"`\n}\n",
+			exp: []string{
+				"a.go:5:31:T.C.G re-uses index 1 of field D",
+				"a.go:7:2:T.F has changed index from 5 to 6",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			write(test.src)
+			for _, check := range []bool{true, false} {
+				err := c.lock([]string{dir}, check)
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				for _, exp := range test.exp {
+					if !strings.Contains(err.Error(), exp) {
+						t.Errorf("error %q does not contain %q", err, exp)
+					}
+				}
+			}
+		})
+	}
+
+	// A failed lock leaves the lock file unchanged
+	after, err := os.ReadFile(filepath.Join(dir, lockFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(after), `"removed"`) {
+		t.Fatalf("expected B to be recorded as removed.\n%s", after)
+	}
+}
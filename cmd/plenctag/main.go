@@ -1,4 +1,14 @@
-// plenctag adds plenc tags to your structs
+// plenctag adds plenc tags to your structs.
+//
+// plenctag accepts either Go files or package patterns such as ./... When given
+// packages it loads them with full type information. It then warns about fields
+// plenc can't encode, and -root limits tagging to the structs reachable from the
+// named types.
+//
+// plenctag lock [dirs] records the plenc indexes of the structs in each package
+// directory in a plenc.lock file. plenctag check [dirs] fails if the lock file
+// is out of date. Both fail if an index is reused, the type of a field changes
+// or the index of a removed field is used again.
 package main
 
 import (
@@ -9,8 +19,11 @@ import (
 	"go/format"
 	"go/parser"
 	"go/token"
+	"io"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
@@ -23,8 +36,15 @@ type config struct {
 	excludeJSONMinus bool
 	excludeSQLMinus  bool
 	excludePrivate   bool
+	roots            []string
 
 	fset *token.FileSet
+	// include selects the structs to tag. If nil all structs are tagged.
+	include func(st *ast.StructType) bool
+	// changed is set if rewrite adds any tags
+	changed bool
+	// warnings is where warnings about fields plenc can't encode are written
+	warnings io.Writer
 }
 
 func main() {
@@ -35,21 +55,37 @@ func main() {
 }
 
 func run() error {
-	var cfg config
+	cfg := config{warnings: os.Stderr}
 
 	flag.BoolVar(&cfg.write, "w", true, "Write result to (source) file instead of stdout")
 	flag.BoolVar(&cfg.excludeJSONMinus, "json", false, "Exclude json:\"-\"")
 	flag.BoolVar(&cfg.excludeSQLMinus, "sql", true, "Exclude sql:\"-\"")
 	flag.BoolVar(&cfg.excludePrivate, "private", true, "Exclude private fields (starting with lower case letter)")
+	flag.Func("root", "Only tag structs reachable from this type. May be repeated, and may be qualified with the package path (e.g. example.com/pkg.Type)", func(s string) error {
+		cfg.roots = append(cfg.roots, s)
+		return nil
+	})
 
 	flag.Parse()
 
+	switch mode := flag.Arg(0); mode {
+	case "lock", "check":
+		return cfg.lock(flag.Args()[1:], mode == "check")
+	}
+
 	if flag.NArg() == 0 {
 		fmt.Fprintln(os.Stderr, "no files specified")
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	if !isFileArgs(flag.Args()) {
+		return cfg.runPackages(flag.Args())
+	}
+	if len(cfg.roots) != 0 {
+		return fmt.Errorf("-root needs package patterns rather than files")
+	}
+
 	for _, filename := range flag.Args() {
 		node, err := cfg.parse(filename)
 		if err != nil {
@@ -98,22 +134,28 @@ func (c *config) rewrite(node ast.Node) (ast.Node, error) {
 	var errs rewriteErrors
 
 	recordError := func(f *ast.Field, err error) {
-		errs.Append(fmt.Errorf("%s:%d:%d:%s",
-			c.fset.Position(f.Pos()).Filename,
-			c.fset.Position(f.Pos()).Line,
-			c.fset.Position(f.Pos()).Column,
-			err))
+		errs.Append(c.positionError(f.Pos(), err))
 	}
 
+	reserved := c.reservedComments(node, &errs)
+
 	rewriteFunc := func(n ast.Node) bool {
 		x, ok := n.(*ast.StructType)
 		if !ok {
 			return true
 		}
+		if c.include != nil && !c.include(x) {
+			return true
+		}
 
 		// We make two passes through the fields. First we find the maximum existing plenc tag value. In the
 		// second pass we add plenc tags starting after this max value and skipping fields that match filters
+		// Indexes reserved by comments or by fields tagged `plenc:"4,reserved"`
+		// are included, so they are never allocated.
 		var maxPlenc int
+		for _, r := range reserved[x] {
+			maxPlenc = max(maxPlenc, r)
+		}
 		for _, f := range x.Fields.List {
 			if f.Tag == nil {
 				continue
@@ -128,6 +170,10 @@ func (c *config) rewrite(node ast.Node) (ast.Node, error) {
 			if pl > maxPlenc {
 				maxPlenc = pl
 			}
+
+			if slices.Contains(reserved[x], pl) && !isReservedField(f.Tag.Value) {
+				recordError(f, fmt.Errorf("index %d is reserved", pl))
+			}
 		}
 
 		// Now we make updates
@@ -165,6 +211,7 @@ func (c *config) rewrite(node ast.Node) (ast.Node, error) {
 			tags.Set(&tag)
 
 			f.Tag.Value = quote(tags.String())
+			c.changed = true
 		}
 
 		return true
@@ -232,6 +279,78 @@ func plencValue(tag string) (int, error) {
 	return strconv.Atoi(tagg.Name)
 }
 
+func isReservedField(tag string) bool {
+	tags, err := extractTags(tag)
+	if err != nil {
+		return false
+	}
+	tagg, err := tags.Get("plenc")
+	return err == nil && tagg.HasOption("reserved")
+}
+
+// reservedComments finds comments like //plenc:reserved 4,7 and returns the
+// indexes they reserve for each struct. The comment may be part of the doc
+// comment for the struct's type or anywhere within the struct body.
+func (c *config) reservedComments(node ast.Node, errs *rewriteErrors) map[*ast.StructType][]int {
+	file, ok := node.(*ast.File)
+	if !ok {
+		return nil
+	}
+
+	reserved := make(map[*ast.StructType][]int)
+	add := func(st *ast.StructType, cg *ast.CommentGroup) {
+		for _, comment := range cg.List {
+			list, ok := strings.CutPrefix(comment.Text, "//plenc:reserved")
+			if !ok {
+				continue
+			}
+			for _, val := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+				index, err := strconv.Atoi(val)
+				if err != nil {
+					errs.Append(c.positionError(comment.Pos(), fmt.Errorf("could not parse reserved index. %w", err)))
+					continue
+				}
+				reserved[st] = append(reserved[st], index)
+			}
+		}
+	}
+
+	// Structs are listed outer first, so the last struct that contains a
+	// comment is the innermost.
+	var structs []*ast.StructType
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.GenDecl:
+			if n.Tok == token.TYPE && len(n.Specs) == 1 && n.Doc != nil {
+				if st, ok := n.Specs[0].(*ast.TypeSpec).Type.(*ast.StructType); ok {
+					add(st, n.Doc)
+				}
+			}
+		case *ast.TypeSpec:
+			if st, ok := n.Type.(*ast.StructType); ok && n.Doc != nil {
+				add(st, n.Doc)
+			}
+		case *ast.StructType:
+			structs = append(structs, n)
+		}
+		return true
+	})
+
+	for _, cg := range file.Comments {
+		var inner *ast.StructType
+		for _, st := range structs {
+			if st.Pos() < cg.Pos() && cg.End() < st.End() {
+				inner = st
+			}
+		}
+		if inner != nil {
+			add(inner, cg)
+		}
+	}
+
+	return reserved
+}
+
 func quote(tag string) string {
 	return "`" + tag + "`"
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestRewriteReserved(t *testing.T) {
+	src := "package a\n\n" +
+		"// T is a type\n" +
+		"//\n" +
+		"//plenc:reserved 4, 5\n" +
+		"type T struct {\n" +
+		"\tA int `plenc:\"1\"`\n" +
+		"\tB int\n" +
+		"}\n\n" +
+		"type U struct {\n" +
+		"\tA int `plenc:\"1\"`\n" +
+		"\t_ struct{} `plenc:\"2,reserved\"`\n" +
+		"\tB int\n" +
+		"\tC struct {\n" +
+		"\t\t//plenc:reserved 1\n" +
+		"\t\tD int\n" +
+		"\t}\n" +
+		"}\n"
+
+	c := config{fset: token.NewFileSet()}
+	file, err := parser.ParseFile(c.fset, "a.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := c.rewrite(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, c.fset, node); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, exp := range []string{
+		"B int `plenc:\"6\"`",
+		"B int      `plenc:\"3\"`",
+		"D int `plenc:\"2\"`",
+		"} `plenc:\"4\"`",
+	} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Errorf("output does not contain %q\n%s", exp, buf.String())
+		}
+	}
+
+	src = "package a\n\n" +
+		"type T struct {\n" +
+		"\t//plenc:reserved 2\n" +
+		"\tA int `plenc:\"2\"`\n" +
+		"}\n"
+	file, err = parser.ParseFile(c.fset, "b.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.rewrite(file); err == nil || !strings.Contains(err.Error(), "b.go:5:2:index 2 is reserved") {
+		t.Fatalf("expected reserved index error, got %v", err)
+	}
+}
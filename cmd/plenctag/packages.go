@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/fatih/structtag"
+	"golang.org/x/tools/go/packages"
+)
+
+// isFileArgs returns true if the arguments are all Go files rather than
+// package patterns.
+func isFileArgs(args []string) bool {
+	for _, arg := range args {
+		if !strings.HasSuffix(arg, ".go") {
+			return false
+		}
+	}
+	return true
+}
+
+// runPackages tags the structs in the packages matching patterns. If root types
+// are configured only structs reachable from those types are tagged.
+func (c *config) runPackages(patterns []string) error {
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+	}, patterns...)
+	if err != nil {
+		return fmt.Errorf("could not load packages. %w", err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return fmt.Errorf("packages contain errors")
+	}
+
+	reachable, err := c.findReachable(pkgs)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		c.fset = pkg.Fset
+		c.include = func(st *ast.StructType) bool {
+			if reachable == nil {
+				return true
+			}
+			s, ok := pkg.TypesInfo.TypeOf(st).(*types.Struct)
+			return ok && reachable[s]
+		}
+
+		for _, file := range pkg.Syntax {
+			c.changed = false
+			rewritten, err := c.rewrite(file)
+			if err != nil {
+				return err
+			}
+			c.warnUnsupported(pkg, file)
+
+			if c.changed {
+				if err := c.format(rewritten, c.fset.File(file.Pos()).Name()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	c.include = nil
+
+	return nil
+}
+
+// findReachable finds the structs that are reachable from the root types. It
+// returns nil if there are no root types.
+func (c *config) findReachable(pkgs []*packages.Package) (map[*types.Struct]bool, error) {
+	if len(c.roots) == 0 {
+		return nil, nil
+	}
+
+	r := reachability{
+		structs: make(map[*types.Struct]bool),
+		named:   make(map[*types.Named]bool),
+		pkgs:    make(map[*types.Package]bool, len(pkgs)),
+	}
+	for _, pkg := range pkgs {
+		r.pkgs[pkg.Types] = true
+	}
+
+	for _, root := range c.roots {
+		pkgPath, name := "", root
+		if dot := strings.LastIndexByte(root, '.'); dot != -1 {
+			pkgPath, name = root[:dot], root[dot+1:]
+		}
+
+		var found bool
+		for _, pkg := range pkgs {
+			if pkgPath != "" && pkg.PkgPath != pkgPath {
+				continue
+			}
+			obj, ok := pkg.Types.Scope().Lookup(name).(*types.TypeName)
+			if !ok {
+				continue
+			}
+			found = true
+			r.visit(obj.Type())
+		}
+		if !found {
+			return nil, fmt.Errorf("root type %s not found", root)
+		}
+	}
+
+	return r.structs, nil
+}
+
+type reachability struct {
+	structs map[*types.Struct]bool
+	named   map[*types.Named]bool
+	// pkgs are the packages we've loaded. We only follow types within these
+	// packages.
+	pkgs map[*types.Package]bool
+}
+
+func (r *reachability) visit(t types.Type) {
+	switch t := t.(type) {
+	case *types.Alias:
+		r.visit(types.Unalias(t))
+	case *types.Named:
+		for targ := range t.TypeArgs().Types() {
+			r.visit(targ)
+		}
+		origin := t.Origin()
+		if r.named[origin] || !r.pkgs[origin.Obj().Pkg()] {
+			return
+		}
+		r.named[origin] = true
+		r.visit(origin.Underlying())
+	case *types.Pointer:
+		r.visit(t.Elem())
+	case *types.Slice:
+		r.visit(t.Elem())
+	case *types.Array:
+		r.visit(t.Elem())
+	case *types.Map:
+		r.visit(t.Key())
+		r.visit(t.Elem())
+	case *types.Struct:
+		if r.structs[t] {
+			return
+		}
+		r.structs[t] = true
+		for i := range t.NumFields() {
+			f := t.Field(i)
+			if !f.Exported() || isPlencMinus(t.Tag(i)) {
+				continue
+			}
+			r.visit(f.Type())
+		}
+	}
+}
+
+func isPlencMinus(tag string) bool {
+	tags, err := structtag.Parse(tag)
+	if err != nil {
+		return false
+	}
+	pl, err := tags.Get("plenc")
+	return err == nil && pl.Name == "-"
+}
+
+// warnUnsupported writes warnings for the fields of the tagged structs in file
+// that plenc can't encode.
+func (c *config) warnUnsupported(pkg *packages.Package, file *ast.File) {
+	ast.Inspect(file, func(n ast.Node) bool {
+		st, ok := n.(*ast.StructType)
+		if !ok || !c.include(st) {
+			return true
+		}
+		for _, f := range st.Fields.List {
+			if f.Tag == nil || isPlencMinus(strings.Trim(f.Tag.Value, "`")) {
+				continue
+			}
+			problem := unsupported(pkg.TypesInfo.TypeOf(f.Type))
+			if problem == "" {
+				continue
+			}
+			for _, name := range fieldNames(f) {
+				if !token.IsExported(name) {
+					continue
+				}
+				fmt.Fprintf(c.warnings, "%s: warning: field %s: %s\n", c.fset.Position(f.Pos()), name, problem)
+			}
+		}
+		return true
+	})
+}
+
+// encodingKind is a rough equivalent of the wire type plenc would use for a
+// type. It's enough to spot slices plenc won't encode.
+type encodingKind int
+
+const (
+	kindScalar encodingKind = iota
+	kindLength
+	kindSlice
+)
+
+// unsupported returns a description of why plenc can't encode a type, or an
+// empty string if it can.
+func unsupported(t types.Type) string {
+	_, problem := classify(t)
+	return problem
+}
+
+func classify(t types.Type) (encodingKind, string) {
+	switch t := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case t.Info()&types.IsComplex != 0:
+			return kindScalar, fmt.Sprintf("%s is not supported", t)
+		case t.Kind() == types.Uintptr || t.Kind() == types.UnsafePointer:
+			return kindScalar, fmt.Sprintf("%s is not supported", t)
+		case t.Info()&types.IsString != 0:
+			return kindLength, ""
+		}
+		return kindScalar, ""
+
+	case *types.Pointer:
+		return classify(t.Elem())
+
+	case *types.Struct:
+		// The fields of the struct are checked separately
+		return kindLength, ""
+
+	case *types.Slice:
+		return classifySlice(t.Elem())
+
+	case *types.Array:
+		return classifySlice(t.Elem())
+
+	case *types.Map:
+		if _, problem := classify(t.Key()); problem != "" {
+			return kindSlice, "map key: " + problem
+		}
+		if _, problem := classify(t.Elem()); problem != "" {
+			return kindSlice, "map value: " + problem
+		}
+		return kindSlice, ""
+
+	case *types.Interface:
+		return kindLength, "interface types must be registered with RegisterUnion"
+
+	case *types.Chan:
+		return kindScalar, "channels are not supported"
+
+	case *types.Signature:
+		return kindScalar, "funcs are not supported"
+	}
+
+	return kindScalar, fmt.Sprintf("%s is not supported", t)
+}
+
+func classifySlice(elem types.Type) (encodingKind, string) {
+	if b, ok := elem.Underlying().(*types.Basic); ok && b.Kind() == types.Byte {
+		return kindLength, ""
+	}
+
+	kind, problem := classify(elem)
+	if problem != "" {
+		return kindSlice, problem
+	}
+
+	if p, ok := elem.Underlying().(*types.Pointer); ok {
+		if b, ok := p.Elem().Underlying().(*types.Basic); ok && b.Info()&types.IsFloat != 0 {
+			return kindSlice, "slices of pointers to float32 & float64 are not supported"
+		}
+	}
+
+	switch kind {
+	case kindScalar:
+		return kindLength, ""
+	case kindLength:
+		return kindSlice, ""
+	}
+	return kindSlice, "slices of slices of structs or strings are not supported"
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunPackages(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/a\n\ngo 1.25\n",
+		"a.go": "package a\n\n" +
+			"type Root struct {\n" +
+			"\tA int `plenc:\"1\"`\n" +
+			"\tEmbedded\n" +
+			"\tOther *Other\n" +
+			"\tCh chan int\n" +
+			"\tNested [][]Other\n" +
+			"\tIgnored func() `plenc:\"-\"`\n" +
+			"}\n\n" +
+			"type Unreachable struct {\n" +
+			"\tA int\n" +
+			"}\n",
+		"b.go": "package a\n\n" +
+			"type Embedded struct {\n" +
+			"\tB string\n" +
+			"}\n\n" +
+			"type Other struct {\n" +
+			"\tC map[string]Embedded\n" +
+			"}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	var warnings bytes.Buffer
+	c := config{
+		write:          true,
+		excludePrivate: true,
+		roots:          []string{"Root"},
+		warnings:       &warnings,
+	}
+	if err := c.runPackages([]string{"./..."}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := os.ReadFile(filepath.Join(dir, "a.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "b.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, exp := range []string{
+		"Embedded `plenc:\"2\"`",
+		"Other    *Other    `plenc:\"3\"`",
+		"Nested   [][]Other `plenc:\"5\"`",
+		"A int\n}",
+	} {
+		if !strings.Contains(string(a), exp) {
+			t.Errorf("a.go does not contain %q\n%s", exp, a)
+		}
+	}
+	for _, exp := range []string{
+		"B string `plenc:\"1\"`",
+		"C map[string]Embedded `plenc:\"1\"`",
+	} {
+		if !strings.Contains(string(b), exp) {
+			t.Errorf("b.go does not contain %q\n%s", exp, b)
+		}
+	}
+
+	for _, exp := range []string{
+		"a.go:7:2: warning: field Ch: channels are not supported",
+		"a.go:8:2: warning: field Nested: slices of slices of structs or strings are not supported",
+	} {
+		if !strings.Contains(warnings.String(), exp) {
+			t.Errorf("warnings do not contain %q\n%s", exp, warnings.String())
+		}
+	}
+	if strings.Contains(warnings.String(), "Ignored") {
+		t.Errorf("unexpected warning for excluded field\n%s", warnings.String())
+	}
+
+	c.roots = []string{"Missing"}
+	if err := c.runPackages([]string{"./..."}); err == nil || err.Error() != "root type Missing not found" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
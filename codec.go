@@ -3,6 +3,7 @@ package plenc
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -39,6 +40,12 @@ func RegisterCodecWithTag(typ reflect.Type, tag string, c plenccodec.Codec) {
 	defaultPlenc.RegisterCodecWithTag(typ, tag, c)
 }
 
+// RegisterUnion registers the set of concrete types that may be held in fields
+// of the interface type iface. See Plenc.RegisterUnion.
+func RegisterUnion(iface reflect.Type, members ...plenccodec.UnionMember) {
+	defaultPlenc.RegisterUnion(iface, members...)
+}
+
 // CodecForType returns a codec for the requested type. It should only be needed
 // when constructing a codec based on an existing plenc codec
 func CodecForType(typ reflect.Type) (plenccodec.Codec, error) {
@@ -72,6 +79,23 @@ func (br *baseRegistry) Store(typ reflect.Type, tag string, c plenccodec.Codec)
 	br.codecRegistry.Store(registryKey{typ: typ, tag: tag}, c)
 }
 
+// unionRegistry records the concrete types registered for interface types
+type unionRegistry struct {
+	members sync.Map
+}
+
+func (ur *unionRegistry) Load(iface reflect.Type) []plenccodec.UnionMember {
+	m, ok := ur.members.Load(iface)
+	if !ok {
+		return nil
+	}
+	return m.([]plenccodec.UnionMember)
+}
+
+func (ur *unionRegistry) Store(iface reflect.Type, members []plenccodec.UnionMember) {
+	ur.members.Store(iface, members)
+}
+
 func (br *baseRegistry) StoreOrSwap(typ reflect.Type, tag string, c plenccodec.Codec) plenccodec.Codec {
 	cv, _ := br.codecRegistry.LoadOrStore(registryKey{typ: typ, tag: tag}, c)
 	return cv.(plenccodec.Codec)
@@ -128,7 +152,13 @@ func (br *localRegistry) Commit() {
 func (p *Plenc) CodecForTypeRegistry(registry plenccodec.CodecRegistry, typ reflect.Type, tag string) (plenccodec.Codec, error) {
 	lr := &localRegistry{local: make(map[registryKey]plenccodec.Codec), codecRegistry: registry}
 
-	icb := internalCodecBuilder{codecRegistry: lr, ProtoCompatibleArrays: p.ProtoCompatibleArrays}
+	icb := internalCodecBuilder{
+		codecRegistry:         lr,
+		unionRegistry:         &p.unionRegistry,
+		ProtoCompatibleArrays: p.ProtoCompatibleArrays,
+		EncodingFallback:      p.EncodingFallback,
+		useGenerated:          p.useGenerated(),
+	}
 
 	c, err := icb.CodecForTypeRegistry(lr, typ, tag)
 	if err != nil {
@@ -138,11 +168,30 @@ func (p *Plenc) CodecForTypeRegistry(registry plenccodec.CodecRegistry, typ refl
 	return c, nil
 }
 
+// useGenerated returns true if p can use codec methods written by
+// cmd/plenccodegen. The methods encode fields with the codecs of the default
+// Plenc, so we only use them if p encodes everything as the default does.
+func (p *Plenc) useGenerated() bool {
+	if p.NoGeneratedCodecs {
+		return false
+	}
+	if p.customised.Load() || defaultPlenc.customised.Load() {
+		return false
+	}
+	if p == &defaultPlenc {
+		return true
+	}
+	return !p.ProtoCompatibleArrays && !p.ProtoCompatibleTime && !p.ZeroCopy && !p.EncodingFallback
+}
+
 // internalCodecBuilder is uses so we can wrap the codec registry with a
 // local registry just once, then use this to build codecs as needed.
 type internalCodecBuilder struct {
 	codecRegistry         plenccodec.CodecRegistry
+	unionRegistry         *unionRegistry
 	ProtoCompatibleArrays bool
+	EncodingFallback      bool
+	useGenerated          bool
 }
 
 // codecForBasicType shortcuts the local registry. Basic types should be pre-registered
@@ -161,6 +210,30 @@ func (p internalCodecBuilder) CodecForTypeRegistry(registry plenccodec.CodecRegi
 		return c, nil
 	}
 
+	// Types that encode themselves take precedence over the codecs we'd
+	// otherwise build for them.
+	if plenccodec.IsMarshaler(typ) {
+		c, err := plenccodec.BuildMarshalerCodec(typ)
+		if err != nil {
+			return nil, err
+		}
+		return registry.StoreOrSwap(typ, tag, c), nil
+	}
+
+	if c, err := p.decimalCodec(typ, tag); c != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return registry.StoreOrSwap(typ, tag, c), nil
+	}
+
+	if c, err := p.encodingCodec(typ, tag); c != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return registry.StoreOrSwap(typ, tag, c), nil
+	}
+
 	var err error
 
 	switch typ.Kind() {
@@ -186,44 +259,69 @@ func (p internalCodecBuilder) CodecForTypeRegistry(registry plenccodec.CodecRegi
 			if err != nil {
 				return nil, err
 			}
+			// Prefer codec methods written by plenccodegen if the type has
+			// them. We still need the struct codec for the descriptor.
+			if p.useGenerated && tag == "" && plenccodec.IsGenerated(typ) {
+				c, err = plenccodec.BuildGeneratedCodec(typ, c)
+				if err != nil {
+					return nil, err
+				}
+			}
 		}
 
 	case reflect.Slice:
 		subt := typ.Elem()
 		// We assume for now that any tag here will be selecting the array
-		// treatment, not the registry for the underlying type.
-		subc, err := p.CodecForTypeRegistry(registry, subt, "")
+		// treatment, not the registry for the underlying type. The exception
+		// is tags that select the element encoding.
+		subc, err := p.CodecForTypeRegistry(registry, subt, elementTag(tag))
 		if err != nil {
 			return nil, err
 		}
-		bs := plenccodec.BaseSliceWrapper{Underlying: subc, EltSize: subt.Size(), EltType: unpackEFace(subt).data}
-		switch subc.WireType() {
-		case plenccore.WTVarInt:
-			c = plenccodec.WTVarIntSliceWrapper{BaseSliceWrapper: bs}
-		case plenccore.WT64, plenccore.WT32:
-			if subt.Kind() == reflect.Pointer {
-				// Can probably support these if we don't allow missing entries
-				return nil, fmt.Errorf("slices of pointers to float32 & float64 are not supported")
-			}
-			c = plenccodec.WTFixedSliceWrapper{BaseSliceWrapper: bs}
-		case plenccore.WTLength:
-			if p.ProtoCompatibleArrays || tag == "proto" {
-				// When writing we just want to repeat the encoding of an
-				// individual element within the slice as if it was a separate
-				// element.
-				// When reading we'll read elements repeatedly and append them to the array
-				c = plenccodec.ProtoSliceWrapper{BaseSliceWrapper: bs}
-			} else {
-				c = plenccodec.WTLengthSliceWrapper{BaseSliceWrapper: bs}
-			}
-		case plenccore.WTSlice:
-			return nil, fmt.Errorf("slices of slices of structs or strings are not supported")
-		default:
-			return nil, fmt.Errorf("unexpected wire type %d for slice wrapper for type %q", subc.WireType(), typ.Name())
+		c, err = p.sliceWrapper(typ, subc, p.ProtoCompatibleArrays || tag == "proto")
+		if err != nil {
+			return nil, err
+		}
+
+	case reflect.Array:
+		subt := typ.Elem()
+		if subt.Kind() == reflect.Uint8 {
+			// Byte arrays are encoded like []byte
+			c = plenccodec.ByteArrayCodec{Len: typ.Len()}
+			break
+		}
+		subc, err := p.CodecForTypeRegistry(registry, subt, elementTag(tag))
+		if err != nil {
+			return nil, err
+		}
+		// We can't use the protobuf encoding for arrays of WTLength types
+		sc, err := p.sliceWrapper(typ, subc, false)
+		if err != nil {
+			return nil, err
+		}
+		c = plenccodec.ArrayWrapper{
+			Underlying: sc,
+			Len:        typ.Len(),
+			EltSize:    subt.Size(),
+			EltType:    unpackEFace(subt).data,
 		}
 
 	case reflect.Map:
-		c, err = plenccodec.BuildMapCodec(p, registry, typ, tag)
+		mapTag := tag
+		if p.ProtoCompatibleArrays {
+			mapTag = "proto"
+		}
+		c, err = plenccodec.BuildMapCodec(p, registry, typ, mapTag)
+		if err != nil {
+			return nil, err
+		}
+
+	case reflect.Interface:
+		members := p.unionRegistry.Load(typ)
+		if members == nil {
+			return nil, fmt.Errorf("no union registered for interface type %s", typ)
+		}
+		c, err = plenccodec.BuildInterfaceCodec(p, registry, typ, members)
 		if err != nil {
 			return nil, err
 		}
@@ -316,8 +414,6 @@ func (p internalCodecBuilder) CodecForTypeRegistry(registry plenccodec.CodecRegi
 		// case reflect.Uintptr:
 		// case reflect.Complex64:
 		// case reflect.Complex128:
-		// case reflect.Array:
-		// case reflect.Interface:
 		// case reflect.Chan:
 		// case reflect.Func:
 		// case reflect.UnsafePointer:
@@ -329,3 +425,123 @@ func (p internalCodecBuilder) CodecForTypeRegistry(registry plenccodec.CodecRegi
 
 	return registry.StoreOrSwap(typ, tag, c), nil
 }
+
+// encodingCodec returns a codec that uses a type's encoding.BinaryMarshaler
+// or encoding.TextMarshaler methods if the tag asks for one, or if
+// EncodingFallback is set and the type has them. It returns nil if neither
+// applies.
+func (p internalCodecBuilder) encodingCodec(typ reflect.Type, tag string) (plenccodec.Codec, error) {
+	switch tag {
+	case "binary", "text":
+		switch {
+		case tag == "binary" && plenccodec.IsBinaryMarshaler(typ):
+			return plenccodec.BuildBinaryCodec(typ)
+		case tag == "text" && plenccodec.IsTextMarshaler(typ):
+			return plenccodec.BuildTextCodec(typ)
+		}
+		switch typ.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Array:
+			// The tag applies to the element type
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s does not implement the %s marshaling interfaces", typ, tag)
+	}
+	if !p.EncodingFallback {
+		return nil, nil
+	}
+	if plenccodec.IsBinaryMarshaler(typ) {
+		return plenccodec.BuildBinaryCodec(typ)
+	}
+	if plenccodec.IsTextMarshaler(typ) {
+		return plenccodec.BuildTextCodec(typ)
+	}
+	return nil, nil
+}
+
+// decimalCodec returns a codec for types that implement
+// plenccodec.DecimalAdapter, and for ints with a decimal=<scale> tag. It
+// returns nil if neither applies.
+func (p internalCodecBuilder) decimalCodec(typ reflect.Type, tag string) (plenccodec.Codec, error) {
+	if tag == "" && plenccodec.IsDecimal(typ) {
+		return plenccodec.BuildDecimalCodec(typ)
+	}
+	scaleStr, ok := strings.CutPrefix(tag, "decimal=")
+	if !ok {
+		return nil, nil
+	}
+	scale, err := strconv.Atoi(scaleStr)
+	if err != nil || scale < 0 {
+		return nil, fmt.Errorf("invalid decimal scale %q", scaleStr)
+	}
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		// The tag applies to the element type
+		return nil, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if scale > plenccodec.DecimalPrecision(typ) {
+			return nil, fmt.Errorf("decimal scale %d is too large for %s", scale, typ)
+		}
+	default:
+		return nil, fmt.Errorf("%s can't have a decimal scale", typ)
+	}
+	switch typ.Kind() {
+	case reflect.Int8:
+		return plenccodec.ScaledIntCodec[int8]{Scale: scale}, nil
+	case reflect.Int16:
+		return plenccodec.ScaledIntCodec[int16]{Scale: scale}, nil
+	case reflect.Int32:
+		return plenccodec.ScaledIntCodec[int32]{Scale: scale}, nil
+	case reflect.Int64:
+		return plenccodec.ScaledIntCodec[int64]{Scale: scale}, nil
+	}
+	return plenccodec.ScaledIntCodec[int]{Scale: scale}, nil
+}
+
+// elementTag returns the tag to use for the elements of a slice or array field
+// with the given tag. Only the tags that select the encoding of a value are
+// passed through: other tags either select the slice encoding or are applied
+// to the field as a whole. The flat tag has always been ignored for slices, so
+// changing that would change the encoding of existing data. The flatelems tag
+// selects flat elements instead, with negative values sign extended as
+// protobuf does.
+func elementTag(tag string) string {
+	switch tag {
+	case "fixed", "binary", "text", "flatelems":
+		return tag
+	}
+	if strings.HasPrefix(tag, "decimal=") {
+		return tag
+	}
+	return ""
+}
+
+// sliceWrapper selects the codec for a slice or array type typ, where the
+// elements are encoded with subc. If proto is set then slices of WTLength types
+// use the protobuf encoding.
+func (p internalCodecBuilder) sliceWrapper(typ reflect.Type, subc plenccodec.Codec, proto bool) (plenccodec.Codec, error) {
+	subt := typ.Elem()
+	bs := plenccodec.BaseSliceWrapper{Underlying: subc, EltSize: subt.Size(), EltType: unpackEFace(subt).data}
+	switch subc.WireType() {
+	case plenccore.WTVarInt:
+		return plenccodec.WTVarIntSliceWrapper{BaseSliceWrapper: bs}, nil
+	case plenccore.WT64, plenccore.WT32:
+		if subt.Kind() == reflect.Pointer {
+			// Can probably support these if we don't allow missing entries
+			return nil, fmt.Errorf("slices of pointers to float32 & float64 are not supported")
+		}
+		return plenccodec.WTFixedSliceWrapper{BaseSliceWrapper: bs}, nil
+	case plenccore.WTLength:
+		if proto {
+			// When writing we just want to repeat the encoding of an
+			// individual element within the slice as if it was a separate
+			// element.
+			// When reading we'll read elements repeatedly and append them to the array
+			return plenccodec.ProtoSliceWrapper{BaseSliceWrapper: bs}, nil
+		}
+		return plenccodec.WTLengthSliceWrapper{BaseSliceWrapper: bs}, nil
+	case plenccore.WTSlice:
+		return nil, fmt.Errorf("slices of slices of structs or strings are not supported")
+	default:
+		return nil, fmt.Errorf("unexpected wire type %d for slice wrapper for type %q", subc.WireType(), typ.Name())
+	}
+}
@@ -0,0 +1,378 @@
+package plenc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccodec"
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// A container is a self-describing file of plenc records, all of the same
+// type. It starts with a header.
+//
+//   - The magic bytes "PLNC" and a version byte, currently 1.
+//   - The plenc-encoded Descriptor of the record type, prefixed by its length
+//     as a varint.
+//   - A random 16 byte sync marker.
+//
+// The records follow in blocks. Each block is
+//
+//   - The number of records in the block, as a varint.
+//   - The length of the records in bytes, as a varint.
+//   - The records. Each is preceded by its length as a varint, as written by
+//     an Encoder.
+//   - The sync marker from the header.
+//
+// The sync marker lets readers check that each block ends where expected. It
+// is only a check: readers don't search for it to skip past a corrupt block.
+
+const (
+	containerMagic   = "PLNC"
+	containerVersion = 1
+	syncMarkerSize   = 16
+
+	// DefaultContainerBlockSize is the default size at which a
+	// ContainerWriter writes out a block of records.
+	DefaultContainerBlockSize = 64 << 10
+)
+
+// ContainerWriter writes records of a single type to a container. See
+// ContainerReader for reading them back. Records are buffered and written a
+// block at a time, so call Flush once all the records are written.
+type ContainerWriter struct {
+	// BlockSize is the size of records in bytes at which the writer writes a
+	// block. NewContainerWriter sets this to DefaultContainerBlockSize.
+	BlockSize int
+
+	p     *Plenc
+	w     io.Writer
+	typ   reflect.Type
+	codec plenccodec.Codec
+	sync  [syncMarkerSize]byte
+
+	count int
+	block []byte
+	buf   []byte
+}
+
+// NewContainerWriter writes the container header for records of type typ to
+// w, and returns a ContainerWriter to write the records. It uses the default
+// Plenc instance.
+func NewContainerWriter(w io.Writer, typ reflect.Type) (*ContainerWriter, error) {
+	return defaultPlenc.NewContainerWriter(w, typ)
+}
+
+// NewContainerWriter writes the container header for records of type typ to
+// w, and returns a ContainerWriter that encodes records using p.
+func (p *Plenc) NewContainerWriter(w io.Writer, typ reflect.Type) (*ContainerWriter, error) {
+	c, err := p.CodecForType(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	cw := &ContainerWriter{
+		BlockSize: DefaultContainerBlockSize,
+		p:         p,
+		w:         w,
+		typ:       typ,
+		codec:     c,
+	}
+	if _, err := rand.Read(cw.sync[:]); err != nil {
+		return nil, fmt.Errorf("failed to create sync marker. %w", err)
+	}
+
+	// Descriptors are always encoded with the default Plenc, so that readers
+	// don't need to know how the records were written.
+	d := c.Descriptor()
+	desc, err := Marshal(nil, &d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal descriptor. %w", err)
+	}
+
+	header := make([]byte, 0, len(containerMagic)+1+plenccore.SizeVarUint(uint64(len(desc)))+len(desc)+syncMarkerSize)
+	header = append(header, containerMagic...)
+	header = append(header, containerVersion)
+	header = plenccore.AppendVarUint(header, uint64(len(desc)))
+	header = append(header, desc...)
+	header = append(header, cw.sync[:]...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// Write adds a record to the container. value must have the type given to
+// NewContainerWriter, or be a pointer to it.
+func (cw *ContainerWriter) Write(value any) error {
+	typ := reflect.TypeOf(value)
+	if typ == nil || (typ != cw.typ && (typ.Kind() != reflect.Pointer || typ.Elem() != cw.typ)) {
+		return fmt.Errorf("cannot write %s to a container of %s", typ, cw.typ)
+	}
+	ptr, _, err := cw.p.preamble(value)
+	if err != nil {
+		return err
+	}
+
+	if err := cw.appendRecord(ptr); err != nil {
+		return err
+	}
+	cw.count++
+
+	if len(cw.block) >= cw.BlockSize {
+		return cw.Flush()
+	}
+	return nil
+}
+
+// appendRecord adds the length-prefixed encoding of the value at ptr to the
+// block. The block is unchanged if the value can't be encoded.
+func (cw *ContainerWriter) appendRecord(ptr unsafe.Pointer) (err error) {
+	l := len(cw.block)
+	defer func() {
+		if err != nil {
+			cw.block = cw.block[:l]
+		}
+	}()
+	defer recoverEncodeError(&err)
+
+	if ptr == nil || cw.codec.Omit(ptr) {
+		cw.block = plenccore.AppendVarUint(cw.block, 0)
+		return nil
+	}
+	cw.block = plenccore.AppendVarUint(cw.block, uint64(cw.codec.Size(ptr, nil)))
+	cw.block = cw.codec.Append(cw.block, ptr, nil)
+	return nil
+}
+
+// Flush writes any buffered records to the underlying writer as a block.
+func (cw *ContainerWriter) Flush() error {
+	if cw.count == 0 {
+		return nil
+	}
+
+	cw.buf = cw.buf[:0]
+	cw.buf = plenccore.AppendVarUint(cw.buf, uint64(cw.count))
+	cw.buf = plenccore.AppendVarUint(cw.buf, uint64(len(cw.block)))
+	cw.buf = append(cw.buf, cw.block...)
+	cw.buf = append(cw.buf, cw.sync[:]...)
+
+	cw.count = 0
+	cw.block = cw.block[:0]
+
+	_, err := cw.w.Write(cw.buf)
+	return err
+}
+
+// ContainerReader reads records from a container written by a
+// ContainerWriter. Read decodes records into Go values, and ReadTo passes them
+// to an Outputter using the Descriptor stored in the container, so records can
+// be read without the Go type that wrote them.
+//
+// A ContainerReader stops at the first corrupt block or record: once Read or
+// ReadTo return an error for corrupt data they return the same error for every
+// later call.
+type ContainerReader struct {
+	// MaxBlockSize limits the size of the blocks the reader will read.
+	// NewContainerReader sets this to DefaultMaxMessageSize.
+	MaxBlockSize int
+
+	p          *Plenc
+	r          byteReader
+	descriptor plenccodec.Descriptor
+	sync       [syncMarkerSize]byte
+
+	// The current block, and the records not yet read from it
+	block   []byte
+	records []byte
+	count   uint64
+	// err is set once we find corrupt data, as we can't find the next block
+	err error
+
+	// The last type we checked against the descriptor
+	checked reflect.Type
+}
+
+// NewContainerReader reads the container header from r, and returns a
+// ContainerReader to read the records. It uses the default Plenc instance. If
+// r does not implement io.ByteReader it is wrapped in a bufio.Reader.
+func NewContainerReader(r io.Reader) (*ContainerReader, error) {
+	return defaultPlenc.NewContainerReader(r)
+}
+
+// NewContainerReader reads the container header from r, and returns a
+// ContainerReader that decodes records using p. See NewContainerReader.
+func (p *Plenc) NewContainerReader(r io.Reader) (*ContainerReader, error) {
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	cr := &ContainerReader{MaxBlockSize: DefaultMaxMessageSize, p: p, r: br}
+
+	var magic [len(containerMagic) + 1]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return nil, fmt.Errorf("failed to read container header. %w", err)
+	}
+	if string(magic[:len(containerMagic)]) != containerMagic {
+		return nil, fmt.Errorf("not a plenc container")
+	}
+	if v := magic[len(containerMagic)]; v != containerVersion {
+		return nil, fmt.Errorf("unsupported container version %d", v)
+	}
+
+	desc, err := cr.readChunk("descriptor")
+	if err != nil {
+		return nil, err
+	}
+	if err := Unmarshal(desc, &cr.descriptor); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal descriptor. %w", err)
+	}
+
+	if _, err := io.ReadFull(br, cr.sync[:]); err != nil {
+		return nil, fmt.Errorf("failed to read container header. %w", unexpectedEOF(err))
+	}
+	return cr, nil
+}
+
+// Descriptor returns the descriptor of the records in the container.
+func (cr *ContainerReader) Descriptor() plenccodec.Descriptor {
+	return cr.descriptor
+}
+
+// Read reads the next record into value, which must be a non-nil pointer. It
+// returns io.EOF once there are no more records. Read checks the type of value
+// is compatible with the descriptor in the container, as for
+// plenccodec.CheckCompatible.
+func (cr *ContainerReader) Read(value any) error {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("you must pass in a non-nil pointer")
+	}
+	typ := rv.Type().Elem()
+
+	c, err := cr.p.CodecForType(typ)
+	if err != nil {
+		return err
+	}
+	if typ != cr.checked {
+		if problems := plenccodec.CheckCompatible(cr.descriptor, c.Descriptor()); len(problems) != 0 {
+			return fmt.Errorf("%s is not compatible with the container records. %s", typ, problems[0])
+		}
+		cr.checked = typ
+	}
+
+	data, err := cr.next()
+	if err != nil {
+		return err
+	}
+	if cr.p.ZeroCopy {
+		// The decoded value may refer to the data, and we re-use the block
+		// buffer.
+		data = bytes.Clone(data)
+	}
+	_, err = c.Read(data, unsafe.Pointer(rv.Pointer()), c.WireType())
+	return err
+}
+
+// ReadTo reads the next record and passes it to out using the descriptor in
+// the container. It returns io.EOF once there are no more records. Use it with
+// a plenccodec.JSONOutput to convert records to JSON.
+func (cr *ContainerReader) ReadTo(out plenccodec.Outputter) error {
+	data, err := cr.next()
+	if err != nil {
+		return err
+	}
+	return cr.descriptor.Read(out, data)
+}
+
+// next returns the data for the next record.
+func (cr *ContainerReader) next() ([]byte, error) {
+	if cr.err != nil {
+		return nil, cr.err
+	}
+	for cr.count == 0 {
+		if err := cr.readBlock(); err != nil {
+			if !errors.Is(err, io.EOF) {
+				cr.err = err
+			}
+			return nil, err
+		}
+	}
+
+	l, n := plenccore.ReadVarUint(cr.records)
+	if n <= 0 || l > uint64(len(cr.records)-n) {
+		cr.err = fmt.Errorf("corrupt record in container block")
+		return nil, cr.err
+	}
+	data := cr.records[n : n+int(l)]
+	cr.records = cr.records[n+int(l):]
+	cr.count--
+	if cr.count == 0 && len(cr.records) != 0 {
+		cr.err = fmt.Errorf("container block has %d bytes after its last record", len(cr.records))
+		return nil, cr.err
+	}
+	return data, nil
+}
+
+func (cr *ContainerReader) readBlock() error {
+	count, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		return fmt.Errorf("failed to read container block. %w", unexpectedEOF(err))
+	}
+
+	block, err := cr.readChunk("block")
+	if err != nil {
+		return err
+	}
+
+	var sync [syncMarkerSize]byte
+	if _, err := io.ReadFull(cr.r, sync[:]); err != nil {
+		return fmt.Errorf("failed to read container sync marker. %w", unexpectedEOF(err))
+	}
+	if sync != cr.sync {
+		return fmt.Errorf("container sync marker does not match")
+	}
+
+	cr.count = count
+	cr.records = block
+	return nil
+}
+
+// readChunk reads data prefixed by its length as a varint into the reader's
+// buffer.
+func (cr *ContainerReader) readChunk(what string) ([]byte, error) {
+	l, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container %s length. %w", what, unexpectedEOF(err))
+	}
+	if l > uint64(cr.MaxBlockSize) {
+		return nil, fmt.Errorf("container %s length %d exceeds maximum block size %d", what, l, cr.MaxBlockSize)
+	}
+	if uint64(cap(cr.block)) < l {
+		cr.block = make([]byte, l)
+	}
+	cr.block = cr.block[:l]
+	if _, err := io.ReadFull(cr.r, cr.block); err != nil {
+		return nil, fmt.Errorf("failed to read container %s. %w", what, unexpectedEOF(err))
+	}
+	return cr.block, nil
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF, for reads that must
+// succeed within a container.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
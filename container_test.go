@@ -0,0 +1,171 @@
+package plenc_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+func writeContainer(t *testing.T, in []record, blockSize int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := plenc.NewContainerWriter(&buf, reflect.TypeFor[record]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.BlockSize = blockSize
+	for i := range in {
+		if err := w.Write(&in[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestContainer(t *testing.T) {
+	var in []record
+	for i := range 100 {
+		in = append(in, record{ID: i, Name: strconv.Itoa(i), Tags: []string{"x"}})
+	}
+	in = append(in, record{})
+
+	for _, blockSize := range []int{1, 100, plenc.DefaultContainerBlockSize} {
+		data := writeContainer(t, in, blockSize)
+
+		readers := map[string]func() io.Reader{
+			"bytes":   func() io.Reader { return bytes.NewReader(data) },
+			"onebyte": func() io.Reader { return iotest.OneByteReader(bytes.NewReader(data)) },
+		}
+		for name, r := range readers {
+			t.Run(strconv.Itoa(blockSize)+"/"+name, func(t *testing.T) {
+				cr, err := plenc.NewContainerReader(r())
+				if err != nil {
+					t.Fatal(err)
+				}
+				var out []record
+				for {
+					var r record
+					if err := cr.Read(&r); err != nil {
+						if err == io.EOF {
+							break
+						}
+						t.Fatal(err)
+					}
+					out = append(out, r)
+				}
+				if diff := cmp.Diff(in, out); diff != "" {
+					t.Fatal(diff)
+				}
+			})
+		}
+	}
+}
+
+func TestContainerGeneric(t *testing.T) {
+	data := writeContainer(t, []record{{ID: 1, Name: "one", Tags: []string{"a"}}, {ID: 2}}, 1)
+
+	cr, err := plenc.NewContainerReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cr.Descriptor(); d.TypeName != "record" || len(d.Elements) != 3 {
+		t.Fatalf("unexpected descriptor %#v", d)
+	}
+
+	var j plenccodec.JSONOutput
+	var out []byte
+	for {
+		if err := cr.ReadTo(&j); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatal(err)
+		}
+		out = append(out, j.Done()...)
+		j.Reset()
+	}
+
+	exp := `{
+  "ID": 1,
+  "Name": "one",
+  "Tags": [
+    "a"
+  ]
+}
+{
+  "ID": 2
+}
+`
+	if diff := cmp.Diff(exp, string(out)); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestContainerErrors(t *testing.T) {
+	data := writeContainer(t, []record{{ID: 1}, {ID: 2}}, 1)
+
+	var buf bytes.Buffer
+	w, err := plenc.NewContainerWriter(&buf, reflect.TypeFor[record]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(1); err == nil || err.Error() != "cannot write int to a container of plenc_test.record" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if _, err := plenc.NewContainerReader(bytes.NewReader([]byte("not a container"))); err == nil || err.Error() != "not a plenc container" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	cr, err := plenc.NewContainerReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var other struct {
+		ID string `plenc:"1"`
+	}
+	if err := cr.Read(&other); err == nil || err.Error() != "struct { ID string \"plenc:\\\"1\\\"\" } is not compatible with the container records. ID: type changed from FieldTypeInt to FieldTypeString" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Each block has a count, a length, one 3 byte record and a sync marker.
+	// Change the last byte of the first sync marker.
+	const blockLen = 1 + 1 + 3 + 16
+	corrupt := bytes.Clone(data)
+	corrupt[len(data)-blockLen-1]++
+	cr, err = plenc.NewContainerReader(bytes.NewReader(corrupt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r record
+	if err := cr.Read(&r); err == nil || err.Error() != "container sync marker does not match" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// We can't find the next block, so reading stops.
+	if err := cr.Read(&r); err == nil || err.Error() != "container sync marker does not match" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Truncated in the middle of a block
+	cr, err = plenc.NewContainerReader(bytes.NewReader(data[:len(data)-5]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cr.Read(&r); err != nil {
+		t.Fatal(err)
+	}
+	if err := cr.Read(&r); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -19,8 +19,16 @@
 //      // The values of this field are interned. This reduces allocations if
 //      // there are a limited set of distinct values used.
 //      D  string `plenc:"3,intern"`
+//      // These fields are encoded with their MarshalBinary and MarshalText
+//      // methods.
+//      E  netip.Addr `plenc:"4,binary"`
+//      F  *big.Int `plenc:"5,text"`
 //  }
 //
+// The index of a removed field can be reserved with a blank field tagged
+// `plenc:"2,reserved"`. plenc won't build a codec for a struct where another
+// field uses a reserved index.
+//
 // The plenctag tool will add tags to structs for you.
 //
 // plenc only encodes fields that are exported - ones where the field name
@@ -0,0 +1,53 @@
+package plenc
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/philpearl/plenc/plenccodec"
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// GeneratedField is the codec and encoded tag for a field of a struct with
+// codec methods written by cmd/plenccodegen. The generated code uses these for
+// fields it doesn't encode directly.
+type GeneratedField struct {
+	plenccodec.Codec
+	Tag []byte
+}
+
+// LazyGeneratedField returns a function that returns the GeneratedField for a
+// struct field of type typ with the given index and plenc tag option. The codec
+// comes from the default Plenc and is built the first time the function is
+// called. If no codec can be built the function panics with a
+// plenccodec.EncodeError, which Marshal returns as an error. This can't happen
+// when plenc uses the generated methods, as plenc has already built a codec for
+// the struct.
+func LazyGeneratedField(typ reflect.Type, index int, option string) func() *GeneratedField {
+	return sync.OnceValue(func() *GeneratedField {
+		// Interning is set up per field, just as in BuildStructCodec
+		wantIntern := option == "intern"
+		if wantIntern {
+			option = ""
+		}
+
+		c, err := defaultPlenc.CodecForTypeWithTag(typ, option)
+		if err != nil {
+			panic(plenccodec.EncodeError{Err: fmt.Errorf("no codec for generated field of type %s. %w", typ, err)})
+		}
+		if wantIntern {
+			if in, ok := c.(plenccodec.Interner); ok {
+				c = in.WithInterning()
+			}
+		}
+		if fc, ok := c.(plenccodec.FieldCodecer); ok {
+			c = fc.FieldCodec()
+		}
+
+		return &GeneratedField{
+			Codec: c,
+			Tag:   plenccore.AppendTag(nil, c.WireType(), index),
+		}
+	})
+}
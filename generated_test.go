@@ -0,0 +1,307 @@
+package plenc_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	fuzz "github.com/google/gofuzz"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/internal/gentest"
+	"github.com/philpearl/plenc/plenccodec"
+	"github.com/philpearl/plenc/plenccore"
+)
+
+func TestGeneratedCodec(t *testing.T) {
+	c, err := plenc.CodecForType(reflect.TypeFor[gentest.Thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.(*plenccodec.GeneratedCodec); !ok {
+		t.Fatalf("expected a generated codec, got %T", c)
+	}
+
+	var reflective plenc.Plenc
+	reflective.NoGeneratedCodecs = true
+	reflective.RegisterDefaultCodecs()
+	rc, err := reflective.CodecForType(reflect.TypeFor[gentest.Thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rc.(*plenccodec.StructCodec); !ok {
+		t.Fatalf("expected a struct codec, got %T", rc)
+	}
+
+	if diff := cmp.Diff(rc.Descriptor(), c.Descriptor()); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// The generated methods are not the methods of a type that encodes
+	// itself.
+	if _, ok := any(&gentest.Thing{}).(plenccodec.PlencUnmarshaler); ok {
+		t.Fatal("generated type should not implement PlencUnmarshaler")
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	var reflective plenc.Plenc
+	reflective.NoGeneratedCodecs = true
+	reflective.RegisterDefaultCodecs()
+
+	f := fuzz.New().MaxDepth(4).Funcs(
+		func(t *time.Time, c fuzz.Continue) {
+			*t = time.Unix(c.Int63n(1<<40), c.Int63n(1e9)).UTC()
+		},
+		func(o *plenccodec.Optional[int], c fuzz.Continue) {
+			if c.RandBool() {
+				o.Set, o.Value = true, c.Int()
+			}
+		},
+	)
+	opts := []cmp.Option{
+		cmpopts.EquateEmpty(),
+		cmpopts.IgnoreUnexported(gentest.Thing{}),
+		cmpopts.IgnoreFields(gentest.Thing{}, "X"),
+		cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) }),
+	}
+
+	for range 1000 {
+		var in gentest.Thing
+		f.Fuzz(&in)
+
+		size, err := plenc.Size(&in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expSize, err := reflective.Size(&in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != expSize {
+			t.Fatalf("generated size %d does not match reflective size %d", size, expSize)
+		}
+
+		// Maps are encoded in an arbitrary order, so we check each way of
+		// encoding can be read by the other rather than comparing the data.
+		data, err := plenc.Marshal(nil, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != size {
+			t.Fatalf("marshalled %d bytes, expected %d", len(data), size)
+		}
+		var out gentest.Thing
+		if err := reflective.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in, out, opts...); diff != "" {
+			t.Fatal(diff)
+		}
+
+		data, err = reflective.Marshal(nil, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = gentest.Thing{}
+		if err := plenc.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in, out, opts...); diff != "" {
+			t.Fatal(diff)
+		}
+	}
+}
+
+func TestGeneratedCustomPlenc(t *testing.T) {
+	newPlenc := func(noGenerated bool) *plenc.Plenc {
+		var p plenc.Plenc
+		p.NoGeneratedCodecs = noGenerated
+		p.RegisterDefaultCodecs()
+		p.RegisterCodec(reflect.TypeFor[time.Time](), plenccodec.TimeCompatCodec{})
+		return &p
+	}
+	p, reflective := newPlenc(false), newPlenc(true)
+
+	// The generated methods encode time.Time with the default codec, so the
+	// custom Plenc must not use them.
+	c, err := p.CodecForType(reflect.TypeFor[gentest.Thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.(*plenccodec.StructCodec); !ok {
+		t.Fatalf("expected a struct codec, got %T", c)
+	}
+
+	in := gentest.Thing{A: 1, M: time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)}
+	data, err := p.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := reflective.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(exp, data); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// A Plenc with only the default codecs can use them.
+	var plain plenc.Plenc
+	plain.RegisterDefaultCodecs()
+	c, err = plain.CodecForType(reflect.TypeFor[gentest.Thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.(*plenccodec.GeneratedCodec); !ok {
+		t.Fatalf("expected a generated codec, got %T", c)
+	}
+}
+
+// prefixNameCodec writes gentest.Name values with an "X" prefix, so we can
+// tell whether it was used.
+type prefixNameCodec struct {
+	plenccodec.StringCodec
+}
+
+func (c prefixNameCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	s := "X" + *(*string)(ptr)
+	return c.StringCodec.Size(unsafe.Pointer(&s), tag)
+}
+
+func (c prefixNameCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	s := "X" + *(*string)(ptr)
+	return c.StringCodec.Append(data, unsafe.Pointer(&s), tag)
+}
+
+func (c prefixNameCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (int, error) {
+	n, err := c.StringCodec.Read(data, ptr, wt)
+	*(*string)(ptr) = strings.TrimPrefix(*(*string)(ptr), "X")
+	return n, err
+}
+
+func TestGeneratedCustomDefault(t *testing.T) {
+	// Registering a codec with the default Plenc affects every test, so we
+	// run this test in a separate process.
+	if os.Getenv("PLENC_TEST_CUSTOM_DEFAULT") == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestGeneratedCustomDefault$")
+		cmd.Env = append(os.Environ(), "PLENC_TEST_CUSTOM_DEFAULT=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+
+	plenc.RegisterCodec(reflect.TypeFor[gentest.Name](), prefixNameCodec{})
+
+	var reflective plenc.Plenc
+	reflective.NoGeneratedCodecs = true
+	reflective.RegisterDefaultCodecs()
+	reflective.RegisterCodec(reflect.TypeFor[gentest.Name](), prefixNameCodec{})
+
+	c, err := plenc.CodecForType(reflect.TypeFor[gentest.Thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.(*plenccodec.StructCodec); !ok {
+		t.Fatalf("expected a struct codec, got %T", c)
+	}
+
+	in := gentest.Thing{J: "abc"}
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := reflective.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(exp, data); diff != "" {
+		t.Fatal(diff)
+	}
+	if !bytes.Contains(data, []byte("Xabc")) {
+		t.Fatalf("custom codec not used. %q", data)
+	}
+}
+
+func TestGeneratedSkipsUnknown(t *testing.T) {
+	type newSub struct {
+		A int       `plenc:"1"`
+		B string    `plenc:"2"`
+		C []float64 `plenc:"3"`
+		D int       `plenc:"4"`
+		E float32   `plenc:"5"`
+	}
+
+	data, err := plenc.Marshal(nil, &newSub{A: 1, B: "b", C: []float64{1, 2}, D: -3, E: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out gentest.Sub
+	if err := out.PlencGeneratedUnmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(gentest.Sub{A: 1, B: "b"}, out); diff != "" {
+		t.Fatal(diff)
+	}
+
+	if err := out.PlencGeneratedUnmarshal(data[:len(data)-2]); err == nil {
+		t.Fatal("expected an error for truncated data")
+	}
+}
+
+func BenchmarkGenerated(b *testing.B) {
+	f := fuzz.NewWithSeed(1337).MaxDepth(4)
+	var in gentest.Thing
+	f.Fuzz(&in)
+
+	var reflective plenc.Plenc
+	reflective.NoGeneratedCodecs = true
+	reflective.RegisterDefaultCodecs()
+
+	for _, test := range []struct {
+		name string
+		p    *plenc.Plenc
+	}{
+		{name: "generated"},
+		{name: "reflection", p: &reflective},
+	} {
+		marshal, unmarshal := plenc.Marshal, plenc.Unmarshal
+		if test.p != nil {
+			marshal, unmarshal = test.p.Marshal, test.p.Unmarshal
+		}
+
+		b.Run(test.name+"/marshal", func(b *testing.B) {
+			b.ReportAllocs()
+			var data []byte
+			for b.Loop() {
+				var err error
+				data, err = marshal(data[:0], &in)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(test.name+"/unmarshal", func(b *testing.B) {
+			data, err := marshal(nil, &in)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				var out gentest.Thing
+				if err := unmarshal(data, &out); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,17 +1,21 @@
 module github.com/philpearl/plenc
 
-go 1.25
+go 1.25.0
 
 replace github.com/unravelin/null => github.com/unravelin/null/v5 v5.0.1
 
 require (
+	github.com/emicklei/proto v1.14.2
 	github.com/fatih/structtag v1.2.0
 	github.com/google/go-cmp v0.6.0
 	github.com/google/gofuzz v1.0.0
 	github.com/unravelin/null v1.0.2
+	golang.org/x/tools v0.47.0
 )
 
 require (
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/mailru/easyjson v0.9.0 // indirect
+	golang.org/x/mod v0.37.0 // indirect
+	golang.org/x/sync v0.21.0 // indirect
 )
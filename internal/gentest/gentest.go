@@ -0,0 +1,72 @@
+// Package gentest has types with codec methods written by plenccodegen. It's
+// used to test and benchmark the generated code against plenc's reflection
+// based codecs.
+package gentest
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+//go:generate go run ../../cmd/plenccodegen -type Thing,Sub
+
+type Colour int32
+
+type Name string
+
+// Percent is a percentage to 2 decimal places. It implements
+// plenccodec.DecimalAdapter, so the generated code must use its codec.
+type Percent int32
+
+func (p Percent) DecimalParts() (*big.Int, int32) {
+	return big.NewInt(int64(p)), -2
+}
+
+func (p *Percent) SetDecimalParts(coefficient *big.Int, exponent int32) error {
+	if exponent != -2 || !coefficient.IsInt64() {
+		return fmt.Errorf("unexpected percentage %se%d", coefficient, exponent)
+	}
+	*p = Percent(coefficient.Int64())
+	return nil
+}
+
+type Sub struct {
+	A int    `plenc:"1"`
+	B string `plenc:"2"`
+	C *Sub   `plenc:"20"`
+	D []Sub  `plenc:"21"`
+}
+
+type Thing struct {
+	A int                      `plenc:"1"`
+	B int32                    `plenc:"2,flat"`
+	C uint16                   `plenc:"3"`
+	D bool                     `plenc:"4"`
+	E float32                  `plenc:"5"`
+	F float64                  `plenc:"6"`
+	G string                   `plenc:"7"`
+	H []byte                   `plenc:"8"`
+	I Colour                   `plenc:"9"`
+	J Name                     `plenc:"10"`
+	K Sub                      `plenc:"11"`
+	L *Sub                     `plenc:"12"`
+	M time.Time                `plenc:"13"`
+	N []int                    `plenc:"14"`
+	O []string                 `plenc:"15"`
+	P map[string]int           `plenc:"16"`
+	Q []Sub                    `plenc:"17"`
+	R plenccodec.Optional[int] `plenc:"18"`
+	S int64                    `plenc:"19,fixed"`
+	T string                   `plenc:"20,intern"`
+	U *int                     `plenc:"21"`
+	V [3]int                   `plenc:"22"`
+	_ struct{}                 `plenc:"23,reserved"`
+	W int8                     `plenc:"24,flat"`
+	Y int64                    `plenc:"25,decimal=2"`
+	Z Percent                  `plenc:"26"`
+	X int                      `plenc:"-"`
+	y int
+}
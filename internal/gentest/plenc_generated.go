@@ -0,0 +1,531 @@
+// Code generated by plenccodegen. DO NOT EDIT.
+
+package gentest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+	"unsafe"
+
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+	"github.com/philpearl/plenc/plenccore"
+)
+
+var plencField_Thing_M = plenc.LazyGeneratedField(reflect.TypeFor[time.Time](), 13, "")
+
+var plencField_Thing_N = plenc.LazyGeneratedField(reflect.TypeFor[[]int](), 14, "")
+
+var plencField_Thing_O = plenc.LazyGeneratedField(reflect.TypeFor[[]string](), 15, "")
+
+var plencField_Thing_P = plenc.LazyGeneratedField(reflect.TypeFor[map[string]int](), 16, "")
+
+var plencField_Thing_Q = plenc.LazyGeneratedField(reflect.TypeFor[[]Sub](), 17, "")
+
+var plencField_Thing_R = plenc.LazyGeneratedField(reflect.TypeFor[plenccodec.Optional[int]](), 18, "")
+
+var plencField_Thing_S = plenc.LazyGeneratedField(reflect.TypeFor[int64](), 19, "fixed")
+
+var plencField_Thing_T = plenc.LazyGeneratedField(reflect.TypeFor[string](), 20, "intern")
+
+var plencField_Thing_U = plenc.LazyGeneratedField(reflect.TypeFor[*int](), 21, "")
+
+var plencField_Thing_V = plenc.LazyGeneratedField(reflect.TypeFor[[3]int](), 22, "")
+
+var plencField_Thing_Y = plenc.LazyGeneratedField(reflect.TypeFor[int64](), 25, "decimal=2")
+
+var plencField_Thing_Z = plenc.LazyGeneratedField(reflect.TypeFor[Percent](), 26, "")
+
+// PlencGeneratedSize returns the number of bytes needed to marshal v
+func (v *Thing) PlencGeneratedSize() (size int) {
+	if v.A != 0 {
+		size += 1 + plenccore.SizeVarInt(int64(v.A))
+	}
+	if v.B != 0 {
+		size += 1 + plenccore.SizeVarUint(uint64(uint32(v.B)))
+	}
+	if v.C != 0 {
+		size += 1 + plenccore.SizeVarUint(uint64(v.C))
+	}
+	if v.D {
+		size += 2
+	}
+	if v.E != 0 {
+		size += 5
+	}
+	if v.F != 0 {
+		size += 9
+	}
+	if l := len(v.G); l != 0 {
+		size += 1 + plenccore.SizeVarUint(uint64(l)) + l
+	}
+	if l := len(v.H); l != 0 {
+		size += 1 + plenccore.SizeVarUint(uint64(l)) + l
+	}
+	if v.I != 0 {
+		size += 1 + plenccore.SizeVarInt(int64(v.I))
+	}
+	if l := len(v.J); l != 0 {
+		size += 1 + plenccore.SizeVarUint(uint64(l)) + l
+	}
+	{
+		l := v.K.PlencGeneratedSize()
+		size += 1 + plenccore.SizeVarUint(uint64(l)) + l
+	}
+	if v.L != nil {
+		l := v.L.PlencGeneratedSize()
+		size += 1 + plenccore.SizeVarUint(uint64(l)) + l
+	}
+	if f, p := plencField_Thing_M(), unsafe.Pointer(&v.M); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	if f, p := plencField_Thing_N(), unsafe.Pointer(&v.N); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	if f, p := plencField_Thing_O(), unsafe.Pointer(&v.O); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	if f, p := plencField_Thing_P(), *(*unsafe.Pointer)(unsafe.Pointer(&v.P)); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	if f, p := plencField_Thing_Q(), unsafe.Pointer(&v.Q); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	if f, p := plencField_Thing_R(), unsafe.Pointer(&v.R); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	if f, p := plencField_Thing_S(), unsafe.Pointer(&v.S); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	if f, p := plencField_Thing_T(), unsafe.Pointer(&v.T); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	if f, p := plencField_Thing_U(), unsafe.Pointer(&v.U); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	if f, p := plencField_Thing_V(), unsafe.Pointer(&v.V); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	if v.W != 0 {
+		size += 2 + plenccore.SizeVarUint(uint64(uint8(v.W)))
+	}
+	if f, p := plencField_Thing_Y(), unsafe.Pointer(&v.Y); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	if f, p := plencField_Thing_Z(), unsafe.Pointer(&v.Z); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	return size
+}
+
+// PlencGeneratedMarshal appends the plenc encoding of v to data
+func (v *Thing) PlencGeneratedMarshal(data []byte) []byte {
+	if v.A != 0 {
+		data = append(data, 0x08)
+		data = plenccore.AppendVarInt(data, int64(v.A))
+	}
+	if v.B != 0 {
+		data = append(data, 0x10)
+		data = plenccore.AppendVarUint(data, uint64(uint32(v.B)))
+	}
+	if v.C != 0 {
+		data = append(data, 0x18)
+		data = plenccore.AppendVarUint(data, uint64(v.C))
+	}
+	if v.D {
+		data = append(data, 0x20, 1)
+	}
+	if v.E != 0 {
+		data = append(data, 0x2d)
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(v.E)))
+	}
+	if v.F != 0 {
+		data = append(data, 0x31)
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(float64(v.F)))
+	}
+	if len(v.G) != 0 {
+		data = append(data, 0x3a)
+		data = plenccore.AppendVarUint(data, uint64(len(v.G)))
+		data = append(data, v.G...)
+	}
+	if len(v.H) != 0 {
+		data = append(data, 0x42)
+		data = plenccore.AppendVarUint(data, uint64(len(v.H)))
+		data = append(data, v.H...)
+	}
+	if v.I != 0 {
+		data = append(data, 0x48)
+		data = plenccore.AppendVarInt(data, int64(v.I))
+	}
+	if len(v.J) != 0 {
+		data = append(data, 0x52)
+		data = plenccore.AppendVarUint(data, uint64(len(v.J)))
+		data = append(data, v.J...)
+	}
+	data = append(data, 0x5a)
+	data = plenccore.AppendVarUint(data, uint64(v.K.PlencGeneratedSize()))
+	data = v.K.PlencGeneratedMarshal(data)
+	if v.L != nil {
+		data = append(data, 0x62)
+		data = plenccore.AppendVarUint(data, uint64(v.L.PlencGeneratedSize()))
+		data = v.L.PlencGeneratedMarshal(data)
+	}
+	if f, p := plencField_Thing_M(), unsafe.Pointer(&v.M); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	if f, p := plencField_Thing_N(), unsafe.Pointer(&v.N); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	if f, p := plencField_Thing_O(), unsafe.Pointer(&v.O); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	if f, p := plencField_Thing_P(), *(*unsafe.Pointer)(unsafe.Pointer(&v.P)); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	if f, p := plencField_Thing_Q(), unsafe.Pointer(&v.Q); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	if f, p := plencField_Thing_R(), unsafe.Pointer(&v.R); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	if f, p := plencField_Thing_S(), unsafe.Pointer(&v.S); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	if f, p := plencField_Thing_T(), unsafe.Pointer(&v.T); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	if f, p := plencField_Thing_U(), unsafe.Pointer(&v.U); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	if f, p := plencField_Thing_V(), unsafe.Pointer(&v.V); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	if v.W != 0 {
+		data = append(data, 0xc0, 0x01)
+		data = plenccore.AppendVarUint(data, uint64(uint8(v.W)))
+	}
+	if f, p := plencField_Thing_Y(), unsafe.Pointer(&v.Y); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	if f, p := plencField_Thing_Z(), unsafe.Pointer(&v.Z); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	return data
+}
+
+// PlencGeneratedUnmarshal decodes plenc data into v
+func (v *Thing) PlencGeneratedUnmarshal(data []byte) error {
+	l := len(data)
+	var offset int
+	for offset < l {
+		wt, index, n := plenccore.ReadTag(data[offset:])
+		if n <= 0 || n > l-offset {
+			return fmt.Errorf("failed to read tag in Thing")
+		}
+		offset += n
+
+		fl := l
+		if wt == plenccore.WTLength {
+			// For WTLength types we read out the length and ensure the data we
+			// read the field from is the right length
+			x, n := plenccore.ReadVarUint(data[offset:])
+			if n <= 0 || n > l-offset {
+				return fmt.Errorf("varuint overflow reading field %d of Thing", index)
+			}
+			offset += n
+			fl = int(x) + offset
+			if fl > l || fl < 0 {
+				return fmt.Errorf("length %d of field %d of Thing exceeds data length", fl, index)
+			}
+		}
+
+		switch index {
+		case 1:
+			x, n := plenccore.ReadVarInt(data[offset:fl])
+			if n < 0 {
+				return fmt.Errorf("failed reading field 1 of Thing. corrupt var int")
+			}
+			v.A = int(x)
+			offset += n
+		case 2:
+			x, n := plenccore.ReadVarUint(data[offset:fl])
+			if n < 0 {
+				return fmt.Errorf("failed reading field 2 of Thing. corrupt var int")
+			}
+			v.B = int32(uint32(x))
+			offset += n
+		case 3:
+			x, n := plenccore.ReadVarUint(data[offset:fl])
+			if n < 0 {
+				return fmt.Errorf("failed reading field 3 of Thing. corrupt var int")
+			}
+			v.C = uint16(x)
+			offset += n
+		case 4:
+			x, n := plenccore.ReadVarUint(data[offset:fl])
+			if n < 0 {
+				return fmt.Errorf("failed reading field 4 of Thing. corrupt var int")
+			}
+			v.D = x != 0
+			offset += n
+		case 5:
+			if fl-offset < 4 {
+				if fl-offset != 0 {
+					return fmt.Errorf("failed reading field 5 of Thing. not enough data to read a float32. Have %d bytes", fl-offset)
+				}
+				v.E = 0
+				break
+			}
+			v.E = math.Float32frombits(binary.LittleEndian.Uint32(data[offset:]))
+			offset += 4
+		case 6:
+			if fl-offset < 8 {
+				if fl-offset != 0 {
+					return fmt.Errorf("failed reading field 6 of Thing. not enough data to read a float64. Have %d bytes", fl-offset)
+				}
+				v.F = 0
+				break
+			}
+			v.F = math.Float64frombits(binary.LittleEndian.Uint64(data[offset:]))
+			offset += 8
+		case 7:
+			v.G = string(data[offset:fl])
+			offset = fl
+		case 8:
+			v.H = append([]byte(nil), data[offset:fl]...)
+			offset = fl
+		case 9:
+			x, n := plenccore.ReadVarInt(data[offset:fl])
+			if n < 0 {
+				return fmt.Errorf("failed reading field 9 of Thing. corrupt var int")
+			}
+			v.I = Colour(x)
+			offset += n
+		case 10:
+			v.J = Name(data[offset:fl])
+			offset = fl
+		case 11:
+			if err := v.K.PlencGeneratedUnmarshal(data[offset:fl]); err != nil {
+				return fmt.Errorf("failed reading field 11 of Thing. %w", err)
+			}
+			offset = fl
+		case 12:
+			if v.L == nil {
+				v.L = new(Sub)
+			}
+			if err := v.L.PlencGeneratedUnmarshal(data[offset:fl]); err != nil {
+				return fmt.Errorf("failed reading field 12 of Thing. %w", err)
+			}
+			offset = fl
+		case 13:
+			n, err := plencField_Thing_M().Read(data[offset:fl], unsafe.Pointer(&v.M), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 13 of Thing. %w", err)
+			}
+			offset += n
+		case 14:
+			n, err := plencField_Thing_N().Read(data[offset:fl], unsafe.Pointer(&v.N), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 14 of Thing. %w", err)
+			}
+			offset += n
+		case 15:
+			n, err := plencField_Thing_O().Read(data[offset:fl], unsafe.Pointer(&v.O), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 15 of Thing. %w", err)
+			}
+			offset += n
+		case 16:
+			n, err := plencField_Thing_P().Read(data[offset:fl], unsafe.Pointer(&v.P), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 16 of Thing. %w", err)
+			}
+			offset += n
+		case 17:
+			n, err := plencField_Thing_Q().Read(data[offset:fl], unsafe.Pointer(&v.Q), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 17 of Thing. %w", err)
+			}
+			offset += n
+		case 18:
+			n, err := plencField_Thing_R().Read(data[offset:fl], unsafe.Pointer(&v.R), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 18 of Thing. %w", err)
+			}
+			offset += n
+		case 19:
+			n, err := plencField_Thing_S().Read(data[offset:fl], unsafe.Pointer(&v.S), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 19 of Thing. %w", err)
+			}
+			offset += n
+		case 20:
+			n, err := plencField_Thing_T().Read(data[offset:fl], unsafe.Pointer(&v.T), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 20 of Thing. %w", err)
+			}
+			offset += n
+		case 21:
+			n, err := plencField_Thing_U().Read(data[offset:fl], unsafe.Pointer(&v.U), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 21 of Thing. %w", err)
+			}
+			offset += n
+		case 22:
+			n, err := plencField_Thing_V().Read(data[offset:fl], unsafe.Pointer(&v.V), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 22 of Thing. %w", err)
+			}
+			offset += n
+		case 24:
+			x, n := plenccore.ReadVarUint(data[offset:fl])
+			if n < 0 {
+				return fmt.Errorf("failed reading field 24 of Thing. corrupt var int")
+			}
+			v.W = int8(uint8(x))
+			offset += n
+		case 25:
+			n, err := plencField_Thing_Y().Read(data[offset:fl], unsafe.Pointer(&v.Y), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 25 of Thing. %w", err)
+			}
+			offset += n
+		case 26:
+			n, err := plencField_Thing_Z().Read(data[offset:fl], unsafe.Pointer(&v.Z), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 26 of Thing. %w", err)
+			}
+			offset += n
+		default:
+			// Field corresponding to index does not exist
+			if wt == plenccore.WTLength {
+				offset = fl
+				continue
+			}
+			n, err := plenccore.Skip(data[offset:], wt)
+			if err != nil {
+				return fmt.Errorf("failed to skip field %d in Thing. %w", index, err)
+			}
+			if n < 0 || n > l-offset {
+				return fmt.Errorf("failed to skip field %d in Thing", index)
+			}
+			offset += n
+		}
+	}
+	return nil
+}
+
+var plencField_Sub_D = plenc.LazyGeneratedField(reflect.TypeFor[[]Sub](), 21, "")
+
+// PlencGeneratedSize returns the number of bytes needed to marshal v
+func (v *Sub) PlencGeneratedSize() (size int) {
+	if v.A != 0 {
+		size += 1 + plenccore.SizeVarInt(int64(v.A))
+	}
+	if l := len(v.B); l != 0 {
+		size += 1 + plenccore.SizeVarUint(uint64(l)) + l
+	}
+	if v.C != nil {
+		l := v.C.PlencGeneratedSize()
+		size += 2 + plenccore.SizeVarUint(uint64(l)) + l
+	}
+	if f, p := plencField_Sub_D(), unsafe.Pointer(&v.D); !f.Omit(p) {
+		size += f.Size(p, f.Tag)
+	}
+	return size
+}
+
+// PlencGeneratedMarshal appends the plenc encoding of v to data
+func (v *Sub) PlencGeneratedMarshal(data []byte) []byte {
+	if v.A != 0 {
+		data = append(data, 0x08)
+		data = plenccore.AppendVarInt(data, int64(v.A))
+	}
+	if len(v.B) != 0 {
+		data = append(data, 0x12)
+		data = plenccore.AppendVarUint(data, uint64(len(v.B)))
+		data = append(data, v.B...)
+	}
+	if v.C != nil {
+		data = append(data, 0xa2, 0x01)
+		data = plenccore.AppendVarUint(data, uint64(v.C.PlencGeneratedSize()))
+		data = v.C.PlencGeneratedMarshal(data)
+	}
+	if f, p := plencField_Sub_D(), unsafe.Pointer(&v.D); !f.Omit(p) {
+		data = f.Append(data, p, f.Tag)
+	}
+	return data
+}
+
+// PlencGeneratedUnmarshal decodes plenc data into v
+func (v *Sub) PlencGeneratedUnmarshal(data []byte) error {
+	l := len(data)
+	var offset int
+	for offset < l {
+		wt, index, n := plenccore.ReadTag(data[offset:])
+		if n <= 0 || n > l-offset {
+			return fmt.Errorf("failed to read tag in Sub")
+		}
+		offset += n
+
+		fl := l
+		if wt == plenccore.WTLength {
+			// For WTLength types we read out the length and ensure the data we
+			// read the field from is the right length
+			x, n := plenccore.ReadVarUint(data[offset:])
+			if n <= 0 || n > l-offset {
+				return fmt.Errorf("varuint overflow reading field %d of Sub", index)
+			}
+			offset += n
+			fl = int(x) + offset
+			if fl > l || fl < 0 {
+				return fmt.Errorf("length %d of field %d of Sub exceeds data length", fl, index)
+			}
+		}
+
+		switch index {
+		case 1:
+			x, n := plenccore.ReadVarInt(data[offset:fl])
+			if n < 0 {
+				return fmt.Errorf("failed reading field 1 of Sub. corrupt var int")
+			}
+			v.A = int(x)
+			offset += n
+		case 2:
+			v.B = string(data[offset:fl])
+			offset = fl
+		case 20:
+			if v.C == nil {
+				v.C = new(Sub)
+			}
+			if err := v.C.PlencGeneratedUnmarshal(data[offset:fl]); err != nil {
+				return fmt.Errorf("failed reading field 20 of Sub. %w", err)
+			}
+			offset = fl
+		case 21:
+			n, err := plencField_Sub_D().Read(data[offset:fl], unsafe.Pointer(&v.D), wt)
+			if err != nil {
+				return fmt.Errorf("failed reading field 21 of Sub. %w", err)
+			}
+			offset += n
+		default:
+			// Field corresponding to index does not exist
+			if wt == plenccore.WTLength {
+				offset = fl
+				continue
+			}
+			n, err := plenccore.Skip(data[offset:], wt)
+			if err != nil {
+				return fmt.Errorf("failed to skip field %d in Sub. %w", index, err)
+			}
+			if n < 0 || n > l-offset {
+				return fmt.Errorf("failed to skip field %d in Sub", index)
+			}
+			offset += n
+		}
+	}
+	return nil
+}
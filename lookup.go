@@ -0,0 +1,154 @@
+package plenc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// ErrNotFound is returned by Lookup if the data does not contain the requested
+// field.
+var ErrNotFound = errors.New("field not found")
+
+// Lookup finds a single field within encoded data without decoding the rest of
+// the message. path is a list of field indexes: the first selects a field of
+// the top-level struct, the next a field within that field, and so on. All
+// fields on the path except the last must be structs.
+//
+// Lookup returns the encoded field value and its wire type. For WTLength fields
+// the tag and length are not included. It returns ErrNotFound if any field on
+// the path is not present. Note that fields with zero values are not written,
+// so they are not found either.
+//
+// Data written with ProtoCompatibleArrays set writes each entry of a repeated
+// field or map as a separate field with the same index. Lookup returns an error
+// if the field occurs more than once. Use UnmarshalPath to decode these fields.
+func Lookup(data []byte, path ...int) ([]byte, plenccore.WireType, error) {
+	fields, wt, err := lookup(data, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(fields) > 1 {
+		return nil, 0, fmt.Errorf("field %d at depth %d occurs %d times", path[len(path)-1], len(path)-1, len(fields))
+	}
+	return fields[0], wt, nil
+}
+
+// lookup finds every occurrence of the field at path in data. If a struct on
+// the path occurs more than once the field is collected from each occurrence
+// in turn.
+func lookup(data []byte, path []int) ([][]byte, plenccore.WireType, error) {
+	if len(path) == 0 {
+		return nil, 0, fmt.Errorf("path must not be empty")
+	}
+
+	fields := [][]byte{data}
+	var wt plenccore.WireType
+	for i, index := range path {
+		if i > 0 && wt != plenccore.WTLength {
+			return nil, 0, fmt.Errorf("field %d at depth %d has wire type %d, so cannot contain field %d", path[i-1], i-1, wt, index)
+		}
+		var found [][]byte
+		for _, data := range fields {
+			var err error
+			found, wt, err = lookupField(found, wt, data, index)
+			if err != nil {
+				return nil, 0, fmt.Errorf("looking for field %d at depth %d. %w", index, i, err)
+			}
+		}
+		if len(found) == 0 {
+			return nil, 0, fmt.Errorf("looking for field %d at depth %d. %w", index, i, ErrNotFound)
+		}
+		fields = found
+	}
+	return fields, wt, nil
+}
+
+// lookupField appends every field with the given index in data, which holds
+// the encoded fields of a struct, to fields. wt is the wire type of the fields
+// already found. All the fields must have the same wire type.
+func lookupField(fields [][]byte, wt plenccore.WireType, data []byte, index int) ([][]byte, plenccore.WireType, error) {
+	l := len(data)
+	var offset int
+	for offset < l {
+		fieldWT, fieldIndex, n := plenccore.ReadTag(data[offset:])
+		if n <= 0 {
+			return nil, 0, fmt.Errorf("failed to read tag")
+		}
+		offset += n
+
+		start := offset
+		if fieldWT == plenccore.WTLength {
+			_, n := plenccore.ReadVarUint(data[offset:])
+			if n <= 0 {
+				return nil, 0, fmt.Errorf("varuint overflow reading length of field %d", fieldIndex)
+			}
+			start += n
+		}
+
+		n, err := plenccore.Skip(data[offset:], fieldWT)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to skip field %d. %w", fieldIndex, err)
+		}
+		if n < 0 || n > l-offset {
+			return nil, 0, fmt.Errorf("field %d exceeds data length", fieldIndex)
+		}
+		offset += n
+
+		if fieldIndex == index {
+			if len(fields) > 0 && fieldWT != wt {
+				return nil, 0, fmt.Errorf("field %d has wire types %d and %d", fieldIndex, wt, fieldWT)
+			}
+			fields = append(fields, data[start:offset])
+			wt = fieldWT
+		}
+	}
+
+	return fields, wt, nil
+}
+
+// UnmarshalPath decodes a single field within data into value, without decoding
+// the rest of the message. See Lookup for a description of path. value must be a
+// non-nil pointer to a type compatible with the field. If the field is not
+// present value is left unchanged, just as Unmarshal leaves fields unchanged if
+// they are not present. If the field occurs more than once UnmarshalPath
+// decodes every occurrence, so repeated fields and maps written with
+// ProtoCompatibleArrays are complete.
+func UnmarshalPath(data []byte, path []int, value any) error {
+	return defaultPlenc.UnmarshalPath(data, path, value)
+}
+
+// UnmarshalPath decodes a single field within data into value. See
+// UnmarshalPath.
+func (p *Plenc) UnmarshalPath(data []byte, path []int, value any) error {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("you must pass in a non-nil pointer")
+	}
+
+	c, err := p.CodecForType(rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	fields, wt, err := lookup(data, path)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Fields that occur more than once are read in turn, just as Unmarshal
+	// reads them. Repeated fields are appended, and for other fields the last
+	// value wins.
+	for _, field := range fields {
+		if _, err := c.Read(field, unsafe.Pointer(rv.Pointer()), wt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
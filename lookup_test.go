@@ -0,0 +1,262 @@
+package plenc_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccore"
+)
+
+type lookupInner struct {
+	Key   string  `plenc:"1"`
+	Value float64 `plenc:"2"`
+}
+
+type lookupOuter struct {
+	ID     int           `plenc:"1"`
+	Names  []string      `plenc:"2"`
+	Inner  lookupInner   `plenc:"3"`
+	Inners []lookupInner `plenc:"4"`
+	Ptr    *lookupInner  `plenc:"5"`
+	Count  uint32        `plenc:"6,fixed"`
+}
+
+func TestLookup(t *testing.T) {
+	in := lookupOuter{
+		ID:     -7,
+		Names:  []string{"a", "b"},
+		Inner:  lookupInner{Key: "key", Value: 1.5},
+		Inners: []lookupInner{{Key: "x"}, {Key: "y"}},
+		Ptr:    &lookupInner{Key: "ptr"},
+		Count:  12,
+	}
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("int", func(t *testing.T) {
+		var v int
+		if err := plenc.UnmarshalPath(data, []int{1}, &v); err != nil {
+			t.Fatal(err)
+		}
+		if v != -7 {
+			t.Fatalf("got %d", v)
+		}
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		var v string
+		if err := plenc.UnmarshalPath(data, []int{3, 1}, &v); err != nil {
+			t.Fatal(err)
+		}
+		if v != "key" {
+			t.Fatalf("got %q", v)
+		}
+	})
+
+	t.Run("pointer", func(t *testing.T) {
+		var v string
+		if err := plenc.UnmarshalPath(data, []int{5, 1}, &v); err != nil {
+			t.Fatal(err)
+		}
+		if v != "ptr" {
+			t.Fatalf("got %q", v)
+		}
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		var v lookupInner
+		if err := plenc.UnmarshalPath(data, []int{3}, &v); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in.Inner, v); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("slices", func(t *testing.T) {
+		var names []string
+		if err := plenc.UnmarshalPath(data, []int{2}, &names); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in.Names, names); diff != "" {
+			t.Fatal(diff)
+		}
+		var inners []lookupInner
+		if err := plenc.UnmarshalPath(data, []int{4}, &inners); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in.Inners, inners); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("fixed", func(t *testing.T) {
+		field, wt, err := plenc.Lookup(data, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wt != plenccore.WT32 {
+			t.Fatalf("wire type %d", wt)
+		}
+		if diff := cmp.Diff([]byte{12, 0, 0, 0}, field); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, _, err := plenc.Lookup(data, 3, 7); !errors.Is(err, plenc.ErrNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+		if _, _, err := plenc.Lookup(data, 8, 1); !errors.Is(err, plenc.ErrNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+
+		v := "unchanged"
+		if err := plenc.UnmarshalPath(data, []int{3, 7}, &v); err != nil {
+			t.Fatal(err)
+		}
+		if v != "unchanged" {
+			t.Fatalf("got %q", v)
+		}
+	})
+
+	t.Run("not a struct", func(t *testing.T) {
+		_, _, err := plenc.Lookup(data, 1, 1)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if exp := "field 1 at depth 0 has wire type 0, so cannot contain field 1"; err.Error() != exp {
+			t.Fatalf("error %q not as expected", err)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		if _, _, err := plenc.Lookup(data[:len(data)-2], 6); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestLookupRepeated(t *testing.T) {
+	var p plenc.Plenc
+	p.ProtoCompatibleArrays = true
+	p.RegisterDefaultCodecs()
+
+	type repeated struct {
+		Names  []string          `plenc:"1"`
+		Inners []lookupInner     `plenc:"2"`
+		Labels map[string]string `plenc:"3"`
+		Counts []int32           `plenc:"4"`
+	}
+
+	in := repeated{
+		Names:  []string{"a", "b", "c"},
+		Inners: []lookupInner{{Key: "x", Value: 1}, {Key: "y"}},
+		Labels: map[string]string{"k1": "v1", "k2": "v2"},
+		Counts: []int32{1, 2, 3},
+	}
+	data, err := p.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("strings", func(t *testing.T) {
+		var names []string
+		if err := p.UnmarshalPath(data, []int{1}, &names); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in.Names, names); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("structs", func(t *testing.T) {
+		var inners []lookupInner
+		if err := p.UnmarshalPath(data, []int{2}, &inners); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in.Inners, inners); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("map", func(t *testing.T) {
+		var labels map[string]string
+		if err := p.UnmarshalPath(data, []int{3}, &labels); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in.Labels, labels); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("packed", func(t *testing.T) {
+		var counts []int32
+		if err := p.UnmarshalPath(data, []int{4}, &counts); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in.Counts, counts); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("last wins", func(t *testing.T) {
+		// Reading a field within a repeated struct into a scalar gives the
+		// last value, as protobuf does for repeated scalars.
+		var key string
+		if err := p.UnmarshalPath(data, []int{2, 1}, &key); err != nil {
+			t.Fatal(err)
+		}
+		if key != "y" {
+			t.Fatalf("got %q", key)
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		_, _, err := plenc.Lookup(data, 1)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if exp := "field 1 at depth 0 occurs 3 times"; err.Error() != exp {
+			t.Fatalf("error %q not as expected", err)
+		}
+	})
+}
+
+func BenchmarkLookup(b *testing.B) {
+	in := lookupOuter{
+		ID:     -7,
+		Names:  []string{"a", "b", "c", "d"},
+		Inner:  lookupInner{Key: "key", Value: 1.5},
+		Inners: []lookupInner{{Key: "x"}, {Key: "y"}},
+		Ptr:    &lookupInner{Key: "ptr"},
+	}
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("path", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var v string
+			if err := plenc.UnmarshalPath(data, []int{5, 1}, &v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("full", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var v lookupOuter
+			if err := plenc.Unmarshal(data, &v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
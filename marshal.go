@@ -49,7 +49,8 @@ func (p *Plenc) preamble(value any) (unsafe.Pointer, plenccodec.Codec, error) {
 	return ptr, c, nil
 }
 
-func (p *Plenc) Marshal(data []byte, value any) ([]byte, error) {
+func (p *Plenc) Marshal(data []byte, value any) (_ []byte, err error) {
+	defer recoverEncodeError(&err)
 	ptr, c, err := p.preamble(value)
 	if err != nil {
 		return nil, err
@@ -80,7 +81,8 @@ func (p *Plenc) Unmarshal(data []byte, value any) error {
 	return err
 }
 
-func (p *Plenc) Size(value any) (int, error) {
+func (p *Plenc) Size(value any) (_ int, err error) {
+	defer recoverEncodeError(&err)
 	ptr, c, err := p.preamble(value)
 	if err != nil {
 		return 0, err
@@ -92,3 +94,17 @@ func (p *Plenc) Size(value any) (int, error) {
 
 	return c.Size(ptr, nil), nil
 }
+
+// recoverEncodeError recovers a plenccodec.EncodeError panic raised by a codec
+// and sets err. Other panics are not recovered.
+func recoverEncodeError(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	ee, ok := r.(plenccodec.EncodeError)
+	if !ok {
+		panic(r)
+	}
+	*err = ee.Err
+}
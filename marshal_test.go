@@ -3,6 +3,7 @@ package plenc
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -88,6 +89,39 @@ type TestThing struct {
 	R1 RecursiveThing `plenc:"53"`
 }
 
+// TestRecursiveCodecCache checks that codecs built for a recursive type are
+// cached unless they contain the recursive reference.
+func TestRecursiveCodecCache(t *testing.T) {
+	type leaf struct {
+		A int `plenc:"1"`
+	}
+	type node struct {
+		A []node `plenc:"1"`
+		B []leaf `plenc:"2"`
+		C *node  `plenc:"3"`
+		D *leaf  `plenc:"4"`
+	}
+
+	var p Plenc
+	p.RegisterDefaultCodecs()
+	if _, err := p.CodecForType(reflect.TypeFor[node]()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, typ := range []reflect.Type{
+		reflect.TypeFor[node](), reflect.TypeFor[[]leaf](), reflect.TypeFor[leaf](), reflect.TypeFor[*leaf](),
+	} {
+		if p.codecRegistry.Load(typ, "") == nil {
+			t.Errorf("codec for %s not cached", typ)
+		}
+	}
+	for _, typ := range []reflect.Type{reflect.TypeFor[[]node](), reflect.TypeFor[*node]()} {
+		if p.codecRegistry.Load(typ, "") != nil {
+			t.Errorf("codec for %s containing a reference is cached", typ)
+		}
+	}
+}
+
 func TestMarshalNil(t *testing.T) {
 	var in *TestThing
 	data, err := Marshal(nil, in)
@@ -330,6 +364,41 @@ func TestMarshalDuplicate(t *testing.T) {
 	}
 }
 
+func TestMarshalReserved(t *testing.T) {
+	type reserved struct {
+		A string   `plenc:"1"`
+		_ struct{} `plenc:"2,reserved"`
+		C int      `plenc:"3"`
+	}
+
+	in := reserved{A: "a", C: 3}
+	data, err := Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out reserved
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out, cmpopts.IgnoreUnexported(reserved{})); diff != "" {
+		t.Fatal(diff)
+	}
+
+	type reuse struct {
+		A string   `plenc:"1"`
+		_ struct{} `plenc:"2,reserved"`
+		B *string  `plenc:"2"`
+	}
+
+	_, err = Marshal(nil, &reuse{})
+	if err == nil {
+		t.Errorf("expected an error as a field uses a reserved index")
+	}
+	if err.Error() != "failed building codec for reuse. Field B uses reserved index 2" {
+		t.Errorf("error %q not as expected", err)
+	}
+}
+
 func TestMarshalComplex(t *testing.T) {
 	type my struct {
 		A complex64 `plenc:"1"`
@@ -405,6 +474,27 @@ func BenchmarkCycle(b *testing.B) {
 		})
 	})
 
+	b.Run("plenc zerocopy", func(b *testing.B) {
+		var p Plenc
+		p.ZeroCopy = true
+		p.RegisterDefaultCodecs()
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			var data []byte
+			for pb.Next() {
+				var err error
+				data, err = p.Marshal(data[:0], &in)
+				if err != nil {
+					b.Fatal(err)
+				}
+				var out TestThing
+				if err := p.Unmarshal(data, &out); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+
 	b.Run("json", func(b *testing.B) {
 		b.ReportAllocs()
 		b.RunParallel(func(pb *testing.PB) {
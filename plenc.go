@@ -1,7 +1,11 @@
 package plenc
 
 import (
+	"math/big"
+	"net/netip"
+	"net/url"
 	"reflect"
+	"sync/atomic"
 	"time"
 
 	"github.com/philpearl/plenc/plenccodec"
@@ -24,22 +28,66 @@ type Plenc struct {
 	// protobuf. If not true it uses a format that allows arrays to be read more
 	// efficiently. Set it before calling RegisterDefaultCodecs.
 	ProtoCompatibleArrays bool
+	// ZeroCopy makes Unmarshal set string and []byte fields to point directly
+	// into the data being unmarshalled rather than copying it. This saves
+	// allocations, but is unsafe if the data is modified or re-used while the
+	// decoded values are in use. Set it before calling RegisterDefaultCodecs.
+	ZeroCopy bool
+	// NoGeneratedCodecs stops plenc using the codec methods written by
+	// cmd/plenccodegen, so types are always encoded via reflection. Generated
+	// methods encode fields with the codecs of the default Plenc, so they are
+	// also ignored if ProtoCompatibleTime, ProtoCompatibleArrays, ZeroCopy or
+	// EncodingFallback is set, or if this Plenc or the default Plenc has
+	// codecs or unions registered beyond the default codecs.
+	NoGeneratedCodecs bool
+	// EncodingFallback makes plenc encode types that have no registered codec
+	// but implement encoding.BinaryMarshaler and encoding.BinaryUnmarshaler,
+	// or failing that encoding.TextMarshaler and encoding.TextUnmarshaler,
+	// using those methods. Without it a field must have the binary or text
+	// option on its plenc tag to be encoded this way.
+	EncodingFallback bool
 
 	codecRegistry baseRegistry
+	unionRegistry unionRegistry
+	// customised is set if codecs other than the default codecs or unions
+	// have been registered.
+	customised atomic.Bool
 }
 
 func (p *Plenc) RegisterCodec(typ reflect.Type, c plenccodec.Codec) {
 	p.codecRegistry.Store(typ, "", c)
+	p.customised.Store(true)
 }
 
 func (p *Plenc) RegisterCodecWithTag(typ reflect.Type, tag string, c plenccodec.Codec) {
 	p.codecRegistry.Store(typ, tag, c)
+	p.customised.Store(true)
+}
+
+// RegisterUnion registers the set of concrete types that may be held in fields
+// of the interface type iface. Fields of this interface type are encoded as a
+// tagged union, with the index of each member identifying the concrete type.
+// This is like a protobuf oneof. The indexes must be unique and should not be
+// changed once data has been written.
+//
+// Register unions before marshaling or unmarshaling any type that uses them.
+//
+//	p.RegisterUnion(reflect.TypeFor[Event](),
+//		plenccodec.UnionMember{Index: 1, Type: reflect.TypeFor[Click]()},
+//		plenccodec.UnionMember{Index: 2, Type: reflect.TypeFor[*Scroll]()},
+//	)
+func (p *Plenc) RegisterUnion(iface reflect.Type, members ...plenccodec.UnionMember) {
+	p.unionRegistry.Store(iface, members)
+	p.customised.Store(true)
 }
 
 // RegisterDefaultCodecs sets up the default codecs for plenc. It is called
 // automatically for the default plenc instance, but if you create your own
 // instance of Plenc you should call this before using it.
 func (p *Plenc) RegisterDefaultCodecs() {
+	// Registering the default codecs doesn't customise the Plenc.
+	defer p.customised.Store(p.customised.Load())
+
 	p.RegisterCodec(reflect.TypeFor[bool](), plenccodec.BoolCodec{})
 
 	p.RegisterCodec(reflect.TypeFor[float64](), plenccodec.Float64Codec{})
@@ -57,17 +105,44 @@ func (p *Plenc) RegisterDefaultCodecs() {
 	p.RegisterCodecWithTag(reflect.TypeFor[int32](), "flat", plenccodec.FlatIntCodec[uint32]{})
 	p.RegisterCodecWithTag(reflect.TypeFor[int64](), "flat", plenccodec.FlatIntCodec[uint64]{})
 
+	p.RegisterCodecWithTag(reflect.TypeFor[int](), "flatelems", plenccodec.ProtoIntCodec[int]{})
+	p.RegisterCodecWithTag(reflect.TypeFor[int8](), "flatelems", plenccodec.ProtoIntCodec[int8]{})
+	p.RegisterCodecWithTag(reflect.TypeFor[int16](), "flatelems", plenccodec.ProtoIntCodec[int16]{})
+	p.RegisterCodecWithTag(reflect.TypeFor[int32](), "flatelems", plenccodec.ProtoIntCodec[int32]{})
+	p.RegisterCodecWithTag(reflect.TypeFor[int64](), "flatelems", plenccodec.ProtoIntCodec[int64]{})
+
+	p.RegisterCodecWithTag(reflect.TypeFor[int](), "fixed", plenccodec.SFixed64Codec[int]{})
+	p.RegisterCodecWithTag(reflect.TypeFor[int32](), "fixed", plenccodec.SFixed32Codec[int32]{})
+	p.RegisterCodecWithTag(reflect.TypeFor[int64](), "fixed", plenccodec.SFixed64Codec[int64]{})
+
 	p.RegisterCodec(reflect.TypeFor[uint](), plenccodec.UintCodec[uint]{})
 	p.RegisterCodec(reflect.TypeFor[uint64](), plenccodec.UintCodec[uint64]{})
 	p.RegisterCodec(reflect.TypeFor[uint32](), plenccodec.UintCodec[uint32]{})
 	p.RegisterCodec(reflect.TypeFor[uint16](), plenccodec.UintCodec[uint16]{})
 	p.RegisterCodec(reflect.TypeFor[uint8](), plenccodec.UintCodec[uint8]{})
-	p.RegisterCodec(reflect.TypeFor[string](), plenccodec.StringCodec{})
+
+	p.RegisterCodecWithTag(reflect.TypeFor[uint](), "fixed", plenccodec.Fixed64Codec[uint]{})
+	p.RegisterCodecWithTag(reflect.TypeFor[uint32](), "fixed", plenccodec.Fixed32Codec[uint32]{})
+	p.RegisterCodecWithTag(reflect.TypeFor[uint64](), "fixed", plenccodec.Fixed64Codec[uint64]{})
+
+	if p.ZeroCopy {
+		p.RegisterCodec(reflect.TypeFor[string](), plenccodec.ZeroCopyStringCodec{})
+		p.RegisterCodec(reflect.TypeFor[[]byte](), plenccodec.ZeroCopyBytesCodec{})
+	} else {
+		p.RegisterCodec(reflect.TypeFor[string](), plenccodec.StringCodec{})
+		p.RegisterCodec(reflect.TypeFor[[]byte](), plenccodec.BytesCodec{})
+	}
 	p.RegisterCodecWithTag(reflect.TypeFor[string](), "intern", &plenccodec.InternedStringCodec{})
-	p.RegisterCodec(reflect.TypeFor[[]byte](), plenccodec.BytesCodec{})
 	if p.ProtoCompatibleTime {
 		p.RegisterCodec(reflect.TypeFor[time.Time](), plenccodec.TimeCompatCodec{})
 	} else {
 		p.RegisterCodec(reflect.TypeFor[time.Time](), plenccodec.TimeCodec{})
 	}
+	p.RegisterCodec(reflect.TypeFor[time.Duration](), plenccodec.DurationCodec{})
+
+	p.RegisterCodec(reflect.TypeFor[netip.Addr](), plenccodec.IPAddrCodec{})
+	p.RegisterCodec(reflect.TypeFor[netip.Prefix](), plenccodec.IPPrefixCodec{})
+	p.RegisterCodec(reflect.TypeFor[big.Int](), plenccodec.BigIntCodec{})
+	p.RegisterCodec(reflect.TypeFor[big.Rat](), plenccodec.BigRatCodec{})
+	p.RegisterCodec(reflect.TypeFor[url.URL](), plenccodec.URLCodec{})
 }
@@ -0,0 +1,136 @@
+package plenccodec
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// ArrayWrapper is a codec for fixed-size arrays. The array is presented to an
+// underlying slice codec (one of the BaseSliceWrapper family) as a slice whose
+// backing store is the array itself, so arrays have exactly the same encoding
+// as slices.
+//
+// Arrays of WTLength types are always written with the WTSlice encoding. We
+// can't support the protobuf encoding for these as it relies on appending to
+// the slice one element at a time, and an array has nowhere to record how many
+// elements have been read so far.
+type ArrayWrapper struct {
+	Underlying Codec
+	Len        int
+	EltSize    uintptr
+	EltType    unsafe.Pointer
+}
+
+func (c ArrayWrapper) header(ptr unsafe.Pointer) sliceHeader {
+	return sliceHeader{Data: ptr, Len: c.Len, Cap: c.Len}
+}
+
+// Omit returns true if every element of the array is the zero value
+func (c ArrayWrapper) Omit(ptr unsafe.Pointer) bool {
+	return isZeroMemory(ptr, uintptr(c.Len)*c.EltSize)
+}
+
+func (c ArrayWrapper) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if wt == plenccore.WTLength && c.Underlying.WireType() == plenccore.WTSlice {
+		return 0, fmt.Errorf("arrays cannot be read from protobuf repeated field encoding")
+	}
+
+	// We read into a slice that uses the array as its backing store. The slice
+	// codecs only allocate if the slice capacity is too small for the data,
+	// which is exactly the case where the data doesn't fit the array.
+	h := sliceHeader{Data: ptr, Cap: c.Len}
+	n, err = c.Underlying.Read(data, unsafe.Pointer(&h), wt)
+	if err != nil {
+		return 0, err
+	}
+	if h.Data != ptr || h.Len > c.Len {
+		return 0, fmt.Errorf("data has %d elements, which does not fit in an array of length %d", h.Len, c.Len)
+	}
+
+	// Any elements not present in the data are set to zero.
+	for i := h.Len; i < c.Len; i++ {
+		typedmemclr(c.EltType, unsafe.Add(ptr, uintptr(i)*c.EltSize))
+	}
+	return n, nil
+}
+
+func (c ArrayWrapper) New() unsafe.Pointer {
+	return unsafe_NewArray(c.EltType, c.Len)
+}
+
+func (c ArrayWrapper) WireType() plenccore.WireType {
+	return c.Underlying.WireType()
+}
+
+func (c ArrayWrapper) Descriptor() Descriptor {
+	return c.Underlying.Descriptor()
+}
+
+func (c ArrayWrapper) Size(ptr unsafe.Pointer, tag []byte) int {
+	h := c.header(ptr)
+	return c.Underlying.Size(unsafe.Pointer(&h), tag)
+}
+
+func (c ArrayWrapper) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	h := c.header(ptr)
+	return c.Underlying.Append(data, unsafe.Pointer(&h), tag)
+}
+
+// ByteArrayCodec is a codec for fixed-size byte arrays such as [16]byte. It
+// uses the same encoding as BytesCodec, but reads directly into the array.
+type ByteArrayCodec struct {
+	Len int
+}
+
+func (c ByteArrayCodec) slice(ptr unsafe.Pointer) []byte {
+	return unsafe.Slice((*byte)(ptr), c.Len)
+}
+
+func (c ByteArrayCodec) Omit(ptr unsafe.Pointer) bool {
+	return isZeroMemory(ptr, uintptr(c.Len))
+}
+
+func (c ByteArrayCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if len(data) > c.Len {
+		return 0, fmt.Errorf("data has %d bytes, which does not fit in an array of length %d", len(data), c.Len)
+	}
+	s := c.slice(ptr)
+	n = copy(s, data)
+	clear(s[n:])
+	return n, nil
+}
+
+func (c ByteArrayCodec) New() unsafe.Pointer {
+	s := make([]byte, c.Len)
+	return unsafe.Pointer(unsafe.SliceData(s))
+}
+
+func (c ByteArrayCodec) WireType() plenccore.WireType {
+	return plenccore.WTLength
+}
+
+func (c ByteArrayCodec) Descriptor() Descriptor {
+	return BytesCodec{}.Descriptor()
+}
+
+func (c ByteArrayCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	s := c.slice(ptr)
+	return BytesCodec{}.Size(unsafe.Pointer(&s), tag)
+}
+
+func (c ByteArrayCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	s := c.slice(ptr)
+	return BytesCodec{}.Append(data, unsafe.Pointer(&s), tag)
+}
+
+// isZeroMemory returns true if the size bytes at ptr are all zero
+func isZeroMemory(ptr unsafe.Pointer, size uintptr) bool {
+	for _, b := range unsafe.Slice((*byte)(ptr), size) {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package plenccodec_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	"github.com/philpearl/plenc"
+)
+
+func TestArray(t *testing.T) {
+	type inner struct {
+		A int    `plenc:"1"`
+		B string `plenc:"2"`
+	}
+
+	type arrays struct {
+		A [16]byte      `plenc:"1"`
+		B [32]uint8     `plenc:"2"`
+		C [3]float64    `plenc:"3"`
+		D [2]float32    `plenc:"4"`
+		E [4]int        `plenc:"5"`
+		F [3]uint32     `plenc:"6"`
+		G [2]string     `plenc:"7"`
+		H [2]inner      `plenc:"8"`
+		I [2]*inner     `plenc:"9"`
+		J [2][2]float32 `plenc:"10"`
+		K [2]time.Time  `plenc:"11"`
+		L [2]bool       `plenc:"12"`
+		M []([2]int)    `plenc:"13"`
+		N *[4]byte      `plenc:"14"`
+	}
+
+	f := fuzz.New().Funcs(func(out **inner, cont fuzz.Continue) {
+		// We don't support having nil entries in slices of pointers
+		var v inner
+		cont.Fuzz(&v)
+		*out = &v
+	})
+	for range 1000 {
+		var in arrays
+		f.Fuzz(&in)
+
+		data, err := plenc.Marshal(nil, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out arrays
+		if err := plenc.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(in, out); diff != "" {
+			t.Fatalf("arrays differ. %s", diff)
+		}
+	}
+}
+
+func TestArrayZeros(t *testing.T) {
+	type arrays struct {
+		A [4]byte `plenc:"1"`
+		B [3]int  `plenc:"2"`
+	}
+
+	data, err := plenc.Marshal(nil, &arrays{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("expected zero arrays to be omitted, got %x", data)
+	}
+
+	// Elements that aren't present in the data are reset to zero when reading
+	// into an existing array
+	type asSlice struct {
+		B []int `plenc:"2"`
+	}
+	data, err = plenc.Marshal(nil, &asSlice{B: []int{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := arrays{B: [3]int{7, 8, 9}}
+	if err := plenc.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(arrays{B: [3]int{1, 0, 0}}, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestArrayTooShort(t *testing.T) {
+	type long struct {
+		A []byte   `plenc:"1"`
+		B []int    `plenc:"2"`
+		C []string `plenc:"3"`
+		D []uint64 `plenc:"4"`
+	}
+	type short struct {
+		A [2]byte   `plenc:"1"`
+		B [2]int    `plenc:"2"`
+		C [2]string `plenc:"3"`
+		D [2]uint64 `plenc:"4"`
+	}
+
+	tests := []struct {
+		name string
+		in   long
+		exp  string
+	}{
+		{
+			name: "bytes",
+			in:   long{A: []byte{1, 2, 3}},
+			exp:  "failed reading field 1 of short. data has 3 bytes, which does not fit in an array of length 2",
+		},
+		{
+			name: "ints",
+			in:   long{B: []int{1, 2, 3}},
+			exp:  "failed reading field 2 of short. data has 3 elements, which does not fit in an array of length 2",
+		},
+		{
+			name: "strings",
+			in:   long{C: []string{"a", "b", "c"}},
+			exp:  "failed reading field 3 of short. data has 3 elements, which does not fit in an array of length 2",
+		},
+		{
+			name: "uints",
+			in:   long{D: []uint64{1, 2, 3}},
+			exp:  "failed reading field 4 of short. data has 3 elements, which does not fit in an array of length 2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := plenc.Marshal(nil, &test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out short
+			err = plenc.Unmarshal(data, &out)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != test.exp {
+				t.Fatalf("error %q not as expected", err)
+			}
+		})
+	}
+}
+
+func TestArraySliceCompatible(t *testing.T) {
+	type asSlice struct {
+		A []byte    `plenc:"1"`
+		B []float64 `plenc:"2"`
+		C []string  `plenc:"3"`
+	}
+	type asArray struct {
+		A [3]byte    `plenc:"1"`
+		B [2]float64 `plenc:"2"`
+		C [2]string  `plenc:"3"`
+	}
+
+	in := asArray{
+		A: [3]byte{1, 2, 3},
+		B: [2]float64{3.7, 1.2},
+		C: [2]string{"a", "b"},
+	}
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out asSlice
+	if err := plenc.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	exp := asSlice{
+		A: []byte{1, 2, 3},
+		B: []float64{3.7, 1.2},
+		C: []string{"a", "b"},
+	}
+	if diff := cmp.Diff(exp, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
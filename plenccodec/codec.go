@@ -61,3 +61,13 @@ type CodecBuilder interface {
 	// consulting registry for any existing codecs needed
 	CodecForTypeRegistry(registry CodecRegistry, typ reflect.Type, tag string) (Codec, error)
 }
+
+// EncodeError reports a value that can't be encoded. Size and Append don't
+// return errors, so codecs that find such a value panic with an EncodeError.
+// Plenc recovers the panic and returns Err.
+type EncodeError struct {
+	Err error
+}
+
+func (e EncodeError) Error() string { return e.Err.Error() }
+func (e EncodeError) Unwrap() error { return e.Err }
@@ -0,0 +1,160 @@
+package plenccodec
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Incompatibility describes a change between two versions of a type that means
+// data written with one version can't be read correctly with the other.
+type Incompatibility struct {
+	// Path identifies the field that has changed. It is made from the field
+	// names in the new version, separated by dots. "[]" indicates the elements
+	// of a slice.
+	Path string `json:"path"`
+	// Reason describes the change.
+	Reason string `json:"reason"`
+}
+
+func (i Incompatibility) String() string {
+	if i.Path == "" {
+		return i.Reason
+	}
+	return i.Path + ": " + i.Reason
+}
+
+// CheckCompatible compares the descriptor of a type with the descriptor of a
+// new version of the same type, and reports any changes that break the rules
+// for evolving plenc types. Fields are matched by Index, so renaming fields and
+// types is allowed, as is adding and removing fields. Changing the type of a
+// field, or re-using the index of a removed field for a field of a different
+// type, is not. References in recursive types are compared as the structs they
+// refer to. CheckCompatible returns nil if the two are compatible.
+func CheckCompatible(old, new Descriptor) []Incompatibility {
+	var c compatChecker
+	oldR, err := old.resolved()
+	if err != nil {
+		c.report("", "old version is invalid. %s", err)
+	}
+	newR, err := new.resolved()
+	if err != nil {
+		c.report("", "new version is invalid. %s", err)
+	}
+	if c.problems != nil {
+		return c.problems
+	}
+	c.check("", oldR, newR)
+	return c.problems
+}
+
+type compatChecker struct {
+	problems []Incompatibility
+	// compared records the pairs of struct fields we've compared. Resolved
+	// references share the fields of the struct they refer to, so this stops
+	// us following recursive types forever.
+	compared map[[2]*Descriptor]bool
+}
+
+func (c *compatChecker) report(path, format string, args ...any) {
+	c.problems = append(c.problems, Incompatibility{
+		Path:   path,
+		Reason: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *compatChecker) check(path string, old, new *Descriptor) {
+	if old.Type != new.Type {
+		switch {
+		case old.Type == FieldTypeSlice:
+			c.report(path, "changed from a slice to %s", new.Type)
+		case new.Type == FieldTypeSlice:
+			c.report(path, "changed from %s to a slice", old.Type)
+		default:
+			c.report(path, "type changed from %s to %s", old.Type, new.Type)
+		}
+		return
+	}
+
+	if old.LogicalType != new.LogicalType && !(isPlainString(old) && isPlainString(new)) {
+		c.report(path, "logical type changed from %s to %s", old.LogicalType, new.LogicalType)
+	}
+	if old.ExplicitPresence != new.ExplicitPresence {
+		if new.ExplicitPresence {
+			c.report(path, "field now has explicit presence")
+		} else {
+			c.report(path, "field no longer has explicit presence")
+		}
+	}
+
+	switch old.Type {
+	case FieldTypeSlice:
+		if len(old.Elements) != 1 || len(new.Elements) != 1 {
+			c.report(path, "slice descriptors should have exactly one element")
+			return
+		}
+		c.check(path+"[]", &old.Elements[0], &new.Elements[0])
+
+	case FieldTypeStruct, FieldTypeUnion:
+		if len(old.Elements) != 0 && len(new.Elements) != 0 {
+			key := [2]*Descriptor{&old.Elements[0], &new.Elements[0]}
+			if c.compared[key] {
+				return
+			}
+			if c.compared == nil {
+				c.compared = make(map[[2]*Descriptor]bool)
+			}
+			c.compared[key] = true
+		}
+		c.checkFields(path, old, new)
+	}
+}
+
+// checkFields matches the fields (or union members) of old and new by index
+// and compares those that are in both.
+func (c *compatChecker) checkFields(path string, old, new *Descriptor) {
+	for i := range new.Elements {
+		newElt := &new.Elements[i]
+		if newElt.Index < 1 {
+			c.report(fieldPath(path, newElt), "invalid index %d", newElt.Index)
+			continue
+		}
+		for j := range new.Elements[:i] {
+			if new.Elements[j].Index == newElt.Index {
+				c.report(fieldPath(path, newElt), "index %d is used more than once", newElt.Index)
+			}
+		}
+
+		for j := range old.Elements {
+			oldElt := &old.Elements[j]
+			if oldElt.Index != newElt.Index {
+				continue
+			}
+			if oldElt.Name != newElt.Name && oldElt.Type != newElt.Type {
+				// This is likely a new field that has re-used the index
+				// of a removed one.
+				c.report(fieldPath(path, newElt), "index %d was used for %s (%s) and is now used for %s (%s)",
+					newElt.Index, oldElt.Name, oldElt.Type, newElt.Name, newElt.Type)
+				break
+			}
+			c.check(fieldPath(path, newElt), oldElt, newElt)
+			break
+		}
+	}
+}
+
+func fieldPath(path string, elt *Descriptor) string {
+	name := elt.Name
+	if name == "" {
+		name = strconv.Itoa(elt.Index)
+	}
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// isPlainString returns true if d describes a string or a byte slice. These
+// are encoded identically, so a field can change from one to the other.
+func isPlainString(d *Descriptor) bool {
+	return d.Type == FieldTypeString && (d.LogicalType == LogicalTypeNone || d.LogicalType == LogicalTypeBytes)
+}
@@ -0,0 +1,182 @@
+package plenccodec_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+func descriptorFor[T any](t *testing.T) plenccodec.Descriptor {
+	t.Helper()
+	c, err := plenc.CodecForType(reflect.TypeFor[T]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Descriptor()
+}
+
+func TestCheckCompatible(t *testing.T) {
+	type subV1 struct {
+		A int    `plenc:"1"`
+		B string `plenc:"2"`
+	}
+	type v1 struct {
+		A int            `plenc:"1"`
+		B string         `plenc:"2"`
+		C []subV1        `plenc:"3"`
+		D float64        `plenc:"4"`
+		E *int           `plenc:"5"`
+		F time.Time      `plenc:"6"`
+		G map[string]int `plenc:"7"`
+		H int            `plenc:"8"`
+	}
+
+	t.Run("same", func(t *testing.T) {
+		if problems := plenccodec.CheckCompatible(descriptorFor[v1](t), descriptorFor[v1](t)); problems != nil {
+			t.Fatal(problems)
+		}
+	})
+
+	t.Run("compatible changes", func(t *testing.T) {
+		type subV2 struct {
+			Renamed int    `plenc:"1"`
+			B       string `plenc:"2"`
+			New     bool   `plenc:"3"`
+		}
+		// Renamed fields and types, added fields and removed fields are all
+		// fine. Strings and byte slices are encoded the same way.
+		type v2 struct {
+			A       int            `plenc:"1"`
+			Renamed []byte         `plenc:"2"`
+			C       []subV2        `plenc:"3"`
+			E       *int           `plenc:"5"`
+			F       time.Time      `plenc:"6"`
+			G       map[string]int `plenc:"7"`
+			H       int            `plenc:"8"`
+			I       []string       `plenc:"9"`
+		}
+		if problems := plenccodec.CheckCompatible(descriptorFor[v1](t), descriptorFor[v2](t)); problems != nil {
+			t.Fatal(problems)
+		}
+	})
+
+	t.Run("incompatible changes", func(t *testing.T) {
+		type subV2 struct {
+			A uint   `plenc:"1"`
+			B string `plenc:"2"`
+		}
+		type v2 struct {
+			A []int             `plenc:"1"`
+			B string            `plenc:"2"`
+			C []subV2           `plenc:"3"`
+			X string            `plenc:"4"`
+			E int               `plenc:"5"`
+			F time.Time         `plenc:"6,flattime"`
+			G map[string]string `plenc:"7"`
+			H int               `plenc:"8"`
+		}
+
+		var p plenc.Plenc
+		p.RegisterDefaultCodecs()
+		p.RegisterCodecWithTag(reflect.TypeFor[time.Time](), "flattime", plenccodec.BQTimestampCodec{})
+		c, err := p.CodecForType(reflect.TypeFor[v2]())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		problems := plenccodec.CheckCompatible(descriptorFor[v1](t), c.Descriptor())
+		exp := []plenccodec.Incompatibility{
+			{Path: "A", Reason: "changed from FieldTypeInt to a slice"},
+			{Path: "C[].A", Reason: "type changed from FieldTypeInt to FieldTypeUint"},
+			{Path: "X", Reason: "index 4 was used for D (FieldTypeFloat64) and is now used for X (FieldTypeString)"},
+			{Path: "E", Reason: "field no longer has explicit presence"},
+			{Path: "F", Reason: "type changed from FieldTypeTime to FieldTypeFlatInt"},
+			{Path: "G[].value", Reason: "type changed from FieldTypeInt to FieldTypeString"},
+		}
+		if diff := cmp.Diff(exp, problems); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("logical type", func(t *testing.T) {
+		old := plenccodec.Descriptor{Type: plenccodec.FieldTypeStruct, Elements: []plenccodec.Descriptor{
+			{Index: 1, Name: "A", Type: plenccodec.FieldTypeFlatInt},
+		}}
+		new := plenccodec.Descriptor{Type: plenccodec.FieldTypeStruct, Elements: []plenccodec.Descriptor{
+			{Index: 1, Name: "A", Type: plenccodec.FieldTypeFlatInt, LogicalType: plenccodec.LogicalTypeTimestamp},
+			{Index: 2, Name: "B", Type: plenccodec.FieldTypeInt},
+			{Index: 2, Name: "C", Type: plenccodec.FieldTypeInt},
+		}}
+		problems := plenccodec.CheckCompatible(old, new)
+		exp := []plenccodec.Incompatibility{
+			{Path: "A", Reason: "logical type changed from LogicalTypeNone to LogicalTypeTimestamp"},
+			{Path: "C", Reason: "index 2 is used more than once"},
+		}
+		if diff := cmp.Diff(exp, problems); diff != "" {
+			t.Fatal(diff)
+		}
+		if s := problems[0].String(); s != "A: logical type changed from LogicalTypeNone to LogicalTypeTimestamp" {
+			t.Fatal(s)
+		}
+	})
+
+	t.Run("recursive", func(t *testing.T) {
+		type nodeV1 struct {
+			Value    int      `plenc:"1"`
+			Children []nodeV1 `plenc:"2"`
+		}
+		type nodeV2 struct {
+			Value    int      `plenc:"1"`
+			Children []nodeV2 `plenc:"2"`
+			Name     string   `plenc:"3"`
+		}
+		if problems := plenccodec.CheckCompatible(descriptorFor[nodeV1](t), descriptorFor[nodeV2](t)); problems != nil {
+			t.Fatal(problems)
+		}
+
+		type nodeV3 struct {
+			Value    uint     `plenc:"1"`
+			Children []nodeV3 `plenc:"2"`
+		}
+		problems := plenccodec.CheckCompatible(descriptorFor[nodeV1](t), descriptorFor[nodeV3](t))
+		exp := []plenccodec.Incompatibility{
+			{Path: "Value", Reason: "type changed from FieldTypeInt to FieldTypeUint"},
+		}
+		if diff := cmp.Diff(exp, problems); diff != "" {
+			t.Fatal(diff)
+		}
+
+		// A struct field can become a reference to a compatible struct
+		type childV1 struct {
+			Value int `plenc:"1"`
+		}
+		type treeV1 struct {
+			Value int      `plenc:"1"`
+			Child *childV1 `plenc:"2"`
+		}
+		type treeV2 struct {
+			Value int     `plenc:"1"`
+			Child *treeV2 `plenc:"2"`
+		}
+		if problems := plenccodec.CheckCompatible(descriptorFor[treeV1](t), descriptorFor[treeV2](t)); problems != nil {
+			t.Fatal(problems)
+		}
+
+		type treeV3 struct {
+			Value string  `plenc:"1"`
+			Child *treeV3 `plenc:"2"`
+		}
+		problems = plenccodec.CheckCompatible(descriptorFor[treeV1](t), descriptorFor[treeV3](t))
+		exp = []plenccodec.Incompatibility{
+			{Path: "Value", Reason: "type changed from FieldTypeInt to FieldTypeString"},
+			{Path: "Child.Value", Reason: "type changed from FieldTypeInt to FieldTypeString"},
+		}
+		if diff := cmp.Diff(exp, problems); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
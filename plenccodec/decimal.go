@@ -0,0 +1,301 @@
+package plenccodec
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// DecimalAdapter is implemented by decimal number types so that plenc can
+// encode them exactly. The value is coefficient × 10^exponent. For example,
+// shopspring/decimal can be adapted like this.
+//
+//	type Money struct{ decimal.Decimal }
+//
+//	func (m Money) DecimalParts() (*big.Int, int32) {
+//		return m.Coefficient(), m.Exponent()
+//	}
+//
+//	func (m *Money) SetDecimalParts(coefficient *big.Int, exponent int32) error {
+//		m.Decimal = decimal.NewFromBigInt(coefficient, exponent)
+//		return nil
+//	}
+//
+// The methods may have value or pointer receivers. Exponents must be within
+// ±10000: plenc returns an error for values outside that range.
+type DecimalAdapter interface {
+	DecimalParts() (coefficient *big.Int, exponent int32)
+	SetDecimalParts(coefficient *big.Int, exponent int32) error
+}
+
+var decimalAdapterType = reflect.TypeFor[DecimalAdapter]()
+
+// maxDecimalExponent limits the exponents of decimals. Decimals are formatted
+// without an exponent, so this also limits the number of zeros we write.
+const maxDecimalExponent = 10000
+
+func checkDecimalExponent(exponent int64) error {
+	if exponent < -maxDecimalExponent || exponent > maxDecimalExponent {
+		return fmt.Errorf("decimal exponent %d is outside the range ±%d", exponent, maxDecimalExponent)
+	}
+	return nil
+}
+
+// IsDecimal returns true if typ implements DecimalAdapter with either value or
+// pointer receivers.
+func IsDecimal(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Interface:
+		return false
+	}
+	return reflect.PointerTo(typ).Implements(decimalAdapterType)
+}
+
+// DecimalCodec is a codec for types that implement DecimalAdapter. Values are
+// encoded as the exponent as a zig-zag varint, followed by the coefficient
+// encoded as for BigIntCodec. Each value carries its own exponent, so the
+// descriptor has no precision or scale. Zero values are omitted.
+type DecimalCodec struct {
+	rtype reflect.Type
+	// itab for a pointer to the type
+	adapter unsafe.Pointer
+}
+
+// BuildDecimalCodec builds a codec for typ, which must implement
+// DecimalAdapter.
+func BuildDecimalCodec(typ reflect.Type) (Codec, error) {
+	if !IsDecimal(typ) {
+		return nil, fmt.Errorf("%s does not implement DecimalAdapter", typ)
+	}
+	a := reflect.New(typ).Interface().(DecimalAdapter)
+	return &DecimalCodec{
+		rtype:   typ,
+		adapter: (*iface)(unsafe.Pointer(&a)).tab,
+	}, nil
+}
+
+func (c *DecimalCodec) a(ptr unsafe.Pointer) DecimalAdapter {
+	var a DecimalAdapter
+	i := (*iface)(unsafe.Pointer(&a))
+	i.tab = c.adapter
+	i.data = ptr
+	return a
+}
+
+// parts returns the parts of the decimal. Errors can't be returned from Size
+// or Append, so we panic with an EncodeError if the exponent is out of range.
+func (c *DecimalCodec) parts(ptr unsafe.Pointer) (*big.Int, int32) {
+	coefficient, exponent := c.a(ptr).DecimalParts()
+	if err := checkDecimalExponent(int64(exponent)); err != nil {
+		panic(EncodeError{Err: fmt.Errorf("cannot encode %s. %w", c.rtype, err)})
+	}
+	if coefficient == nil {
+		coefficient = new(big.Int)
+	}
+	return coefficient, exponent
+}
+
+func (c *DecimalCodec) Omit(ptr unsafe.Pointer) bool {
+	coefficient, _ := c.parts(ptr)
+	return coefficient.Sign() == 0
+}
+
+func (c *DecimalCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	coefficient, exponent, err := readDecimal(data)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.a(ptr).SetDecimalParts(coefficient, exponent); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (c *DecimalCodec) New() unsafe.Pointer {
+	return reflect.New(c.rtype).UnsafePointer()
+}
+
+func (c *DecimalCodec) WireType() plenccore.WireType {
+	return plenccore.WTLength
+}
+
+func (c *DecimalCodec) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeString, LogicalType: LogicalTypeDecimal}
+}
+
+func (c *DecimalCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	coefficient, exponent := c.parts(ptr)
+	l := plenccore.SizeVarInt(int64(exponent)) + sizeBigInt(coefficient)
+	if len(tag) != 0 {
+		l += len(tag) + plenccore.SizeVarUint(uint64(l))
+	}
+	return l
+}
+
+func (c *DecimalCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	coefficient, exponent := c.parts(ptr)
+	if len(tag) != 0 {
+		l := plenccore.SizeVarInt(int64(exponent)) + sizeBigInt(coefficient)
+		data = append(data, tag...)
+		data = plenccore.AppendVarUint(data, uint64(l))
+	}
+	return appendDecimal(data, coefficient, exponent)
+}
+
+func appendDecimal(data []byte, coefficient *big.Int, exponent int32) []byte {
+	data = plenccore.AppendVarInt(data, int64(exponent))
+	return appendBigInt(data, coefficient)
+}
+
+func readDecimal(data []byte) (*big.Int, int32, error) {
+	var coefficient big.Int
+	if len(data) == 0 {
+		return &coefficient, 0, nil
+	}
+	exponent, n := plenccore.ReadVarInt(data)
+	if n <= 0 {
+		return nil, 0, fmt.Errorf("invalid decimal exponent")
+	}
+	if err := checkDecimalExponent(exponent); err != nil {
+		return nil, 0, err
+	}
+	if err := readBigInt(data[n:], &coefficient); err != nil {
+		return nil, 0, err
+	}
+	return &coefficient, int32(exponent), nil
+}
+
+// ScaledIntCodec is a codec for fixed-point decimals held in an int. The int
+// is the value × 10^Scale, so an int64 of cents has a Scale of 2. The int is
+// encoded as for IntCodec. Select it with the decimal=<scale> tag option.
+type ScaledIntCodec[T int | int8 | int16 | int32 | int64] struct {
+	IntCodec[T]
+	Scale int
+}
+
+func (c ScaledIntCodec[T]) Descriptor() Descriptor {
+	return Descriptor{
+		Type:        FieldTypeInt,
+		LogicalType: LogicalTypeDecimal,
+		Precision:   DecimalPrecision(reflect.TypeFor[T]()),
+		Scale:       c.Scale,
+	}
+}
+
+// DecimalPrecision returns the number of decimal digits that always fit in
+// the int type typ.
+func DecimalPrecision(typ reflect.Type) int {
+	switch typ.Bits() {
+	case 8:
+		return 2
+	case 16:
+		return 4
+	case 32:
+		return 9
+	}
+	return 18
+}
+
+// formatDecimal formats coefficient × 10^exponent without an exponent.
+func formatDecimal(coefficient *big.Int, exponent int) string {
+	s := coefficient.String()
+	if exponent >= 0 {
+		if coefficient.Sign() == 0 {
+			return s
+		}
+		return s + strings.Repeat("0", exponent)
+	}
+
+	var sign string
+	if s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+	places := -exponent
+	if len(s) <= places {
+		s = strings.Repeat("0", places-len(s)+1) + s
+	}
+	return sign + s[:len(s)-places] + "." + s[len(s)-places:]
+}
+
+// parseDecimal parses a decimal number such as "-12.34" or "1.5e3", returning
+// its coefficient and exponent.
+func parseDecimal(s string) (*big.Int, int, error) {
+	mantissa, exp, hasExp := strings.Cut(strings.ToLower(s), "e")
+	var exponent int
+	if hasExp {
+		var err error
+		if exponent, err = strconv.Atoi(exp); err != nil {
+			return nil, 0, fmt.Errorf("cannot parse %q as a decimal", s)
+		}
+	}
+	whole, frac, _ := strings.Cut(mantissa, ".")
+	if strings.ContainsAny(frac, "+-") {
+		return nil, 0, fmt.Errorf("cannot parse %q as a decimal", s)
+	}
+	coefficient, ok := new(big.Int).SetString(whole+frac, 10)
+	if !ok {
+		return nil, 0, fmt.Errorf("cannot parse %q as a decimal", s)
+	}
+	exponent -= len(frac)
+	if err := checkDecimalExponent(int64(exponent)); err != nil {
+		return nil, 0, fmt.Errorf("cannot parse %q as a decimal. %w", s, err)
+	}
+	return coefficient, exponent, nil
+}
+
+// toDecimal converts a number, or a string as output by Descriptor.Read, to a
+// decimal coefficient and exponent.
+func toDecimal(v any) (*big.Int, int, error) {
+	switch v := v.(type) {
+	case string:
+		return parseDecimal(v)
+	case json.Number:
+		return parseDecimal(string(v))
+	case float64:
+		return parseDecimal(strconv.FormatFloat(v, 'g', -1, 64))
+	case float32:
+		return parseDecimal(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	}
+	i, err := toInt64(v, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	return big.NewInt(i), 0, nil
+}
+
+// scaleInt converts coefficient × 10^exponent to an int64 with the given
+// scale. It fails if that would lose digits or overflow.
+func scaleInt(coefficient *big.Int, exponent int, scale int) (int64, error) {
+	if err := checkDecimalExponent(int64(-scale)); err != nil {
+		return 0, fmt.Errorf("invalid decimal scale. %w", err)
+	}
+	if coefficient.Sign() == 0 {
+		return 0, nil
+	}
+	v := new(big.Int).Set(coefficient)
+	ten := big.NewInt(10)
+	switch shift := exponent + scale; {
+	case shift > 18:
+		return 0, fmt.Errorf("%s overflows int64 with %d decimal places", formatDecimal(coefficient, exponent), scale)
+	case shift >= 0:
+		v.Mul(v, new(big.Int).Exp(ten, big.NewInt(int64(shift)), nil))
+	case -shift > len(v.String()):
+		return 0, fmt.Errorf("%s has more than %d decimal places", formatDecimal(coefficient, exponent), scale)
+	default:
+		var rem big.Int
+		v.QuoRem(v, new(big.Int).Exp(ten, big.NewInt(int64(-shift)), nil), &rem)
+		if rem.Sign() != 0 {
+			return 0, fmt.Errorf("%s has more than %d decimal places", formatDecimal(coefficient, exponent), scale)
+		}
+	}
+	if !v.IsInt64() {
+		return 0, fmt.Errorf("%s overflows int64 with %d decimal places", formatDecimal(coefficient, exponent), scale)
+	}
+	return v.Int64(), nil
+}
@@ -0,0 +1,279 @@
+package plenccodec_test
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// money is a minimal arbitrary-precision decimal, standing in for something
+// like shopspring/decimal.
+type money struct {
+	coefficient big.Int
+	exponent    int32
+}
+
+func (m *money) DecimalParts() (*big.Int, int32) {
+	return &m.coefficient, m.exponent
+}
+
+func (m *money) SetDecimalParts(coefficient *big.Int, exponent int32) error {
+	m.coefficient.Set(coefficient)
+	m.exponent = exponent
+	return nil
+}
+
+type decimalThing struct {
+	A int64   `plenc:"1,decimal=2"`
+	B int32   `plenc:"2,decimal=4"`
+	C []int   `plenc:"3,decimal=3"`
+	D money   `plenc:"4"`
+	E *money  `plenc:"5"`
+	F []money `plenc:"6"`
+	G *int16  `plenc:"7,decimal=1"`
+}
+
+var moneyComparer = cmp.Comparer(func(a, b money) bool {
+	return a.exponent == b.exponent && a.coefficient.Cmp(&b.coefficient) == 0
+})
+
+func TestDecimal(t *testing.T) {
+	f := fuzz.New().NilChance(0.2).Funcs(
+		func(m *money, c fuzz.Continue) {
+			m.coefficient.SetInt64(c.Int63())
+			m.coefficient.Lsh(&m.coefficient, uint(c.Intn(70)))
+			if c.RandBool() {
+				m.coefficient.Neg(&m.coefficient)
+			}
+			m.exponent = int32(c.Intn(41) - 20)
+			if m.coefficient.Sign() == 0 {
+				m.exponent = 0
+			}
+		},
+	)
+
+	for range 1000 {
+		var in decimalThing
+		f.Fuzz(&in)
+
+		data, err := plenc.Marshal(nil, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out decimalThing
+		if err := plenc.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in, out, moneyComparer); diff != "" {
+			t.Fatal(diff)
+		}
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	g := int16(-5)
+	in := decimalThing{
+		A: -1234,
+		B: 5,
+		C: []int{1000, -1},
+		E: &money{exponent: -1},
+		F: []money{{exponent: 3}, {exponent: -30}},
+		G: &g,
+	}
+	in.D.coefficient.SetString("12345678901234567890123", 10)
+	in.D.exponent = -20
+	in.E.coefficient.SetInt64(-7)
+	in.F[0].coefficient.SetInt64(42)
+	in.F[1].coefficient.SetInt64(1)
+
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := plenc.CodecForType(reflect.TypeFor[decimalThing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+	if diff := cmp.Diff(plenccodec.Descriptor{
+		Index: 1, Name: "A", Type: plenccodec.FieldTypeInt, LogicalType: plenccodec.LogicalTypeDecimal, Precision: 18, Scale: 2,
+	}, d.Elements[0]); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(plenccodec.Descriptor{
+		Index: 4, Name: "D", Type: plenccodec.FieldTypeString, LogicalType: plenccodec.LogicalTypeDecimal,
+	}, d.Elements[3]); diff != "" {
+		t.Fatal(diff)
+	}
+
+	var j plenccodec.JSONOutput
+	if err := d.Read(&j, data); err != nil {
+		t.Fatal(err)
+	}
+	expJSON := `{
+  "A": "-12.34",
+  "B": "0.0005",
+  "C": [
+    "1.000",
+    "-0.001"
+  ],
+  "D": "123.45678901234567890123",
+  "E": "-0.7",
+  "F": [
+    "42000",
+    "0.000000000000000000000000000001"
+  ],
+  "G": "-0.5"
+}
+`
+	if diff := cmp.Diff(expJSON, string(j.Done())); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// Encoding the JSON gives back the same values. Scaled ints are rescaled,
+	// while other decimals keep the exponent of the text.
+	data2, err := d.EncodeJSON(nil, []byte(expJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out decimalThing
+	if err := plenc.Unmarshal(data2, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.F[0].coefficient.SetInt64(42000)
+	in.F[0].exponent = 0
+	if diff := cmp.Diff(in, out, moneyComparer); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// Numbers are decimal values too
+	data2, err = d.EncodeJSON(nil, []byte(`{"A": 12.5, "B": 3, "D": 1.5e-3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = decimalThing{}
+	if err := plenc.Unmarshal(data2, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.A != 1250 || out.B != 30000 || out.D.coefficient.Int64() != 15 || out.D.exponent != -4 {
+		t.Fatalf("unexpected result %#v", out)
+	}
+
+	_, err = d.EncodeJSON(nil, []byte(`{"A": "1.234"}`))
+	if err == nil || err.Error() != "failed encoding field 1(A) of decimalThing. 1.234 has more than 2 decimal places" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestDecimalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  reflect.Type
+		exp  string
+	}{
+		{
+			name: "bad scale",
+			typ: reflect.TypeFor[struct {
+				A int `plenc:"1,decimal=x"`
+			}](),
+			exp: `failed to find codec for field 0 (A, "decimal=x") of . invalid decimal scale "x"`,
+		},
+		{
+			name: "scale too large",
+			typ: reflect.TypeFor[struct {
+				A int8 `plenc:"1,decimal=3"`
+			}](),
+			exp: `failed to find codec for field 0 (A, "decimal=3") of . decimal scale 3 is too large for int8`,
+		},
+		{
+			name: "not an int",
+			typ: reflect.TypeFor[struct {
+				A float64 `plenc:"1,decimal=2"`
+			}](),
+			exp: `failed to find codec for field 0 (A, "decimal=2") of . float64 can't have a decimal scale`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := plenc.CodecForType(test.typ)
+			if err == nil || err.Error() != test.exp {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestDecimalExponentRange(t *testing.T) {
+	type thing struct {
+		D money `plenc:"4"`
+	}
+	c, err := plenc.CodecForType(reflect.TypeFor[thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	in := thing{D: money{exponent: 10000}}
+	in.D.coefficient.SetInt64(1)
+	if _, err := plenc.Marshal(nil, &in); err != nil {
+		t.Fatal(err)
+	}
+
+	in.D.exponent = 10001
+	_, err = plenc.Marshal(nil, &in)
+	if err == nil || err.Error() != "cannot encode plenccodec_test.money. decimal exponent 10001 is outside the range ±10000" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// A short message with a huge exponent
+	var value []byte
+	value = plenccore.AppendVarInt(value, math.MaxInt32)
+	value = append(value, 2)
+	data := plenccore.AppendTag(nil, plenccore.WTLength, 4)
+	data = plenccore.AppendVarUint(data, uint64(len(value)))
+	data = append(data, value...)
+
+	var out thing
+	if err := plenc.Unmarshal(data, &out); err == nil {
+		t.Fatal("expected an error")
+	}
+	var j plenccodec.JSONOutput
+	if err := d.Read(&j, data); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if _, err := d.EncodeJSON(nil, []byte(`{"D": "1e20000"}`)); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// Scale comes from the descriptor, which may not be trustworthy.
+	scaled := plenccodec.Descriptor{
+		Type: plenccodec.FieldTypeStruct,
+		Elements: []plenccodec.Descriptor{
+			{Index: 1, Name: "A", Type: plenccodec.FieldTypeInt, LogicalType: plenccodec.LogicalTypeDecimal, Scale: -math.MaxInt32},
+		},
+	}
+	data, err = plenc.Marshal(nil, &struct {
+		A int `plenc:"1"`
+	}{A: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j = plenccodec.JSONOutput{}
+	err = scaled.Read(&j, data)
+	if err == nil || err.Error() != "failed reading field 1(A) of . invalid decimal scale. decimal exponent 2147483647 is outside the range ±10000" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := scaled.EncodeJSON(nil, []byte(`{"A": 1}`)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
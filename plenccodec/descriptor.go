@@ -3,6 +3,8 @@ package plenccodec
 import (
 	"encoding/json"
 	"fmt"
+	"math/big"
+	"slices"
 	"time"
 	"unsafe"
 
@@ -27,8 +29,25 @@ const (
 	// Not zig-zag encoded, but expected to be signed. Don't use if negative
 	// numbers are likely.
 	FieldTypeFlatInt
+	// A value held in an interface. This is encoded like a struct with a
+	// single field. The index of the field identifies which of the Elements
+	// describes the value.
+	FieldTypeUnion
+	// Fixed size integers, as in protobuf's fixed32, fixed64, sfixed32 and
+	// sfixed64 types. These use WT32 or WT64 and are not zig-zag encoded.
+	FieldTypeFixed32
+	FieldTypeFixed64
+	FieldTypeSFixed32
+	FieldTypeSFixed64
+	// A time encoded like google.protobuf.Timestamp, as written by
+	// TimeCompatCodec. Unlike FieldTypeTime the seconds and nanoseconds are
+	// not zig-zag encoded.
+	FieldTypeProtoTimestamp
+	// A reference to a struct type that encloses this field, used for
+	// recursive types. TypeName names the struct, which is the nearest
+	// enclosing FieldTypeStruct descriptor with that TypeName.
+	FieldTypeRef
 	// Do we want int32 types?
-	// Do we want fixed size int types?
 	// Do we want a separate bytes type?
 	// Do we want an ENUM type? How would we encode it?
 )
@@ -43,6 +62,37 @@ const (
 	LogicalTypeTime
 	LogicalTypeMap
 	LogicalTypeMapEntry
+	// LogicalTypeText marks a FieldTypeString written by a type's MarshalText
+	// method.
+	LogicalTypeText
+	// LogicalTypeBinary marks a FieldTypeString written by a type's
+	// MarshalBinary method. The data is not expected to be valid UTF-8, so
+	// Read outputs it base64 encoded.
+	LogicalTypeBinary
+	// LogicalTypeDuration marks a FieldTypeInt that holds a time.Duration.
+	LogicalTypeDuration
+	// LogicalTypeIPAddr marks a FieldTypeString that holds a netip.Addr in
+	// its binary form.
+	LogicalTypeIPAddr
+	// LogicalTypeIPPrefix marks a FieldTypeString that holds a netip.Prefix
+	// in its binary form.
+	LogicalTypeIPPrefix
+	// LogicalTypeBigInt marks a FieldTypeString that holds a big.Int as
+	// encoded by BigIntCodec.
+	LogicalTypeBigInt
+	// LogicalTypeBigRat marks a FieldTypeString that holds a big.Rat as
+	// encoded by BigRatCodec.
+	LogicalTypeBigRat
+	// LogicalTypeURL marks a FieldTypeString that holds a URL.
+	LogicalTypeURL
+	// LogicalTypeDecimal marks a decimal number. A FieldTypeInt holds the
+	// value × 10^Scale. A FieldTypeString holds a value encoded by
+	// DecimalCodec.
+	LogicalTypeDecimal
+	// LogicalTypeBytes marks a FieldTypeString that holds a byte slice rather
+	// than a string, so the data need not be valid UTF-8. Read outputs it just
+	// as it outputs a string.
+	LogicalTypeBytes
 )
 
 // Descriptor describes how a type is plenc-encoded. It contains enough
@@ -54,13 +104,15 @@ type Descriptor struct {
 	Name string `plenc:"2"`
 	// Type is the type of the field
 	Type FieldType `plenc:"3"`
-	// TypeName is used for struct types and is the name of the struct.
+	// TypeName is used for struct types and is the name of the struct. For
+	// FieldTypeUnion it is the name of the interface.
 	TypeName string `plenc:"5"`
 	// Elements is valid for FieldTypeSlice, FieldTypeStruct & FieldTypeMap. For
 	// FieldTypeSlice we expect one entry that describes the elements of the
 	// slice. For FieldTypeStruct we expect an entry for each field in the
 	// struct. For FieldTypeMap we expect two entries. The first is for the key
-	// type and the second is for the map type
+	// type and the second is for the map type. For FieldTypeUnion we expect an
+	// entry for each concrete type the interface may hold.
 	Elements []Descriptor `plenc:"4"`
 
 	// ExplicitPresence is set if the field has a mechanism to distinguish when
@@ -72,19 +124,112 @@ type Descriptor struct {
 	// The logical type of the field. This is used to indicate if the field has
 	// any special meaning - e.g. if a long or string indicates a timestamp.
 	LogicalType LogicalType `plenc:"7"`
+
+	// Precision and Scale are set for fields with LogicalTypeDecimal where
+	// every value has the same scale. Precision is the number of decimal
+	// digits and Scale the number of those after the decimal point. They are
+	// zero for decimals that carry their own exponent.
+	Precision int `plenc:"8"`
+	Scale     int `plenc:"9"`
 }
 
 func (d *Descriptor) Read(out Outputter, data []byte) (err error) {
-	_, err = d.read(out, data)
+	r, err := d.resolved()
+	if err != nil {
+		return err
+	}
+	_, err = r.read(out, data)
 	return err
 }
 
+// resolved returns a descriptor where FieldTypeRef descriptors are replaced by
+// the structs they refer to. If there are references the result is cyclic, so
+// it can only be walked alongside data. If there are no references d is
+// returned unchanged.
+func (d *Descriptor) resolved() (*Descriptor, error) {
+	if !d.hasRefs() {
+		return d, nil
+	}
+	r := d.clone()
+	if err := r.resolveRefs(nil); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (d *Descriptor) hasRefs() bool {
+	if d.Type == FieldTypeRef {
+		return true
+	}
+	for i := range d.Elements {
+		if d.Elements[i].hasRefs() {
+			return true
+		}
+	}
+	return false
+}
+
+func (d Descriptor) clone() Descriptor {
+	if d.Elements != nil {
+		elts := make([]Descriptor, len(d.Elements))
+		for i := range d.Elements {
+			elts[i] = d.Elements[i].clone()
+		}
+		d.Elements = elts
+	}
+	return d
+}
+
+// resolveRefs replaces references with the structs they refer to. scope
+// holds the enclosing structs.
+func (d *Descriptor) resolveRefs(scope []*Descriptor) error {
+	if d.Type == FieldTypeRef {
+		for _, s := range slices.Backward(scope) {
+			if s.TypeName == d.TypeName {
+				d.Type = FieldTypeStruct
+				d.Elements = s.Elements
+				return nil
+			}
+		}
+		return fmt.Errorf("no enclosing struct %q for reference %q", d.TypeName, d.Name)
+	}
+	if d.Type == FieldTypeStruct && d.TypeName != "" {
+		scope = append(scope, d)
+	}
+	for i := range d.Elements {
+		if err := d.Elements[i].resolveRefs(scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode decodes data described by the descriptor into a tree of generic Go
+// values. See AnyOutput for the types used.
+func (d *Descriptor) Decode(data []byte) (any, error) {
+	var out AnyOutput
+	if err := d.Read(&out, data); err != nil {
+		return nil, err
+	}
+	return out.Done(), nil
+}
+
 func (d *Descriptor) read(out Outputter, data []byte) (n int, err error) {
 	switch d.Type {
 	case FieldTypeInt:
 		var v int64
 		n, err = IntCodec[int64]{}.Read(data, unsafe.Pointer(&v), plenccore.WTVarInt)
-		out.Int64(v)
+		switch d.LogicalType {
+		case LogicalTypeDuration:
+			out.String(time.Duration(v).String())
+		case LogicalTypeDecimal:
+			if err := checkDecimalExponent(int64(-d.Scale)); err != nil {
+				return 0, fmt.Errorf("invalid decimal scale. %w", err)
+			}
+			out.String(formatDecimal(big.NewInt(v), -d.Scale))
+		default:
+			out.Int64(v)
+		}
 		return n, err
 
 	case FieldTypeFlatInt:
@@ -106,6 +251,30 @@ func (d *Descriptor) read(out Outputter, data []byte) (n int, err error) {
 		out.Uint64(v)
 		return n, err
 
+	case FieldTypeFixed32:
+		var v uint32
+		n, err = Fixed32Codec[uint32]{}.Read(data, unsafe.Pointer(&v), plenccore.WT32)
+		out.Uint64(uint64(v))
+		return n, err
+
+	case FieldTypeFixed64:
+		var v uint64
+		n, err = Fixed64Codec[uint64]{}.Read(data, unsafe.Pointer(&v), plenccore.WT64)
+		out.Uint64(v)
+		return n, err
+
+	case FieldTypeSFixed32:
+		var v int32
+		n, err = SFixed32Codec[int32]{}.Read(data, unsafe.Pointer(&v), plenccore.WT32)
+		out.Int64(int64(v))
+		return n, err
+
+	case FieldTypeSFixed64:
+		var v int64
+		n, err = SFixed64Codec[int64]{}.Read(data, unsafe.Pointer(&v), plenccore.WT64)
+		out.Int64(v)
+		return n, err
+
 	case FieldTypeFloat32:
 		var v float32
 		n, err = Float32Codec{}.Read(data, unsafe.Pointer(&v), plenccore.WT32)
@@ -121,8 +290,14 @@ func (d *Descriptor) read(out Outputter, data []byte) (n int, err error) {
 	case FieldTypeString:
 		var v string
 		n, err = StringCodec{}.Read(data, unsafe.Pointer(&v), plenccore.WTLength)
+		if err != nil {
+			return n, err
+		}
+		if v, err = logicalString(d.LogicalType, v); err != nil {
+			return 0, fmt.Errorf("failed to read %s. %w", d.LogicalType, err)
+		}
 		out.String(v)
-		return n, err
+		return n, nil
 
 	case FieldTypeBool:
 		var v bool
@@ -136,6 +311,12 @@ func (d *Descriptor) read(out Outputter, data []byte) (n int, err error) {
 		out.Time(v)
 		return n, err
 
+	case FieldTypeProtoTimestamp:
+		var v time.Time
+		n, err = TimeCompatCodec{}.Read(data, unsafe.Pointer(&v), plenccore.WTLength)
+		out.Time(v)
+		return n, err
+
 	case FieldTypeSlice:
 		if d.isValidJSONMap() {
 			out.StartObject()
@@ -154,6 +335,13 @@ func (d *Descriptor) read(out Outputter, data []byte) (n int, err error) {
 		defer out.EndObject()
 		return d.readAsStruct(out, data)
 
+	case FieldTypeUnion:
+		// The value is rendered as an object with a single field named after
+		// the concrete type
+		out.StartObject()
+		defer out.EndObject()
+		return d.readAsStruct(out, data)
+
 	case FieldTypeJSONObject:
 		out.StartObject()
 		defer out.EndObject()
@@ -192,7 +380,9 @@ func (d *Descriptor) isValidJSONMapEntry() bool {
 func (d *Descriptor) readAsSlice(out Outputter, data []byte) (n int, err error) {
 	elt := &d.Elements[0]
 	switch elt.Type {
-	case FieldTypeFloat32, FieldTypeFloat64, FieldTypeInt, FieldTypeUint:
+	case FieldTypeFloat32, FieldTypeFloat64, FieldTypeInt, FieldTypeUint,
+		FieldTypeFixed32, FieldTypeFixed64, FieldTypeSFixed32, FieldTypeSFixed64,
+		FieldTypeBool, FieldTypeFlatInt:
 		// If data is generated by protobuf this could be an element of a slice.
 		// We won't support that for now. So this is either a float64 or float32
 		offset := 0
@@ -205,7 +395,7 @@ func (d *Descriptor) readAsSlice(out Outputter, data []byte) (n int, err error)
 		}
 		return offset, nil
 
-	case FieldTypeStruct, FieldTypeSlice, FieldTypeString:
+	case FieldTypeStruct, FieldTypeSlice, FieldTypeString, FieldTypeUnion, FieldTypeTime, FieldTypeProtoTimestamp:
 		count, n := plenccore.ReadVarUint(data)
 		if n < 0 {
 			return 0, fmt.Errorf("corrupt data looking for WTSlice count")
@@ -220,9 +410,7 @@ func (d *Descriptor) readAsSlice(out Outputter, data []byte) (n int, err error)
 				return 0, fmt.Errorf("invalid varint for slice entry %d", i)
 			}
 			offset += n
-			if s == 0 {
-				continue
-			}
+			// Note that empty entries are zero values, so we still output them.
 			end := offset + int(s)
 			if end > len(data) {
 				return 0, fmt.Errorf("corrupt data reading slice entry %d", i)
@@ -251,6 +439,13 @@ func (d *Descriptor) readAsMapEntry(out Outputter, data []byte) (n int, err erro
 
 	l := len(data)
 
+	// Zero keys and values are not written, and the key and value may be in
+	// either order, but we always need to output both, key first. So we find
+	// them before we output anything.
+	var haveKey, haveValue bool
+	var keyData, valueData []byte
+	key, value := &d.Elements[0], &d.Elements[1]
+
 	var offset int
 	for offset < l {
 		wt, index, n := plenccore.ReadTag(data[offset:])
@@ -259,45 +454,44 @@ func (d *Descriptor) readAsMapEntry(out Outputter, data []byte) (n int, err erro
 		}
 		offset += n
 
-		var elt *Descriptor
-		for i := range d.Elements {
-			candidate := &d.Elements[i]
-			if candidate.Index == index {
-				elt = candidate
-				break
-			}
-		}
-
-		if elt == nil {
-			// Field corresponding to index does not exist
-			n, err := plenccore.Skip(data[offset:], wt)
-			if err != nil {
-				return 0, fmt.Errorf("failed to skip field %d in %s: %w", index, d.Name, err)
-			}
-			offset += n
-			continue
-		}
-
-		fl := l
+		start := offset
 		if wt == plenccore.WTLength {
-			// For WTLength types we read out the length and ensure the data we
-			// read the field from is the right length
-			v, n := plenccore.ReadVarUint(data[offset:])
+			_, n := plenccore.ReadVarUint(data[offset:])
 			if n <= 0 {
 				return 0, fmt.Errorf("varuint overflow reading field %d of %s", index, d.Name)
 			}
-			offset += n
-			fl = int(v) + offset
-			if fl > l {
-				return 0, fmt.Errorf("length %d of field %d of %s exceeds data length", fl, index, d.Name)
-			}
+			start += n
 		}
 
-		n, err := elt.read(out, data[offset:fl])
+		n, err := plenccore.Skip(data[offset:], wt)
 		if err != nil {
-			return 0, fmt.Errorf("failed reading field %d(%s) of %s. %w", index, elt.Name, d.Name, err)
+			return 0, fmt.Errorf("failed to skip field %d in %s: %w", index, d.Name, err)
+		}
+		if n < 0 || n > l-offset {
+			return 0, fmt.Errorf("length of field %d of %s exceeds data length", index, d.Name)
 		}
 		offset += n
+
+		switch index {
+		case key.Index:
+			keyData, haveKey = data[start:offset], true
+		case value.Index:
+			valueData, haveValue = data[start:offset], true
+		}
+	}
+
+	if haveKey {
+		if _, err := key.read(out, keyData); err != nil {
+			return 0, fmt.Errorf("failed reading field %d(%s) of %s. %w", key.Index, key.Name, d.Name, err)
+		}
+	} else {
+		out.String("")
+	}
+	if _, err := value.read(out, valueData); err != nil {
+		if haveValue {
+			return 0, fmt.Errorf("failed reading field %d(%s) of %s. %w", value.Index, value.Name, d.Name, err)
+		}
+		return 0, fmt.Errorf("failed reading zero value of %s. %w", d.Name, err)
 	}
 
 	return offset, nil
@@ -148,6 +148,132 @@ func TestDescriptor(t *testing.T) {
 	}
 }
 
+func TestDescriptorDecode(t *testing.T) {
+	type sub struct {
+		A int8   `plenc:"1"`
+		B string `plenc:"2"`
+	}
+
+	type my struct {
+		A int            `plenc:"1"`
+		B float32        `plenc:"2"`
+		C string         `plenc:"3"`
+		D uint           `plenc:"4"`
+		E []float64      `plenc:"5"`
+		F []sub          `plenc:"6"`
+		G *sub           `plenc:"7"`
+		H time.Time      `plenc:"8"`
+		I bool           `plenc:"9"`
+		J map[string]int `plenc:"10"`
+		K []string       `plenc:"11"`
+		L map[string]any `plenc:"12"`
+		M uint64         `plenc:"13,fixed"`
+	}
+
+	var p plenc.Plenc
+	p.RegisterDefaultCodecs()
+	p.RegisterCodec(reflect.TypeFor[map[string]any](), plenccodec.JSONMapCodec{})
+	p.RegisterCodec(reflect.TypeFor[[]any](), plenccodec.JSONArrayCodec{})
+
+	c, err := p.CodecForType(reflect.TypeFor[my]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	in := my{
+		A: -1,
+		B: 1.5,
+		C: "hat",
+		D: 7,
+		E: []float64{1, 2.5},
+		F: []sub{{A: 1, B: "one"}, {}},
+		G: &sub{B: "ptr"},
+		H: time.Date(1970, 3, 15, 0, 0, 0, 1337e5, time.UTC),
+		I: true,
+		J: map[string]int{"one": 1, "zero": 0, "": 2},
+		K: []string{"a", ""},
+		L: map[string]any{
+			"array": []any{1, "cheese", json.Number("1337")},
+		},
+		M: 1 << 60,
+	}
+
+	data, err := p.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := d.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := map[string]any{
+		"A": int64(-1),
+		"B": float64(1.5),
+		"C": "hat",
+		"D": uint64(7),
+		"E": []any{float64(1), float64(2.5)},
+		"F": []any{
+			map[string]any{"A": int64(1), "B": "one"},
+			map[string]any{},
+		},
+		"G": map[string]any{"B": "ptr"},
+		"H": time.Date(1970, 3, 15, 0, 0, 0, 1337e5, time.UTC),
+		"I": true,
+		"J": map[string]any{"one": int64(1), "zero": int64(0), "": int64(2)},
+		"K": []any{"a", ""},
+		"L": map[string]any{
+			"array": []any{int64(1), "cheese", json.Number("1337")},
+		},
+		"M": uint64(1 << 60),
+	}
+	if diff := cmp.Diff(exp, out); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// Empty data decodes as an empty object
+	out, err = d.Decode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]any{}, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestDescriptorMapEntryOrder(t *testing.T) {
+	c, err := plenc.CodecForType(reflect.TypeFor[map[string]int]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	// Other encoders may write the value of a map entry before the key.
+	data := []byte{
+		2,                        // two entries
+		5, 0x10, 6, 0x0a, 1, 'a', // value 3, then key "a"
+		4, 0x0a, 2, 'b', 'c', // key "bc" with a zero value
+	}
+
+	var j plenccodec.JSONOutput
+	if err := d.Read(&j, data); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("{\n  \"a\":   3,\n  \"bc\":   0\n}\n", string(j.Done())); diff != "" {
+		t.Fatal(diff)
+	}
+
+	out, err := d.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]any{"a": int64(3), "bc": int64(0)}, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func TestDescriptorRacey(t *testing.T) {
 	type my2 struct {
 		A int `plenc:"1"`
@@ -178,3 +304,196 @@ func TestDescriptorRacey(t *testing.T) {
 		})
 	}
 }
+
+type treeNode struct {
+	Value    int                  `plenc:"1"`
+	Children []*treeNode          `plenc:"2"`
+	Next     *treeNode            `plenc:"3"`
+	Named    map[string]*treeNode `plenc:"4"`
+	Other    *otherNode           `plenc:"5"`
+}
+
+// otherNode and treeNode refer to each other
+type otherNode struct {
+	Name string    `plenc:"1"`
+	Tree *treeNode `plenc:"2"`
+}
+
+func TestDescriptorRecursive(t *testing.T) {
+	c, err := plenc.CodecForType(reflect.TypeFor[treeNode]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	if diff := cmp.Diff(plenccodec.Descriptor{
+		Index: 3, Name: "Next", Type: plenccodec.FieldTypeRef, TypeName: "treeNode", ExplicitPresence: true,
+	}, d.Elements[2]); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(plenccodec.Descriptor{
+		Index: 2, Name: "Tree", Type: plenccodec.FieldTypeRef, TypeName: "treeNode", ExplicitPresence: true,
+	}, d.Elements[4].Elements[1]); diff != "" {
+		t.Fatal(diff)
+	}
+
+	in := treeNode{
+		Value: 1,
+		Children: []*treeNode{
+			{Value: 2, Next: &treeNode{Value: 3}},
+			{Value: 4, Children: []*treeNode{{Value: 5}}},
+		},
+		Other: &otherNode{Name: "seven", Tree: &treeNode{Value: 8}},
+	}
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var j plenccodec.JSONOutput
+	if err := d.Read(&j, data); err != nil {
+		t.Fatal(err)
+	}
+	expJSON := `{
+  "Value": 1,
+  "Children": [
+    {
+      "Value": 2,
+      "Next": {
+        "Value": 3
+      }
+    },
+    {
+      "Value": 4,
+      "Children": [
+        {
+          "Value": 5
+        }
+      ]
+    }
+  ],
+  "Other": {
+    "Name": "seven",
+    "Tree": {
+      "Value": 8
+    }
+  }
+}
+`
+	if diff := cmp.Diff(expJSON, string(j.Done())); diff != "" {
+		t.Fatal(diff)
+	}
+
+	data2, err := d.EncodeJSON(nil, []byte(expJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out treeNode
+	if err := plenc.Unmarshal(data2, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Fatal(diff)
+	}
+
+	data, err = plenc.Marshal(nil, &treeNode{Named: map[string]*treeNode{"six": {Value: 6}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := d.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]any{
+		"Named": map[string]any{"six": map[string]any{"Value": int64(6)}},
+	}, decoded); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// The codecs built along the way describe the full struct where it isn't
+	// enclosed by itself.
+	c, err = plenc.CodecForType(reflect.TypeFor[[]*treeNode]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elt := c.Descriptor().Elements[0]; elt.Type != plenccodec.FieldTypeStruct || elt.TypeName != "treeNode" {
+		t.Fatalf("unexpected descriptor %#v", elt)
+	}
+
+	// A reference must have an enclosing struct
+	bad := plenccodec.Descriptor{
+		Type:     plenccodec.FieldTypeStruct,
+		TypeName: "a",
+		Elements: []plenccodec.Descriptor{{Index: 1, Name: "B", Type: plenccodec.FieldTypeRef, TypeName: "b"}},
+	}
+	if err := bad.Read(&j, data); err == nil || err.Error() != `no enclosing struct "b" for reference "B"` {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// Descriptor is itself recursive, so descriptors can describe themselves.
+func TestDescriptorSelfDescribing(t *testing.T) {
+	c, err := plenc.CodecForType(reflect.TypeFor[plenccodec.Descriptor]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dd := c.Descriptor()
+
+	type sub struct {
+		A int `plenc:"1"`
+	}
+	type thing struct {
+		A string `plenc:"1"`
+		B []sub  `plenc:"2"`
+	}
+	tc, err := plenc.CodecForType(reflect.TypeFor[thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := tc.Descriptor()
+
+	data, err := plenc.Marshal(nil, &td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := dd.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]any{
+		"Type":     int64(plenccodec.FieldTypeStruct),
+		"TypeName": "thing",
+		"Elements": []any{
+			map[string]any{"Index": int64(1), "Name": "A", "Type": int64(plenccodec.FieldTypeString)},
+			map[string]any{
+				"Index": int64(2), "Name": "B", "Type": int64(plenccodec.FieldTypeSlice),
+				"Elements": []any{
+					map[string]any{
+						"Type":     int64(plenccodec.FieldTypeStruct),
+						"TypeName": "sub",
+						"Elements": []any{
+							// FieldTypeInt is zero, so isn't written
+							map[string]any{"Index": int64(1), "Name": "A"},
+						},
+					},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(exp, out); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// And the generic form can be encoded back into a Descriptor
+	data, err = dd.Encode(nil, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var td2 plenccodec.Descriptor
+	if err := plenc.Unmarshal(data, &td2); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(td, td2); diff != "" {
+		t.Fatal(diff)
+	}
+}
@@ -0,0 +1,682 @@
+package plenccodec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// Encode appends the plenc encoding of v to dst, using the Descriptor to
+// determine field indexes and wire types. This is the inverse of Decode, so v
+// should be a tree of generic values like those Decode returns.
+//
+//   - Structs and unions are map[string]any keyed by field name. A union has a
+//     single entry named after the type it holds.
+//   - Maps with string keys are map[string]any. Other maps are []any of
+//     map[string]any entries with "key" and "value" fields.
+//   - Slices are []any.
+//   - Numbers may be any Go integer or float type, or json.Number.
+//   - Times may be time.Time or RFC 3339 strings.
+//   - Strings and bytes may be string or []byte.
+//
+// Fields that are not in the descriptor are ignored. As when encoding Go
+// values, nil values are not written, and neither are zero values unless the
+// field has ExplicitPresence set.
+func (d *Descriptor) Encode(dst []byte, v any) ([]byte, error) {
+	if v == nil {
+		return dst, nil
+	}
+	r, err := d.resolved()
+	if err != nil {
+		return nil, err
+	}
+	var l lengths
+	dst, err = r.appendValue(&l, dst, v)
+	if err != nil {
+		return nil, err
+	}
+	return l.insert(dst), nil
+}
+
+// EncodeJSON converts JSON data to plenc, appending the plenc encoding to dst.
+// The JSON is expected to be in the form produced when reading plenc data
+// with JSONOutput. See Encode for details.
+func (d *Descriptor) EncodeJSON(dst []byte, data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON. %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return d.Encode(dst, v)
+}
+
+// wireType returns the wire type used to encode values described by d.
+func (d *Descriptor) wireType() plenccore.WireType {
+	switch d.Type {
+	case FieldTypeInt, FieldTypeFlatInt, FieldTypeUint, FieldTypeBool:
+		return plenccore.WTVarInt
+	case FieldTypeFloat32, FieldTypeFixed32, FieldTypeSFixed32:
+		return plenccore.WT32
+	case FieldTypeFloat64, FieldTypeFixed64, FieldTypeSFixed64:
+		return plenccore.WT64
+	case FieldTypeSlice:
+		if d.isPacked() {
+			return plenccore.WTLength
+		}
+		return plenccore.WTSlice
+	case FieldTypeJSONObject, FieldTypeJSONArray:
+		return plenccore.WTSlice
+	}
+	return plenccore.WTLength
+}
+
+// isPacked returns true if d is a slice whose elements are written one after
+// another in a WTLength field rather than using WTSlice.
+func (d *Descriptor) isPacked() bool {
+	if len(d.Elements) != 1 {
+		return false
+	}
+	switch d.Elements[0].wireType() {
+	case plenccore.WTVarInt, plenccore.WT32, plenccore.WT64:
+		return true
+	}
+	return false
+}
+
+// appendField appends v as a field, including its tag and, for WTLength
+// fields, its length.
+func (d *Descriptor) appendField(l *lengths, dst []byte, v any) ([]byte, error) {
+	wt := d.wireType()
+	dst = plenccore.AppendTag(dst, wt, d.Index)
+	if wt == plenccore.WTLength {
+		return d.appendWithLength(l, dst, v)
+	}
+	return d.appendValue(l, dst, v)
+}
+
+// appendWithLength appends the encoding of v, and records its length in l so
+// it can be inserted in front of it.
+func (d *Descriptor) appendWithLength(l *lengths, dst []byte, v any) ([]byte, error) {
+	i := len(l.prefixes)
+	l.prefixes = append(l.prefixes, lengthPrefix{offset: len(dst)})
+	start, size := len(dst), l.size
+
+	dst, err := d.appendValue(l, dst, v)
+	if err != nil {
+		return nil, err
+	}
+
+	// The length includes the lengths of any values nested within this one.
+	length := len(dst) - start + l.size - size
+	l.prefixes[i].length = length
+	l.size += plenccore.SizeVarUint(uint64(length))
+	return dst, nil
+}
+
+// lengths records the lengths of WTLength values while they are encoded. We
+// only know a length once the value has been written, so values are written
+// without their lengths and the lengths are inserted afterwards in a single
+// pass. Inserting each length as its value completes would move the data once
+// for every level of nesting.
+type lengths struct {
+	// prefixes are in the order the values start, which is also the order of
+	// their offsets.
+	prefixes []lengthPrefix
+	// size is the total size of the encoded lengths.
+	size int
+}
+
+type lengthPrefix struct {
+	// offset is where the value starts in the data as written.
+	offset int
+	length int
+}
+
+// insert inserts the lengths into data, which must be the data the lengths
+// were recorded for.
+func (l *lengths) insert(data []byte) []byte {
+	if len(l.prefixes) == 0 {
+		return data
+	}
+
+	// We work backwards from the end, so we never overwrite data we have yet
+	// to move.
+	r := len(data)
+	data = slices.Grow(data, l.size)[:len(data)+l.size]
+	w := len(data)
+	for i := len(l.prefixes) - 1; i >= 0; i-- {
+		p := l.prefixes[i]
+		w -= copy(data[w-(r-p.offset):w], data[p.offset:r])
+		s := plenccore.SizeVarUint(uint64(p.length))
+		w -= s
+		plenccore.AppendVarUint(data[w:w], uint64(p.length))
+		r = p.offset
+	}
+	return data
+}
+
+// appendValue appends the encoding of v without a tag or length.
+func (d *Descriptor) appendValue(l *lengths, dst []byte, v any) ([]byte, error) {
+	switch d.Type {
+	case FieldTypeInt:
+		switch d.LogicalType {
+		case LogicalTypeDuration:
+			if s, ok := v.(string); ok {
+				// Read outputs durations as strings like "1.5s"
+				dur, err := time.ParseDuration(s)
+				if err != nil {
+					return nil, err
+				}
+				v = int64(dur)
+			}
+		case LogicalTypeDecimal:
+			// Numbers and strings are both the decimal value, not the
+			// scaled int.
+			coefficient, exponent, err := toDecimal(v)
+			if err != nil {
+				return nil, err
+			}
+			if v, err = scaleInt(coefficient, exponent, d.Scale); err != nil {
+				return nil, err
+			}
+		}
+		i, err := toInt64(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return IntCodec[int64]{}.Append(dst, unsafe.Pointer(&i), nil), nil
+
+	case FieldTypeFlatInt:
+		if d.LogicalType == LogicalTypeTimestamp {
+			t, err := toTime(v)
+			if err != nil {
+				return nil, err
+			}
+			return BQTimestampCodec{}.Append(dst, unsafe.Pointer(&t), nil), nil
+		}
+		i, err := toInt64(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return FlatIntCodec[uint64]{}.Append(dst, unsafe.Pointer(&i), nil), nil
+
+	case FieldTypeUint:
+		u, err := toUint64(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return UintCodec[uint64]{}.Append(dst, unsafe.Pointer(&u), nil), nil
+
+	case FieldTypeFixed32:
+		u, err := toUint64(v, 32)
+		if err != nil {
+			return nil, err
+		}
+		u32 := uint32(u)
+		return Fixed32Codec[uint32]{}.Append(dst, unsafe.Pointer(&u32), nil), nil
+
+	case FieldTypeFixed64:
+		u, err := toUint64(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return Fixed64Codec[uint64]{}.Append(dst, unsafe.Pointer(&u), nil), nil
+
+	case FieldTypeSFixed32:
+		i, err := toInt64(v, 32)
+		if err != nil {
+			return nil, err
+		}
+		i32 := int32(i)
+		return SFixed32Codec[int32]{}.Append(dst, unsafe.Pointer(&i32), nil), nil
+
+	case FieldTypeSFixed64:
+		i, err := toInt64(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return SFixed64Codec[int64]{}.Append(dst, unsafe.Pointer(&i), nil), nil
+
+	case FieldTypeFloat32:
+		f, err := toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		f32 := float32(f)
+		return Float32Codec{}.Append(dst, unsafe.Pointer(&f32), nil), nil
+
+	case FieldTypeFloat64:
+		f, err := toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		return Float64Codec{}.Append(dst, unsafe.Pointer(&f), nil), nil
+
+	case FieldTypeString:
+		if d.LogicalType == LogicalTypeDecimal {
+			coefficient, exponent, err := toDecimal(v)
+			if err != nil {
+				return nil, err
+			}
+			return appendDecimal(dst, coefficient, int32(exponent)), nil
+		}
+		switch v := v.(type) {
+		case string:
+			// Read outputs some logical types in a readable form, which we
+			// convert back here.
+			return logicalBytes(dst, d.LogicalType, v)
+		case []byte:
+			return append(dst, v...), nil
+		}
+		return nil, fmt.Errorf("cannot encode %T as a string", v)
+
+	case FieldTypeBool:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as a bool", v)
+		}
+		return BoolCodec{}.Append(dst, unsafe.Pointer(&b), nil), nil
+
+	case FieldTypeTime:
+		t, err := toTime(v)
+		if err != nil {
+			return nil, err
+		}
+		return TimeCodec{}.Append(dst, unsafe.Pointer(&t), nil), nil
+
+	case FieldTypeProtoTimestamp:
+		t, err := toTime(v)
+		if err != nil {
+			return nil, err
+		}
+		return TimeCompatCodec{}.Append(dst, unsafe.Pointer(&t), nil), nil
+
+	case FieldTypeSlice:
+		return d.appendSlice(l, dst, v)
+
+	case FieldTypeStruct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as struct %s", v, d.TypeName)
+		}
+		return d.appendStruct(l, dst, m)
+
+	case FieldTypeUnion:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as union %s", v, d.TypeName)
+		}
+		return d.appendUnion(l, dst, m)
+
+	case FieldTypeJSONObject:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as a JSON object", v)
+		}
+		n, err := normaliseJSON(m)
+		if err != nil {
+			return nil, err
+		}
+		m = n.(map[string]any)
+		return JSONMapCodec{}.Append(dst, unpackEFace(m).data, nil), nil
+
+	case FieldTypeJSONArray:
+		a, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as a JSON array", v)
+		}
+		n, err := normaliseJSON(a)
+		if err != nil {
+			return nil, err
+		}
+		a = n.([]any)
+		return JSONArrayCodec{}.Append(dst, unsafe.Pointer(&a), nil), nil
+	}
+
+	return nil, fmt.Errorf("unrecognised field type %s", d.Type)
+}
+
+func (d *Descriptor) appendStruct(l *lengths, dst []byte, m map[string]any) ([]byte, error) {
+	for i := range d.Elements {
+		elt := &d.Elements[i]
+		v, ok := m[elt.Name]
+		if !ok || v == nil {
+			continue
+		}
+		if !elt.ExplicitPresence && elt.isZero(v) {
+			continue
+		}
+		var err error
+		dst, err = elt.appendField(l, dst, v)
+		if err != nil {
+			return nil, fmt.Errorf("failed encoding field %d(%s) of %s. %w", elt.Index, elt.Name, d.TypeName, err)
+		}
+	}
+	return dst, nil
+}
+
+func (d *Descriptor) appendUnion(l *lengths, dst []byte, m map[string]any) ([]byte, error) {
+	if len(m) > 1 {
+		return nil, fmt.Errorf("union %s must have a single entry, not %d", d.TypeName, len(m))
+	}
+	for name, v := range m {
+		for i := range d.Elements {
+			elt := &d.Elements[i]
+			if elt.Name != name {
+				continue
+			}
+			// The value is always written, even if it is zero, as the
+			// presence of the field tells us the type.
+			var err error
+			dst, err = elt.appendField(l, dst, v)
+			if err != nil {
+				return nil, fmt.Errorf("failed encoding %s in union %s. %w", name, d.TypeName, err)
+			}
+			return dst, nil
+		}
+		return nil, fmt.Errorf("%s is not a member of union %s", name, d.TypeName)
+	}
+	return dst, nil
+}
+
+func (d *Descriptor) appendSlice(l *lengths, dst []byte, v any) ([]byte, error) {
+	if len(d.Elements) != 1 {
+		return nil, fmt.Errorf("slice descriptor %s should have 1 element, has %d", d.Name, len(d.Elements))
+	}
+	elt := &d.Elements[0]
+
+	var a []any
+	switch v := v.(type) {
+	case []any:
+		a = v
+	case map[string]any:
+		if !d.isValidJSONMap() {
+			return nil, fmt.Errorf("cannot encode %T as slice %s", v, d.Name)
+		}
+		a = mapEntries(elt, v)
+	default:
+		return nil, fmt.Errorf("cannot encode %T as slice %s", v, d.Name)
+	}
+
+	var err error
+	if d.isPacked() {
+		for i, v := range a {
+			dst, err = elt.appendValue(l, dst, v)
+			if err != nil {
+				return nil, fmt.Errorf("failed encoding entry %d of %s. %w", i, d.Name, err)
+			}
+		}
+		return dst, nil
+	}
+
+	dst = plenccore.AppendVarUint(dst, uint64(len(a)))
+	for i, v := range a {
+		if v == nil {
+			dst = plenccore.AppendVarUint(dst, 0)
+			continue
+		}
+		dst, err = elt.appendWithLength(l, dst, v)
+		if err != nil {
+			return nil, fmt.Errorf("failed encoding entry %d of %s. %w", i, d.Name, err)
+		}
+	}
+	return dst, nil
+}
+
+// mapEntries converts a map[string]any into a list of map entries described by
+// elt. The entries are sorted by key so the encoding is deterministic.
+func mapEntries(elt *Descriptor, m map[string]any) []any {
+	key, value := elt.Elements[0].Name, elt.Elements[1].Name
+	a := make([]any, 0, len(m))
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		a = append(a, map[string]any{key: k, value: m[k]})
+	}
+	return a
+}
+
+// isZero returns true if v is the zero value for the type described by d.
+// Values that can't be converted to the type are not zero, so that the error
+// is reported when they are encoded.
+func (d *Descriptor) isZero(v any) bool {
+	switch d.Type {
+	case FieldTypeInt, FieldTypeSFixed32, FieldTypeSFixed64:
+		switch d.LogicalType {
+		case LogicalTypeDuration:
+			if s, ok := v.(string); ok {
+				dur, err := time.ParseDuration(s)
+				return err == nil && dur == 0
+			}
+		case LogicalTypeDecimal:
+			coefficient, _, err := toDecimal(v)
+			return err == nil && coefficient.Sign() == 0
+		}
+		i, err := toInt64(v, 64)
+		return err == nil && i == 0
+	case FieldTypeFlatInt:
+		if d.LogicalType == LogicalTypeTimestamp {
+			t, err := toTime(v)
+			return err == nil && t.IsZero()
+		}
+		i, err := toInt64(v, 64)
+		return err == nil && i == 0
+	case FieldTypeUint, FieldTypeFixed32, FieldTypeFixed64:
+		u, err := toUint64(v, 64)
+		return err == nil && u == 0
+	case FieldTypeFloat32, FieldTypeFloat64:
+		f, err := toFloat64(v)
+		return err == nil && f == 0
+	case FieldTypeString:
+		if d.LogicalType == LogicalTypeDecimal {
+			coefficient, _, err := toDecimal(v)
+			return err == nil && coefficient.Sign() == 0
+		}
+		switch v := v.(type) {
+		case string:
+			return v == ""
+		case []byte:
+			return len(v) == 0
+		}
+	case FieldTypeBool:
+		b, ok := v.(bool)
+		return ok && !b
+	case FieldTypeTime, FieldTypeProtoTimestamp:
+		t, err := toTime(v)
+		return err == nil && t.IsZero()
+	case FieldTypeSlice, FieldTypeJSONObject, FieldTypeJSONArray:
+		switch v := v.(type) {
+		case []any:
+			return len(v) == 0
+		case map[string]any:
+			return len(v) == 0
+		}
+	}
+	return false
+}
+
+func toInt64(v any, bits int) (int64, error) {
+	var i int64
+	switch v := v.(type) {
+	case int:
+		i = int64(v)
+	case int8:
+		i = int64(v)
+	case int16:
+		i = int64(v)
+	case int32:
+		i = int64(v)
+	case int64:
+		i = v
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d overflows int64", v)
+		}
+		i = int64(v)
+	case uint8:
+		i = int64(v)
+	case uint16:
+		i = int64(v)
+	case uint32:
+		i = int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d overflows int64", v)
+		}
+		i = int64(v)
+	case float32:
+		return toInt64(float64(v), bits)
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, fmt.Errorf("cannot convert %v to an integer", v)
+		}
+		i = int64(v)
+	case json.Number:
+		var err error
+		i, err = strconv.ParseInt(string(v), 10, bits)
+		if err != nil {
+			return 0, fmt.Errorf("cannot convert %s to an integer. %w", v, err)
+		}
+	default:
+		return 0, fmt.Errorf("cannot convert %T to an integer", v)
+	}
+	if bits < 64 && (i < -1<<(bits-1) || i >= 1<<(bits-1)) {
+		return 0, fmt.Errorf("value %d overflows int%d", i, bits)
+	}
+	return i, nil
+}
+
+func toUint64(v any, bits int) (uint64, error) {
+	var u uint64
+	switch v := v.(type) {
+	case uint:
+		u = uint64(v)
+	case uint8:
+		u = uint64(v)
+	case uint16:
+		u = uint64(v)
+	case uint32:
+		u = uint64(v)
+	case uint64:
+		u = v
+	case json.Number:
+		var err error
+		u, err = strconv.ParseUint(string(v), 10, bits)
+		if err != nil {
+			return 0, fmt.Errorf("cannot convert %s to an unsigned integer. %w", v, err)
+		}
+	case float32:
+		return toUint64(float64(v), bits)
+	case float64:
+		if v != math.Trunc(v) || v < 0 || v >= math.MaxUint64 {
+			return 0, fmt.Errorf("cannot convert %v to an unsigned integer", v)
+		}
+		u = uint64(v)
+	default:
+		i, err := toInt64(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot convert %T to an unsigned integer", v)
+		}
+		if i < 0 {
+			return 0, fmt.Errorf("cannot convert negative value %d to an unsigned integer", i)
+		}
+		u = uint64(i)
+	}
+	if bits < 64 && u >= 1<<bits {
+		return 0, fmt.Errorf("value %d overflows uint%d", u, bits)
+	}
+	return u, nil
+}
+
+func toFloat64(v any) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("cannot convert %s to a float. %w", v, err)
+		}
+		return f, nil
+	case uint, uint8, uint16, uint32, uint64:
+		u, err := toUint64(v, 64)
+		return float64(u), err
+	}
+	i, err := toInt64(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot convert %T to a float", v)
+	}
+	return float64(i), nil
+}
+
+func toTime(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("cannot convert %q to a time. %w", v, err)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot convert %T to a time", v)
+}
+
+// normaliseJSON converts a tree of generic values into the types supported by
+// JSONMapCodec and JSONArrayCodec.
+func normaliseJSON(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, string, int, float64, bool, json.Number:
+		return v, nil
+	case int8, int16, int32, int64, uint8, uint16, uint32:
+		i, err := toInt64(v, 64)
+		return int(i), err
+	case uint, uint64:
+		u, err := toUint64(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		if u > math.MaxInt64 {
+			return json.Number(strconv.FormatUint(u, 10)), nil
+		}
+		return int(u), nil
+	case float32:
+		return float64(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			var err error
+			if out[i], err = normaliseJSON(e); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			n, err := normaliseJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = n
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot encode %T as JSON", v)
+}
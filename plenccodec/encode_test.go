@@ -0,0 +1,311 @@
+package plenccodec_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+type encodeSub struct {
+	A int8   `plenc:"1"`
+	B string `plenc:"2"`
+}
+
+type encodeKey struct {
+	X int `plenc:"1"`
+	Y int `plenc:"2"`
+}
+
+type encodeThing struct {
+	A int                  `plenc:"1"`
+	B float32              `plenc:"2"`
+	C string               `plenc:"3"`
+	D uint                 `plenc:"4"`
+	E []float64            `plenc:"5"`
+	F []encodeSub          `plenc:"6"`
+	G *encodeSub           `plenc:"7"`
+	H time.Time            `plenc:"8"`
+	I bool                 `plenc:"9"`
+	J map[string]int       `plenc:"10"`
+	K []string             `plenc:"11"`
+	L []byte               `plenc:"12"`
+	M uint64               `plenc:"13,fixed"`
+	N []int32              `plenc:"14,fixed"`
+	O *int                 `plenc:"15"`
+	P int32                `plenc:"16,flat"`
+	Q []bool               `plenc:"17"`
+	R [][]int              `plenc:"18"`
+	S map[encodeKey]string `plenc:"19"`
+	T []time.Time          `plenc:"20"`
+	U float64              `plenc:"21"`
+}
+
+func encodeDescriptor(t testing.TB) plenccodec.Descriptor {
+	c, err := plenc.CodecForType(reflect.TypeFor[encodeThing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Descriptor()
+}
+
+func TestDescriptorEncode(t *testing.T) {
+	d := encodeDescriptor(t)
+
+	f := fuzz.New().Funcs(
+		func(out **encodeSub, cont fuzz.Continue) {
+			// We don't support having nil entries in slices of pointers
+			var v encodeSub
+			cont.Fuzz(&v)
+			*out = &v
+		},
+		func(out *time.Time, cont fuzz.Continue) {
+			*out = time.Unix(cont.Int63n(1<<40), cont.Int63n(1e9)).UTC()
+		},
+	)
+
+	for range 1000 {
+		var in encodeThing
+		f.Fuzz(&in)
+
+		data, err := plenc.Marshal(nil, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v, err := d.Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encoded, err := d.Encode(nil, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out encodeThing
+		if err := plenc.Unmarshal(encoded, &out); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in, out); diff != "" {
+			t.Fatal(diff)
+		}
+	}
+}
+
+type encodeNode struct {
+	Name string      `plenc:"1"`
+	Next *encodeNode `plenc:"2"`
+}
+
+func TestDescriptorEncodeDeep(t *testing.T) {
+	c, err := plenc.CodecForType(reflect.TypeFor[encodeNode]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	// Deep enough that the lengths of the outer values take several bytes.
+	in := &encodeNode{Name: string(make([]byte, 200))}
+	for i := range 300 {
+		in = &encodeNode{Name: strconv.Itoa(i), Next: in}
+	}
+
+	exp, err := plenc.Marshal(nil, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := d.Decode(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := d.Encode([]byte{1, 2, 3}, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(append([]byte{1, 2, 3}, exp...), data); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestDescriptorEncodeJSON(t *testing.T) {
+	d := encodeDescriptor(t)
+
+	seven := 7
+	in := encodeThing{
+		A: -1,
+		B: 1.5,
+		C: "hat",
+		D: 7,
+		E: []float64{1, 2.5},
+		F: []encodeSub{{A: 1, B: "one"}, {}},
+		G: &encodeSub{B: "ptr"},
+		H: time.Date(1970, 3, 15, 0, 0, 0, 1337e5, time.UTC),
+		I: true,
+		J: map[string]int{"one": 1, "zero": 0},
+		K: []string{"a", ""},
+		M: 1 << 60,
+		N: []int32{-1, 1},
+		O: &seven,
+		P: 12,
+		Q: []bool{true, false},
+		R: [][]int{{1, 2}, {}},
+		S: map[encodeKey]string{{X: 1}: "one"},
+		T: []time.Time{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var j plenccodec.JSONOutput
+	if err := d.Read(&j, data); err != nil {
+		t.Fatal(err)
+	}
+	// Check the JSON is valid, and normalise the formatting
+	var raw json.RawMessage
+	if err := json.Unmarshal(j.Done(), &raw); err != nil {
+		t.Fatal(err, string(j.Done()))
+	}
+
+	encoded, err := d.EncodeJSON(nil, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out encodeThing
+	if err := plenc.Unmarshal(encoded, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty nested slice reads back as nil
+	in.R[1] = nil
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestDescriptorEncodeExplicitPresence(t *testing.T) {
+	d := encodeDescriptor(t)
+
+	// Zero values are not written unless the field has explicit presence
+	data, err := d.Encode(nil, map[string]any{"A": 0, "C": "", "O": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out encodeThing
+	if err := plenc.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	zero := 0
+	if diff := cmp.Diff(encodeThing{O: &zero}, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestDescriptorEncodeUnion(t *testing.T) {
+	// Descriptors can't describe recursive types, so we don't include batch
+	var p plenc.Plenc
+	p.RegisterDefaultCodecs()
+	p.RegisterUnion(reflect.TypeFor[event](),
+		plenccodec.UnionMember{Index: 1, Type: reflect.TypeFor[click]()},
+		plenccodec.UnionMember{Index: 2, Type: reflect.TypeFor[*scroll]()},
+		plenccodec.UnionMember{Index: 3, Type: reflect.TypeFor[keyPress]()},
+	)
+	type wrapper struct {
+		Event event `plenc:"1"`
+	}
+	c, err := p.CodecForType(reflect.TypeFor[wrapper]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	tests := []struct {
+		in  map[string]any
+		exp wrapper
+	}{
+		{in: map[string]any{"Event": map[string]any{"click": map[string]any{"X": 1}}}, exp: wrapper{Event: click{X: 1}}},
+		{in: map[string]any{"Event": map[string]any{"scroll": map[string]any{}}}, exp: wrapper{Event: &scroll{}}},
+		{in: map[string]any{"Event": map[string]any{"keyPress": ""}}, exp: wrapper{Event: keyPress("")}},
+		{in: map[string]any{}, exp: wrapper{}},
+	}
+
+	for _, test := range tests {
+		data, err := d.Encode(nil, test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out wrapper
+		if err := p.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.exp, out); diff != "" {
+			t.Fatal(diff)
+		}
+	}
+}
+
+func TestDescriptorEncodeErrors(t *testing.T) {
+	d := encodeDescriptor(t)
+
+	tests := []struct {
+		name string
+		in   any
+		exp  string
+	}{
+		{
+			name: "not a struct",
+			in:   []any{1},
+			exp:  "cannot encode []interface {} as struct encodeThing",
+		},
+		{
+			name: "bad int",
+			in:   map[string]any{"A": "one"},
+			exp:  "failed encoding field 1(A) of encodeThing. cannot convert string to an integer",
+		},
+		{
+			name: "fractional int",
+			in:   map[string]any{"A": 1.5},
+			exp:  "failed encoding field 1(A) of encodeThing. cannot convert 1.5 to an integer",
+		},
+		{
+			name: "negative uint",
+			in:   map[string]any{"D": -1},
+			exp:  "failed encoding field 4(D) of encodeThing. cannot convert negative value -1 to an unsigned integer",
+		},
+		{
+			name: "overflow",
+			in:   map[string]any{"N": []any{json.Number("3000000000")}},
+			exp:  `failed encoding field 14(N) of encodeThing. failed encoding entry 0 of N. cannot convert 3000000000 to an integer. strconv.ParseInt: parsing "3000000000": value out of range`,
+		},
+		{
+			name: "bad time",
+			in:   map[string]any{"H": "yesterday"},
+			exp:  `failed encoding field 8(H) of encodeThing. cannot convert "yesterday" to a time. parsing time "yesterday" as "2006-01-02T15:04:05.999999999Z07:00": cannot parse "yesterday" as "2006"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := d.Encode(nil, test.in)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != test.exp {
+				t.Fatalf("error %q not as expected", err)
+			}
+		})
+	}
+
+	if _, err := d.EncodeJSON(nil, []byte(`{"A": 1} {}`)); err == nil {
+		t.Fatal("expected an error for trailing data")
+	}
+}
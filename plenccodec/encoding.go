@@ -0,0 +1,163 @@
+package plenccodec
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+var (
+	binaryMarshalerType   = reflect.TypeFor[encoding.BinaryMarshaler]()
+	binaryUnmarshalerType = reflect.TypeFor[encoding.BinaryUnmarshaler]()
+	textMarshalerType     = reflect.TypeFor[encoding.TextMarshaler]()
+	textUnmarshalerType   = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// IsBinaryMarshaler returns true if typ implements encoding.BinaryMarshaler
+// and encoding.BinaryUnmarshaler, with either value or pointer receivers.
+func IsBinaryMarshaler(typ reflect.Type) bool {
+	return implementsBoth(typ, binaryMarshalerType, binaryUnmarshalerType)
+}
+
+// IsTextMarshaler returns true if typ implements encoding.TextMarshaler and
+// encoding.TextUnmarshaler, with either value or pointer receivers.
+func IsTextMarshaler(typ reflect.Type) bool {
+	return implementsBoth(typ, textMarshalerType, textUnmarshalerType)
+}
+
+func implementsBoth(typ, marshaler, unmarshaler reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Interface:
+		return false
+	}
+	ptr := reflect.PointerTo(typ)
+	return ptr.Implements(marshaler) && ptr.Implements(unmarshaler)
+}
+
+// EncodingCodec encodes types that implement encoding.BinaryMarshaler or
+// encoding.TextMarshaler as WTLength data. Use BuildBinaryCodec or
+// BuildTextCodec to create one. Values whose memory is all zero are omitted.
+type EncodingCodec struct {
+	rtype reflect.Type
+	size  uintptr
+	// These are itabs for a pointer to the type, which has all the methods of
+	// the type whatever the receivers.
+	marshaler   unsafe.Pointer
+	unmarshaler unsafe.Pointer
+	text        bool
+}
+
+// BuildBinaryCodec builds a codec that encodes typ using its MarshalBinary and
+// UnmarshalBinary methods
+func BuildBinaryCodec(typ reflect.Type) (Codec, error) {
+	if !IsBinaryMarshaler(typ) {
+		return nil, fmt.Errorf("%s does not implement encoding.BinaryMarshaler and encoding.BinaryUnmarshaler", typ)
+	}
+	v := reflect.New(typ).Interface()
+	m, u := v.(encoding.BinaryMarshaler), v.(encoding.BinaryUnmarshaler)
+	return &EncodingCodec{
+		rtype:       typ,
+		size:        typ.Size(),
+		marshaler:   (*iface)(unsafe.Pointer(&m)).tab,
+		unmarshaler: (*iface)(unsafe.Pointer(&u)).tab,
+	}, nil
+}
+
+// BuildTextCodec builds a codec that encodes typ using its MarshalText and
+// UnmarshalText methods
+func BuildTextCodec(typ reflect.Type) (Codec, error) {
+	if !IsTextMarshaler(typ) {
+		return nil, fmt.Errorf("%s does not implement encoding.TextMarshaler and encoding.TextUnmarshaler", typ)
+	}
+	v := reflect.New(typ).Interface()
+	m, u := v.(encoding.TextMarshaler), v.(encoding.TextUnmarshaler)
+	return &EncodingCodec{
+		rtype:       typ,
+		size:        typ.Size(),
+		marshaler:   (*iface)(unsafe.Pointer(&m)).tab,
+		unmarshaler: (*iface)(unsafe.Pointer(&u)).tab,
+		text:        true,
+	}, nil
+}
+
+// marshal returns the encoded value. Errors can't be returned from Size or
+// Append, so we panic with an EncodeError, which Marshal turns back into an
+// error.
+func (c *EncodingCodec) marshal(ptr unsafe.Pointer) []byte {
+	var data []byte
+	var err error
+	if c.text {
+		var m encoding.TextMarshaler
+		i := (*iface)(unsafe.Pointer(&m))
+		i.tab, i.data = c.marshaler, ptr
+		data, err = m.MarshalText()
+	} else {
+		var m encoding.BinaryMarshaler
+		i := (*iface)(unsafe.Pointer(&m))
+		i.tab, i.data = c.marshaler, ptr
+		data, err = m.MarshalBinary()
+	}
+	if err != nil {
+		panic(EncodeError{Err: fmt.Errorf("failed to marshal %s. %w", c.rtype, err)})
+	}
+	return data
+}
+
+func (c *EncodingCodec) Omit(ptr unsafe.Pointer) bool {
+	return isZeroMemory(ptr, c.size)
+}
+
+func (c *EncodingCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	// The unmarshal methods may keep the data, so we give them a copy.
+	data = append([]byte(nil), data...)
+	if c.text {
+		var u encoding.TextUnmarshaler
+		i := (*iface)(unsafe.Pointer(&u))
+		i.tab, i.data = c.unmarshaler, ptr
+		err = u.UnmarshalText(data)
+	} else {
+		var u encoding.BinaryUnmarshaler
+		i := (*iface)(unsafe.Pointer(&u))
+		i.tab, i.data = c.unmarshaler, ptr
+		err = u.UnmarshalBinary(data)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to unmarshal %s. %w", c.rtype, err)
+	}
+	return len(data), nil
+}
+
+func (c *EncodingCodec) New() unsafe.Pointer {
+	return reflect.New(c.rtype).UnsafePointer()
+}
+
+func (c *EncodingCodec) WireType() plenccore.WireType {
+	return plenccore.WTLength
+}
+
+func (c *EncodingCodec) Descriptor() Descriptor {
+	if c.text {
+		return Descriptor{Type: FieldTypeString, LogicalType: LogicalTypeText}
+	}
+	return Descriptor{Type: FieldTypeString, LogicalType: LogicalTypeBinary}
+}
+
+func (c *EncodingCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	l := len(c.marshal(ptr))
+	if len(tag) != 0 {
+		l += len(tag) + plenccore.SizeVarUint(uint64(l))
+	}
+	return l
+}
+
+func (c *EncodingCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	v := c.marshal(ptr)
+	if len(tag) != 0 {
+		data = append(data, tag...)
+		data = plenccore.AppendVarUint(data, uint64(len(v)))
+	}
+	return append(data, v...)
+}
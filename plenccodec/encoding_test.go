@@ -0,0 +1,186 @@
+package plenccodec_test
+
+import (
+	"errors"
+	"math/big"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+func TestEncodingCodecs(t *testing.T) {
+	type thing struct {
+		A netip.Addr   `plenc:"1,text"`
+		B *big.Int     `plenc:"2,text"`
+		C []netip.Addr `plenc:"3,binary"`
+		D netip.Prefix `plenc:"4,binary"`
+		E netip.Addr   `plenc:"5,text"`
+	}
+
+	in := thing{
+		A: netip.MustParseAddr("192.168.0.1"),
+		B: big.NewInt(-12345678901234),
+		C: []netip.Addr{netip.MustParseAddr("::1"), netip.MustParseAddr("10.0.0.1")},
+		D: netip.MustParsePrefix("10.1.0.0/16"),
+	}
+
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out thing
+	if err := plenc.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out, cmp.Comparer(func(a, b netip.Addr) bool { return a == b }),
+		cmp.Comparer(func(a, b netip.Prefix) bool { return a == b }),
+		cmp.Comparer(func(a, b *big.Int) bool { return a.Cmp(b) == 0 }),
+	); diff != "" {
+		t.Fatal(diff)
+	}
+
+	c, err := plenc.CodecForType(reflect.TypeFor[thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+	if d.Elements[0].LogicalType != plenccodec.LogicalTypeText {
+		t.Fatalf("unexpected descriptor %#v", d.Elements[0])
+	}
+
+	var j plenccodec.JSONOutput
+	if err := d.Read(&j, data); err != nil {
+		t.Fatal(err)
+	}
+	expJSON := `{
+  "A": "192.168.0.1",
+  "B": "-12345678901234",
+  "C": [
+    "AAAAAAAAAAAAAAAAAAAAAQ==",
+    "CgAAAQ=="
+  ],
+  "D": "CgEAABA="
+}
+`
+	if diff := cmp.Diff(expJSON, string(j.Done())); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// Binary data is base64 encoded in JSON, and decoded again when encoding
+	// from JSON.
+	data2, err := d.EncodeJSON(nil, []byte(expJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = thing{}
+	if err := plenc.Unmarshal(data2, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.D != in.D {
+		t.Fatalf("prefix %s not as expected", out.D)
+	}
+
+	type bad struct {
+		A int `plenc:"1,text"`
+	}
+	_, err = plenc.CodecForType(reflect.TypeFor[bad]())
+	if err == nil || err.Error() != "failed to find codec for field 0 (A, \"text\") of bad. int does not implement the text marshaling interfaces" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestEncodingFallback(t *testing.T) {
+	// These types have no plenc codecs of their own.
+	type thing struct {
+		A netip.AddrPort `plenc:"1"`
+		B big.Float      `plenc:"2"`
+	}
+
+	var p plenc.Plenc
+	p.EncodingFallback = true
+	p.RegisterDefaultCodecs()
+
+	var in thing
+	in.A = netip.MustParseAddrPort("[fe80::1]:8080")
+	in.B.SetFloat64(4.25)
+
+	data, err := p.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out thing
+	if err := p.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.A != in.A || out.B.Cmp(&in.B) != 0 {
+		t.Fatalf("unexpected result %s %s", out.A, &out.B)
+	}
+
+	c, err := p.CodecForType(reflect.TypeFor[thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+	// netip.AddrPort implements BinaryMarshaler, which is preferred. big.Float
+	// only has text methods.
+	if d.Elements[0].LogicalType != plenccodec.LogicalTypeBinary || d.Elements[1].LogicalType != plenccodec.LogicalTypeText {
+		t.Fatalf("unexpected descriptor %#v", d)
+	}
+}
+
+type failingMarshaler struct {
+	A int
+}
+
+var errFailingMarshaler = errors.New("cannot marshal")
+
+func (f failingMarshaler) MarshalBinary() ([]byte, error) {
+	if f.A < 0 {
+		return nil, errFailingMarshaler
+	}
+	return []byte{byte(f.A)}, nil
+}
+
+func (f *failingMarshaler) UnmarshalBinary(data []byte) error {
+	f.A = int(data[0])
+	return nil
+}
+
+func TestEncodingCodecError(t *testing.T) {
+	type thing struct {
+		A failingMarshaler `plenc:"1,binary"`
+	}
+
+	data, err := plenc.Marshal(nil, &thing{A: failingMarshaler{A: 7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out thing
+	if err := plenc.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.A.A != 7 {
+		t.Fatalf("unexpected value %d", out.A.A)
+	}
+
+	// Zero values are omitted without being marshaled
+	data, err = plenc.Marshal(nil, &thing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("unexpected data %x", data)
+	}
+
+	_, err = plenc.Marshal(nil, &thing{A: failingMarshaler{A: -1}})
+	if !errors.Is(err, errFailingMarshaler) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if exp := "failed to marshal plenccodec_test.failingMarshaler. cannot marshal"; err.Error() != exp {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -17,15 +17,26 @@ func _() {
 	_ = x[FieldTypeStruct-6]
 	_ = x[FieldTypeBool-7]
 	_ = x[FieldTypeTime-8]
+	_ = x[FieldTypeJSONObject-9]
+	_ = x[FieldTypeJSONArray-10]
+	_ = x[FieldTypeFlatInt-11]
+	_ = x[FieldTypeUnion-12]
+	_ = x[FieldTypeFixed32-13]
+	_ = x[FieldTypeFixed64-14]
+	_ = x[FieldTypeSFixed32-15]
+	_ = x[FieldTypeSFixed64-16]
+	_ = x[FieldTypeProtoTimestamp-17]
+	_ = x[FieldTypeRef-18]
 }
 
-const _FieldType_name = "FieldTypeIntFieldTypeUintFieldTypeFloat32FieldTypeFloat64FieldTypeStringFieldTypeSliceFieldTypeStructFieldTypeBoolFieldTypeTime"
+const _FieldType_name = "FieldTypeIntFieldTypeUintFieldTypeFloat32FieldTypeFloat64FieldTypeStringFieldTypeSliceFieldTypeStructFieldTypeBoolFieldTypeTimeFieldTypeJSONObjectFieldTypeJSONArrayFieldTypeFlatIntFieldTypeUnionFieldTypeFixed32FieldTypeFixed64FieldTypeSFixed32FieldTypeSFixed64FieldTypeProtoTimestampFieldTypeRef"
 
-var _FieldType_index = [...]uint8{0, 12, 25, 41, 57, 72, 86, 101, 114, 127}
+var _FieldType_index = [...]uint16{0, 12, 25, 41, 57, 72, 86, 101, 114, 127, 146, 164, 180, 194, 210, 226, 243, 260, 283, 295}
 
 func (i FieldType) String() string {
-	if i < 0 || i >= FieldType(len(_FieldType_index)-1) {
+	idx := int(i) - 0
+	if i < 0 || idx >= len(_FieldType_index)-1 {
 		return "FieldType(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
-	return _FieldType_name[_FieldType_index[i]:_FieldType_index[i+1]]
+	return _FieldType_name[_FieldType_index[idx]:_FieldType_index[idx+1]]
 }
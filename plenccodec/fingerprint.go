@@ -0,0 +1,80 @@
+package plenccodec
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// AppendCanonical appends a compact canonical binary form of the descriptor
+// to data. The canonical form holds only what affects how data is encoded and
+// interpreted: the Type, LogicalType, Precision, Scale and ExplicitPresence of
+// each descriptor, and the Index of each element. Names are left out, and the
+// elements of structs and unions are sorted by Index, so the order Go fields
+// are declared in does not matter. Strings and byte slices are encoded
+// identically, so both are written with LogicalTypeNone.
+//
+// Each descriptor is written as varints: Type, LogicalType, Precision, Scale
+// (zig-zag encoded), ExplicitPresence (1 if set, otherwise 0) and the number
+// of elements. Each element follows as its Index then its own canonical form.
+// In place of elements, a FieldTypeRef has the number of enclosing structs
+// between it and the struct it refers to, counting that struct as 1, or 0 if
+// there is no such struct.
+func (d *Descriptor) AppendCanonical(data []byte) []byte {
+	return d.appendCanonical(data, nil)
+}
+
+// Fingerprint returns a hash of the canonical form of the descriptor. Two
+// descriptors have the same fingerprint if they describe the same encoding,
+// whatever the names of their types and fields. See AppendCanonical.
+func (d *Descriptor) Fingerprint() uint64 {
+	sum := sha256.Sum256(d.AppendCanonical(nil))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// appendCanonical appends the canonical form of d. scope holds the enclosing
+// structs, which references may refer to.
+func (d *Descriptor) appendCanonical(data []byte, scope []*Descriptor) []byte {
+	logicalType := d.LogicalType
+	if isPlainString(d) {
+		logicalType = LogicalTypeNone
+	}
+	data = plenccore.AppendVarUint(data, uint64(d.Type))
+	data = plenccore.AppendVarUint(data, uint64(logicalType))
+	data = plenccore.AppendVarUint(data, uint64(d.Precision))
+	data = plenccore.AppendVarInt(data, int64(d.Scale))
+	var presence uint64
+	if d.ExplicitPresence {
+		presence = 1
+	}
+	data = plenccore.AppendVarUint(data, presence)
+
+	if d.Type == FieldTypeRef {
+		var depth int
+		for i, s := range slices.Backward(scope) {
+			if s.TypeName == d.TypeName {
+				depth = len(scope) - i
+				break
+			}
+		}
+		return plenccore.AppendVarUint(data, uint64(depth))
+	}
+	if d.Type == FieldTypeStruct && d.TypeName != "" {
+		scope = append(scope, d)
+	}
+
+	elts := d.Elements
+	if d.Type == FieldTypeStruct || d.Type == FieldTypeUnion {
+		elts = slices.Clone(elts)
+		slices.SortStableFunc(elts, func(a, b Descriptor) int { return a.Index - b.Index })
+	}
+
+	data = plenccore.AppendVarUint(data, uint64(len(elts)))
+	for i := range elts {
+		data = plenccore.AppendVarUint(data, uint64(elts[i].Index))
+		data = elts[i].appendCanonical(data, scope)
+	}
+	return data
+}
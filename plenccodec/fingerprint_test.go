@@ -0,0 +1,204 @@
+package plenccodec_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+// renamedTree is treeNode with different names and field order
+type renamedTree struct {
+	Link  *renamedTree            `plenc:"3"`
+	Kids  []*renamedTree          `plenc:"2"`
+	Alt   *renamedOther           `plenc:"5"`
+	Count int                     `plenc:"1"`
+	ByKey map[string]*renamedTree `plenc:"4"`
+}
+
+type renamedOther struct {
+	Back  *renamedTree `plenc:"2"`
+	Label string       `plenc:"1"`
+}
+
+func fingerprintFor[T any](t *testing.T) uint64 {
+	t.Helper()
+	c, err := plenc.CodecForType(reflect.TypeFor[T]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+	return d.Fingerprint()
+}
+
+func TestFingerprint(t *testing.T) {
+	type base struct {
+		A int     `plenc:"1"`
+		B string  `plenc:"2"`
+		C []int32 `plenc:"3"`
+	}
+	type renamed struct {
+		Z []int32 `plenc:"3"`
+		X int     `plenc:"1"`
+		Y string  `plenc:"2"`
+	}
+	type pointers struct {
+		A *int     `plenc:"1"`
+		B *string  `plenc:"2"`
+		C []*int32 `plenc:"3"`
+	}
+	type newIndex struct {
+		A int     `plenc:"1"`
+		B string  `plenc:"4"`
+		C []int32 `plenc:"3"`
+	}
+	type newType struct {
+		A uint    `plenc:"1"`
+		B string  `plenc:"2"`
+		C []int32 `plenc:"3"`
+	}
+	type newLogicalType struct {
+		A time.Duration `plenc:"1"`
+		B string        `plenc:"2"`
+		C []int32       `plenc:"3"`
+	}
+	type newScale struct {
+		A int     `plenc:"1,decimal=2"`
+		B string  `plenc:"2"`
+		C []int32 `plenc:"3"`
+	}
+	type extraField struct {
+		A int     `plenc:"1"`
+		B string  `plenc:"2"`
+		C []int32 `plenc:"3"`
+		D bool    `plenc:"4"`
+	}
+
+	fp := fingerprintFor[base](t)
+	if got := fingerprintFor[renamed](t); got != fp {
+		t.Errorf("names and field order changed the fingerprint")
+	}
+	// Pointers give fields explicit presence, which CheckCompatible treats
+	// as a change, so they change the fingerprint.
+	for name, got := range map[string]uint64{
+		"presence":     fingerprintFor[pointers](t),
+		"index":        fingerprintFor[newIndex](t),
+		"type":         fingerprintFor[newType](t),
+		"logical type": fingerprintFor[newLogicalType](t),
+		"scale":        fingerprintFor[newScale](t),
+		"extra field":  fingerprintFor[extraField](t),
+	} {
+		if got == fp {
+			t.Errorf("changing the %s did not change the fingerprint", name)
+		}
+	}
+}
+
+func TestFingerprintExplicitPresence(t *testing.T) {
+	// CheckCompatible treats these as incompatible, so they must not share a
+	// fingerprint.
+	old := plenccodec.Descriptor{Type: plenccodec.FieldTypeStruct, Elements: []plenccodec.Descriptor{
+		{Index: 1, Name: "A", Type: plenccodec.FieldTypeInt},
+	}}
+	new := plenccodec.Descriptor{Type: plenccodec.FieldTypeStruct, Elements: []plenccodec.Descriptor{
+		{Index: 1, Name: "A", Type: plenccodec.FieldTypeInt, ExplicitPresence: true},
+	}}
+	if problems := plenccodec.CheckCompatible(old, new); len(problems) == 0 {
+		t.Fatal("expected the descriptors to be incompatible")
+	}
+	if old.Fingerprint() == new.Fingerprint() {
+		t.Fatal("explicit presence did not change the fingerprint")
+	}
+}
+
+func TestFingerprintBytes(t *testing.T) {
+	// Descriptors of byte slices saved before LogicalTypeBytes was added have
+	// no logical type. They must still match current descriptors.
+	type thing struct {
+		A []byte `plenc:"1"`
+	}
+	new := descriptorFor[thing](t)
+	if new.Elements[0].LogicalType != plenccodec.LogicalTypeBytes {
+		t.Fatalf("expected LogicalTypeBytes, got %s", new.Elements[0].LogicalType)
+	}
+	old := plenccodec.Descriptor{Type: plenccodec.FieldTypeStruct, TypeName: "thing", Elements: []plenccodec.Descriptor{
+		{Index: 1, Name: "A", Type: plenccodec.FieldTypeString},
+	}}
+	if problems := plenccodec.CheckCompatible(old, new); problems != nil {
+		t.Fatal(problems)
+	}
+	if old.Fingerprint() != new.Fingerprint() {
+		t.Fatal("LogicalTypeBytes changed the fingerprint")
+	}
+}
+
+func TestFingerprintRecursive(t *testing.T) {
+	if fingerprintFor[treeNode](t) != fingerprintFor[renamedTree](t) {
+		t.Errorf("names and field order changed the fingerprint")
+	}
+
+	// The reference in the inner struct can refer to either struct.
+	inner := plenccodec.Descriptor{
+		Type:     plenccodec.FieldTypeStruct,
+		TypeName: "inner",
+		Elements: []plenccodec.Descriptor{
+			{Index: 1, Type: plenccodec.FieldTypeRef, TypeName: "outer"},
+		},
+	}
+	outer := plenccodec.Descriptor{
+		Type:     plenccodec.FieldTypeStruct,
+		TypeName: "outer",
+		Elements: []plenccodec.Descriptor{
+			{Index: 1, Type: plenccodec.FieldTypeStruct, TypeName: "inner", Elements: inner.Elements},
+		},
+	}
+	toOuter := outer.Fingerprint()
+	outer.Elements[0].Elements = []plenccodec.Descriptor{
+		{Index: 1, Type: plenccodec.FieldTypeRef, TypeName: "inner"},
+	}
+	if outer.Fingerprint() == toOuter {
+		t.Errorf("references to different structs have the same fingerprint")
+	}
+}
+
+func TestAppendCanonical(t *testing.T) {
+	type sub struct {
+		A bool `plenc:"1"`
+	}
+	type my struct {
+		B sub   `plenc:"7"`
+		A int64 `plenc:"2,decimal=2"`
+	}
+
+	c, err := plenc.CodecForType(reflect.TypeFor[my]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	exp := []byte{
+		byte(plenccodec.FieldTypeStruct), 0, 0, 0, 0, 2,
+		2, byte(plenccodec.FieldTypeInt), byte(plenccodec.LogicalTypeDecimal), 18, 4, 0, 0,
+		7, byte(plenccodec.FieldTypeStruct), 0, 0, 0, 0, 1,
+		1, byte(plenccodec.FieldTypeBool), 0, 0, 0, 0, 0,
+	}
+	if diff := cmp.Diff(exp, d.AppendCanonical(nil)); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// The canonical form survives a round trip through plenc
+	data, err := plenc.Marshal(nil, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out plenccodec.Descriptor
+	if err := plenc.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Fingerprint() != d.Fingerprint() {
+		t.Fatal("fingerprint changed after round trip")
+	}
+}
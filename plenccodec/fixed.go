@@ -0,0 +1,140 @@
+package plenccodec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// Fixed32Codec is a codec for unsigned 32 bit integers that always encodes them
+// in 4 bytes. This matches protobuf's fixed32 type, and is more efficient than
+// a varint if the values are typically large (e.g. hashes).
+type Fixed32Codec[T uint32] struct{}
+
+// append encodes a uint32
+func (Fixed32Codec[T]) append(data []byte, ptr unsafe.Pointer) []byte {
+	return binary.LittleEndian.AppendUint32(data, uint32(*(*T)(ptr)))
+}
+
+// Read decodes a uint32
+func (Fixed32Codec[T]) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if l := len(data); l < 4 {
+		if l == 0 {
+			*(*T)(ptr) = 0
+			return 0, nil
+		}
+		return 0, fmt.Errorf("not enough data to read a fixed32. Have %d bytes", l)
+	}
+	*(*T)(ptr) = T(binary.LittleEndian.Uint32(data))
+	return 4, nil
+}
+
+// New creates a pointer to a new uint32
+func (Fixed32Codec[T]) New() unsafe.Pointer {
+	return unsafe.Pointer(new(T))
+}
+
+// WireType returns the wire type used to encode this type
+func (Fixed32Codec[T]) WireType() plenccore.WireType {
+	return plenccore.WT32
+}
+
+// Omit indicates whether this field should be omitted
+func (Fixed32Codec[T]) Omit(ptr unsafe.Pointer) bool {
+	return *(*T)(ptr) == 0
+}
+
+func (Fixed32Codec[T]) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeFixed32}
+}
+
+func (Fixed32Codec[T]) Size(ptr unsafe.Pointer, tag []byte) int {
+	return 4 + len(tag)
+}
+
+func (c Fixed32Codec[T]) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	data = append(data, tag...)
+	return c.append(data, ptr)
+}
+
+// Fixed64Codec is a codec for unsigned 64 bit integers that always encodes them
+// in 8 bytes. This matches protobuf's fixed64 type.
+type Fixed64Codec[T uint | uint64] struct{}
+
+// append encodes a uint64
+func (Fixed64Codec[T]) append(data []byte, ptr unsafe.Pointer) []byte {
+	return binary.LittleEndian.AppendUint64(data, uint64(*(*T)(ptr)))
+}
+
+// Read decodes a uint64
+func (Fixed64Codec[T]) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if l := len(data); l < 8 {
+		if l == 0 {
+			*(*T)(ptr) = 0
+			return 0, nil
+		}
+		return 0, fmt.Errorf("not enough data to read a fixed64. Have %d bytes", l)
+	}
+	*(*T)(ptr) = T(binary.LittleEndian.Uint64(data))
+	return 8, nil
+}
+
+// New creates a pointer to a new uint64
+func (Fixed64Codec[T]) New() unsafe.Pointer {
+	return unsafe.Pointer(new(T))
+}
+
+// WireType returns the wire type used to encode this type
+func (Fixed64Codec[T]) WireType() plenccore.WireType {
+	return plenccore.WT64
+}
+
+// Omit indicates whether this field should be omitted
+func (Fixed64Codec[T]) Omit(ptr unsafe.Pointer) bool {
+	return *(*T)(ptr) == 0
+}
+
+func (Fixed64Codec[T]) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeFixed64}
+}
+
+func (Fixed64Codec[T]) Size(ptr unsafe.Pointer, tag []byte) int {
+	return 8 + len(tag)
+}
+
+func (c Fixed64Codec[T]) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	data = append(data, tag...)
+	return c.append(data, ptr)
+}
+
+// SFixed32Codec is a codec for signed 32 bit integers that always encodes them
+// in 4 bytes. This matches protobuf's sfixed32 type.
+type SFixed32Codec[T int32] struct {
+	Fixed32Codec[uint32]
+}
+
+// New creates a pointer to a new int32
+func (SFixed32Codec[T]) New() unsafe.Pointer {
+	return unsafe.Pointer(new(T))
+}
+
+func (SFixed32Codec[T]) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeSFixed32}
+}
+
+// SFixed64Codec is a codec for signed 64 bit integers that always encodes them
+// in 8 bytes. This matches protobuf's sfixed64 type.
+type SFixed64Codec[T int | int64] struct {
+	Fixed64Codec[uint64]
+}
+
+// New creates a pointer to a new int64
+func (SFixed64Codec[T]) New() unsafe.Pointer {
+	return unsafe.Pointer(new(T))
+}
+
+func (SFixed64Codec[T]) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeSFixed64}
+}
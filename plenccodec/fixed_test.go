@@ -0,0 +1,123 @@
+package plenccodec_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+	"github.com/philpearl/plenc/plenccore"
+)
+
+type fixedInts struct {
+	A int      `plenc:"1,fixed"`
+	B int32    `plenc:"2,fixed"`
+	C int64    `plenc:"3,fixed"`
+	D uint     `plenc:"4,fixed"`
+	E uint32   `plenc:"5,fixed"`
+	F uint64   `plenc:"6,fixed"`
+	G []int32  `plenc:"7,fixed"`
+	H []uint64 `plenc:"8,fixed"`
+	I [2]int64 `plenc:"9,fixed"`
+	J *uint32  `plenc:"10,fixed"`
+}
+
+func TestFixed(t *testing.T) {
+	f := fuzz.New()
+	for range 1000 {
+		var in fixedInts
+		f.Fuzz(&in)
+
+		data, err := plenc.Marshal(nil, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out fixedInts
+		if err := plenc.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(in, out); diff != "" {
+			t.Fatalf("not as expected. %s", diff)
+		}
+	}
+}
+
+func TestFixedEncoding(t *testing.T) {
+	in := fixedInts{
+		B: -2,
+		F: math.MaxUint64 - 1,
+		H: []uint64{1, 2},
+	}
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var exp []byte
+	exp = plenccore.AppendTag(exp, plenccore.WT32, 2)
+	exp = append(exp, 0xfe, 0xff, 0xff, 0xff)
+	exp = plenccore.AppendTag(exp, plenccore.WT64, 6)
+	exp = append(exp, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	exp = plenccore.AppendTag(exp, plenccore.WTLength, 8)
+	exp = append(exp, 16, 1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0)
+
+	if diff := cmp.Diff(exp, data); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestFixedProto(t *testing.T) {
+	// This is a protobuf message with a fixed64 id and a packed repeated
+	// sfixed32.
+	//
+	//	message M {
+	//	  fixed64 id = 1;
+	//	  repeated sfixed32 values = 2;
+	//	}
+	var data []byte
+	data = plenccore.AppendTag(data, plenccore.WT64, 1)
+	data = append(data, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11)
+	data = plenccore.AppendTag(data, plenccore.WTLength, 2)
+	data = append(data, 8, 0xff, 0xff, 0xff, 0xff, 3, 0, 0, 0)
+
+	type m struct {
+		ID     uint64  `plenc:"1,fixed"`
+		Values []int32 `plenc:"2,fixed"`
+	}
+
+	var out m
+	if err := plenc.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	exp := m{ID: 0x1122334455667788, Values: []int32{-1, 3}}
+	if diff := cmp.Diff(exp, out); diff != "" {
+		t.Fatal(diff)
+	}
+
+	c, err := plenc.CodecForType(reflect.TypeFor[m]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	var j plenccodec.JSONOutput
+	if err := d.Read(&j, data); err != nil {
+		t.Fatal(err)
+	}
+	expJSON := `{
+  "ID": 1234605616436508552,
+  "Values": [
+    -1,
+    3
+  ]
+}
+`
+	if diff := cmp.Diff(expJSON, string(j.Done())); diff != "" {
+		t.Fatal(diff)
+	}
+}
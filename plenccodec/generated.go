@@ -0,0 +1,103 @@
+package plenccodec
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// Generated is implemented by struct types that have codec methods written by
+// cmd/plenccodegen. The methods are implemented on the pointer type. They
+// encode and decode exactly as the codec built by BuildStructCodec does, but
+// without reflection or a Codec call per field. The methods are named so that
+// generated types don't implement PlencMarshaler or PlencUnmarshaler.
+type Generated interface {
+	// PlencGeneratedSize returns the number of bytes PlencGeneratedMarshal
+	// will append
+	PlencGeneratedSize() int
+	// PlencGeneratedMarshal appends the encoded struct to data
+	PlencGeneratedMarshal(data []byte) []byte
+	// PlencGeneratedUnmarshal decodes data into the struct
+	PlencGeneratedUnmarshal(data []byte) error
+}
+
+var generatedType = reflect.TypeFor[Generated]()
+
+// GeneratedCodec is a codec for a struct type with generated codec methods.
+// Underlying is the reflective codec for the type. It provides the methods
+// that aren't generated, such as Descriptor.
+type GeneratedCodec struct {
+	Underlying Codec
+	itab       unsafe.Pointer
+}
+
+// BuildGeneratedCodec builds a codec that uses the generated codec methods of
+// typ, which must be a struct type whose pointer type implements Generated.
+func BuildGeneratedCodec(typ reflect.Type, underlying Codec) (Codec, error) {
+	if !reflect.PointerTo(typ).Implements(generatedType) {
+		return nil, fmt.Errorf("%s does not have generated plenc methods", typ)
+	}
+
+	// We save the itab so we can build a Generated for any pointer to the type
+	// without going through reflect.
+	g := reflect.New(typ).Interface().(Generated)
+	return &GeneratedCodec{
+		Underlying: underlying,
+		itab:       (*iface)(unsafe.Pointer(&g)).tab,
+	}, nil
+}
+
+// IsGenerated returns true if typ has generated codec methods
+func IsGenerated(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct && reflect.PointerTo(typ).Implements(generatedType)
+}
+
+func (c *GeneratedCodec) generated(ptr unsafe.Pointer) Generated {
+	var g Generated
+	i := (*iface)(unsafe.Pointer(&g))
+	i.tab = c.itab
+	i.data = ptr
+	return g
+}
+
+func (c *GeneratedCodec) Omit(ptr unsafe.Pointer) bool {
+	return c.Underlying.Omit(ptr)
+}
+
+func (c *GeneratedCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if err := c.generated(ptr).PlencGeneratedUnmarshal(data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (c *GeneratedCodec) New() unsafe.Pointer {
+	return c.Underlying.New()
+}
+
+func (c *GeneratedCodec) WireType() plenccore.WireType {
+	return plenccore.WTLength
+}
+
+func (c *GeneratedCodec) Descriptor() Descriptor {
+	return c.Underlying.Descriptor()
+}
+
+func (c *GeneratedCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	l := c.generated(ptr).PlencGeneratedSize()
+	if len(tag) != 0 {
+		l += len(tag) + plenccore.SizeVarUint(uint64(l))
+	}
+	return l
+}
+
+func (c *GeneratedCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	g := c.generated(ptr)
+	if len(tag) != 0 {
+		data = append(data, tag...)
+		data = plenccore.AppendVarUint(data, uint64(g.PlencGeneratedSize()))
+	}
+	return g.PlencGeneratedMarshal(data)
+}
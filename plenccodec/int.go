@@ -68,6 +68,36 @@ func (c FlatIntCodec[T]) Descriptor() Descriptor {
 	return Descriptor{Type: FieldTypeFlatInt}
 }
 
+// ProtoIntCodec is for signed ints encoded as protobuf encodes int32 and
+// int64: as varints that aren't zig-zag encoded, with negative values sign
+// extended to 64 bits. The data can be read by a FlatIntCodec. It is used for
+// the elements of slices with the flatelems option.
+type ProtoIntCodec[T int | int8 | int16 | int32 | int64] struct {
+	IntCodec[T]
+}
+
+func (c ProtoIntCodec[T]) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	i, n := plenccore.ReadVarUint(data)
+	if n < 0 {
+		return 0, fmt.Errorf("corrupt var int")
+	}
+	*(*T)(ptr) = T(i)
+	return n, nil
+}
+
+func (c ProtoIntCodec[T]) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeFlatInt}
+}
+
+func (c ProtoIntCodec[T]) Size(ptr unsafe.Pointer, tag []byte) int {
+	return plenccore.SizeVarUint(uint64(*(*T)(ptr))) + len(tag)
+}
+
+func (c ProtoIntCodec[T]) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	data = append(data, tag...)
+	return plenccore.AppendVarUint(data, uint64(*(*T)(ptr)))
+}
+
 // UintCodec is a coddec for a uint
 type UintCodec[T uint | uint8 | uint16 | uint32 | uint64] struct{}
 
@@ -114,6 +114,93 @@ func TestInts(t *testing.T) {
 	}
 }
 
+func TestFlatElems(t *testing.T) {
+	type my struct {
+		A []int32  `plenc:"1,flat"`
+		B []int32  `plenc:"2,flatelems"`
+		C [2]int64 `plenc:"3,flatelems"`
+	}
+
+	in := my{
+		A: []int32{-1},
+		B: []int32{-1},
+		C: [2]int64{1, -1},
+	}
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The flat option is ignored for slices, so A is zig-zag encoded. B is
+	// sign extended to 64 bits, as protobuf does for repeated int32.
+	exp := []byte{
+		0x0a, 1, 1,
+		0x12, 10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+		0x1a, 11, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+	}
+	if diff := cmp.Diff(exp, data); diff != "" {
+		t.Fatal(diff)
+	}
+
+	var out my
+	if err := plenc.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestFlatElemsProto(t *testing.T) {
+	type my struct {
+		A []int32 `plenc:"1,flatelems"`
+		B []int64 `plenc:"2,flatelems"`
+	}
+
+	// This is how protobuf encodes repeated int32 a = 1 and repeated int64
+	// b = 2 with the values [-1, 2, math.MinInt32]. Negative values are sign
+	// extended to 64 bits.
+	proto := []byte{
+		0x0a, 21,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+		0x02,
+		0x80, 0x80, 0x80, 0x80, 0xf8, 0xff, 0xff, 0xff, 0xff, 0x01,
+		0x12, 21,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+		0x02,
+		0x80, 0x80, 0x80, 0x80, 0xf8, 0xff, 0xff, 0xff, 0xff, 0x01,
+	}
+	in := my{
+		A: []int32{-1, 2, math.MinInt32},
+		B: []int64{-1, 2, math.MinInt32},
+	}
+
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(proto, data); diff != "" {
+		t.Fatal(diff)
+	}
+
+	var out my
+	if err := plenc.Unmarshal(proto, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// Negative int32 values written as 32 bit values can still be read.
+	out = my{}
+	if err := plenc.Unmarshal([]byte{0x0a, 6, 0xff, 0xff, 0xff, 0xff, 0x0f, 0x02}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(my{A: []int32{-1, 2}}, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func TestZigZag(t *testing.T) {
 	tests := []struct {
 		in  int64
@@ -0,0 +1,277 @@
+package plenccodec
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// UnionMember associates a concrete type that may be held in an interface with
+// the index used to identify it in the encoding. As with struct field indexes,
+// the index for a type must not be changed or re-used once data has been
+// written.
+type UnionMember struct {
+	Index int
+	Type  reflect.Type
+}
+
+// BuildInterfaceCodec builds a codec for the interface type typ. Values are
+// encoded as a tagged union: a WTLength message containing a single field. The
+// index of the field identifies the concrete type of the value, and the field
+// contains the value encoded with the codec for that type. This is very like a
+// protobuf oneof.
+func BuildInterfaceCodec(p CodecBuilder, registry CodecRegistry, typ reflect.Type, members []UnionMember) (Codec, error) {
+	if typ.Kind() != reflect.Interface {
+		return nil, fmt.Errorf("type must be an interface to build an interface codec")
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("no concrete types registered for interface %s", typ)
+	}
+
+	c := InterfaceCodec{
+		rtype:   typ,
+		members: make([]unionMember, len(members)),
+	}
+
+	var maxIndex int
+	for i, m := range members {
+		if m.Index < 1 {
+			return nil, fmt.Errorf("invalid index %d for %s in interface %s", m.Index, m.Type, typ)
+		}
+		if !m.Type.Implements(typ) {
+			return nil, fmt.Errorf("type %s does not implement interface %s", m.Type, typ)
+		}
+		for _, other := range members[:i] {
+			if other.Index == m.Index {
+				return nil, fmt.Errorf("multiple types in interface %s have index %d", typ, m.Index)
+			}
+			if other.Type == m.Type {
+				return nil, fmt.Errorf("type %s registered more than once for interface %s", m.Type, typ)
+			}
+		}
+
+		mc, err := p.CodecForTypeRegistry(registry, m.Type, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find codec for %s in interface %s. %w", m.Type, typ, err)
+		}
+
+		um := &c.members[i]
+		um.rtype = m.Type
+		um.tab = ifaceTab(typ, m.Type)
+		um.index = m.Index
+		um.codec = mc
+		um.tag = plenccore.AppendTag(nil, mc.WireType(), m.Index)
+		// Maps are stored directly in the interface, but codecs for maps
+		// expect to be passed the map pointer when writing, so we treat them
+		// as if they were indirect.
+		um.direct = isDirectIface(m.Type) && m.Type.Kind() != reflect.Map
+		// A nil pointer would be written as an empty union, which reads back
+		// as a nil interface, so we refuse to write them.
+		um.nilable = m.Type.Kind() == reflect.Pointer
+
+		if m.Index > maxIndex {
+			maxIndex = m.Index
+		}
+	}
+
+	c.membersByIndex = make([]*unionMember, maxIndex+1)
+	for i := range c.members {
+		m := &c.members[i]
+		c.membersByIndex[m.index] = m
+	}
+
+	return &c, nil
+}
+
+type unionMember struct {
+	rtype reflect.Type
+	// tab is the type word of an interface holding this type. We use it to
+	// find the member for a value without using reflection.
+	tab   unsafe.Pointer
+	index int
+	codec Codec
+	tag   []byte
+	// direct is set if the value is stored directly in the interface data
+	// word rather than the data word pointing to the value.
+	direct  bool
+	nilable bool
+}
+
+// InterfaceCodec is a codec for interface types where the set of concrete types
+// the interface may hold has been registered in advance.
+type InterfaceCodec struct {
+	rtype          reflect.Type
+	members        []unionMember
+	membersByIndex []*unionMember
+}
+
+// iface matches the memory layout of both empty and non-empty interfaces.
+type iface struct {
+	tab  unsafe.Pointer
+	data unsafe.Pointer
+}
+
+// ifaceTab returns the type word of an interface of type typ holding a value
+// of type member.
+func ifaceTab(typ, member reflect.Type) unsafe.Pointer {
+	v := reflect.New(typ)
+	v.Elem().Set(reflect.Zero(member))
+	return (*iface)(v.UnsafePointer()).tab
+}
+
+// member finds the union member for the value held in the interface at ptr. It
+// returns a pointer to the value in the form the member's codec expects. It
+// panics with an EncodeError if the value can't be encoded.
+func (c *InterfaceCodec) member(ptr unsafe.Pointer) (*unionMember, unsafe.Pointer) {
+	in := (*iface)(ptr)
+	for i := range c.members {
+		m := &c.members[i]
+		if m.tab != in.tab {
+			continue
+		}
+		if m.nilable && in.data == nil {
+			panic(EncodeError{Err: fmt.Errorf("cannot encode nil %s in interface %s", m.rtype, c.rtype)})
+		}
+		if m.direct {
+			return m, unsafe.Pointer(&in.data)
+		}
+		return m, in.data
+	}
+	typ := reflect.NewAt(c.rtype, ptr).Elem().Elem().Type()
+	panic(EncodeError{Err: fmt.Errorf("type %s is not registered for interface %s", typ, c.rtype)})
+}
+
+func (c *InterfaceCodec) Omit(ptr unsafe.Pointer) bool {
+	return (*iface)(ptr).tab == nil
+}
+
+func (c *InterfaceCodec) size(m *unionMember, vptr unsafe.Pointer) int {
+	return m.codec.Size(vptr, m.tag)
+}
+
+func (c *InterfaceCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	if c.Omit(ptr) {
+		return 0
+	}
+	m, vptr := c.member(ptr)
+	l := c.size(m, vptr)
+	if len(tag) != 0 {
+		l += len(tag) + plenccore.SizeVarUint(uint64(l))
+	}
+	return l
+}
+
+func (c *InterfaceCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	if c.Omit(ptr) {
+		return data
+	}
+	m, vptr := c.member(ptr)
+	if len(tag) != 0 {
+		data = append(data, tag...)
+		data = plenccore.AppendVarUint(data, uint64(c.size(m, vptr)))
+	}
+	// We always write the value, even if it is a zero value, as the presence
+	// of the field is what tells us the type.
+	return m.codec.Append(data, vptr, m.tag)
+}
+
+func (c *InterfaceCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	l := len(data)
+
+	var offset int
+	for offset < l {
+		wt, index, n := plenccore.ReadTag(data[offset:])
+		if n <= 0 || n > l-offset {
+			return 0, fmt.Errorf("failed to read tag in %s", c.rtype)
+		}
+		offset += n
+
+		if index >= len(c.membersByIndex) || c.membersByIndex[index] == nil {
+			// This is a type we don't know about
+			n, err := plenccore.Skip(data[offset:], wt)
+			if err != nil {
+				return 0, fmt.Errorf("failed to skip type %d in %s. %w", index, c.rtype, err)
+			}
+			if n < 0 || n > l-offset {
+				return 0, fmt.Errorf("failed to skip type %d in %s", index, c.rtype)
+			}
+			offset += n
+			continue
+		}
+
+		fl := l
+		if wt == plenccore.WTLength {
+			v, n := plenccore.ReadVarUint(data[offset:])
+			if n <= 0 || n > l-offset {
+				return 0, fmt.Errorf("varuint overflow reading type %d of %s", index, c.rtype)
+			}
+			offset += n
+			fl = int(v) + offset
+			if fl > l || fl < 0 {
+				return 0, fmt.Errorf("length %d of type %d of %s exceeds data length", fl, index, c.rtype)
+			}
+		}
+
+		m := c.membersByIndex[index]
+		v := reflect.New(m.rtype)
+		n, err := m.codec.Read(data[offset:fl], v.UnsafePointer(), wt)
+		if err != nil {
+			return 0, fmt.Errorf("failed reading type %d (%s) of %s. %w", index, m.rtype, c.rtype, err)
+		}
+		offset += n
+
+		reflect.NewAt(c.rtype, ptr).Elem().Set(v.Elem())
+	}
+
+	return offset, nil
+}
+
+func (c *InterfaceCodec) New() unsafe.Pointer {
+	return unsafe.Pointer(reflect.New(c.rtype).Pointer())
+}
+
+func (c *InterfaceCodec) WireType() plenccore.WireType {
+	return plenccore.WTLength
+}
+
+func (c *InterfaceCodec) Descriptor() Descriptor {
+	d := Descriptor{
+		Type:     FieldTypeUnion,
+		TypeName: c.rtype.Name(),
+		Elements: make([]Descriptor, len(c.members)),
+	}
+	for i, m := range c.members {
+		d.Elements[i] = m.codec.Descriptor()
+		d.Elements[i].Index = m.index
+		d.Elements[i].Name = memberName(m.rtype)
+	}
+	return d
+}
+
+// memberName is the name we use for a union member in a Descriptor
+func memberName(typ reflect.Type) string {
+	for typ.Name() == "" && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if name := typ.Name(); name != "" {
+		return name
+	}
+	return typ.String()
+}
+
+// isDirectIface returns true if values of type typ are stored directly in the
+// data word of an interface rather than being pointed to by it. This follows
+// the rules the Go compiler uses: pointer-shaped types are stored directly.
+func isDirectIface(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return true
+	case reflect.Struct:
+		return typ.NumField() == 1 && isDirectIface(typ.Field(0).Type)
+	case reflect.Array:
+		return typ.Len() == 1 && isDirectIface(typ.Elem())
+	}
+	return false
+}
@@ -0,0 +1,297 @@
+package plenccodec_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+type event interface {
+	isEvent()
+}
+
+type click struct {
+	X int `plenc:"1"`
+	Y int `plenc:"2"`
+}
+
+func (click) isEvent() {}
+
+type scroll struct {
+	Delta float64 `plenc:"1"`
+}
+
+func (*scroll) isEvent() {}
+
+type keyPress string
+
+func (keyPress) isEvent() {}
+
+type labels map[string]string
+
+func (labels) isEvent() {}
+
+type batch struct {
+	Events []event `plenc:"1"`
+}
+
+func (batch) isEvent() {}
+
+type envelope struct {
+	ID    int   `plenc:"1"`
+	Event event `plenc:"2"`
+}
+
+func newUnionPlenc() *plenc.Plenc {
+	var p plenc.Plenc
+	p.RegisterDefaultCodecs()
+	p.RegisterUnion(reflect.TypeFor[event](),
+		plenccodec.UnionMember{Index: 1, Type: reflect.TypeFor[click]()},
+		plenccodec.UnionMember{Index: 2, Type: reflect.TypeFor[*scroll]()},
+		plenccodec.UnionMember{Index: 3, Type: reflect.TypeFor[keyPress]()},
+		plenccodec.UnionMember{Index: 4, Type: reflect.TypeFor[labels]()},
+		plenccodec.UnionMember{Index: 5, Type: reflect.TypeFor[batch]()},
+	)
+	return &p
+}
+
+func TestUnion(t *testing.T) {
+	p := newUnionPlenc()
+
+	tests := []struct {
+		name string
+		in   envelope
+	}{
+		{name: "nil", in: envelope{ID: 1}},
+		{name: "struct", in: envelope{ID: 1, Event: click{X: 1, Y: -3}}},
+		{name: "zero struct", in: envelope{ID: 1, Event: click{}}},
+		{name: "pointer", in: envelope{ID: 1, Event: &scroll{Delta: 3.7}}},
+		{name: "zero pointer", in: envelope{ID: 1, Event: &scroll{}}},
+		{name: "string", in: envelope{ID: 1, Event: keyPress("q")}},
+		{name: "empty string", in: envelope{ID: 1, Event: keyPress("")}},
+		{name: "map", in: envelope{ID: 1, Event: labels{"a": "b"}}},
+		{
+			name: "recursive",
+			in: envelope{ID: 1, Event: batch{Events: []event{
+				click{X: 1},
+				&scroll{Delta: 1},
+				batch{Events: []event{keyPress("x")}},
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := p.Marshal(nil, &test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := p.Size(&test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != len(data) {
+				t.Fatalf("size %d does not match data length %d", s, len(data))
+			}
+
+			var out envelope
+			if err := p.Unmarshal(data, &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.in, out); diff != "" {
+				t.Fatalf("not as expected. %s\n%x", diff, data)
+			}
+		})
+	}
+}
+
+func TestUnionUnknownMember(t *testing.T) {
+	p := newUnionPlenc()
+
+	// A reader that only knows about some of the types treats the others as
+	// nil.
+	var p2 plenc.Plenc
+	p2.RegisterDefaultCodecs()
+	p2.RegisterUnion(reflect.TypeFor[event](),
+		plenccodec.UnionMember{Index: 1, Type: reflect.TypeFor[click]()},
+	)
+
+	data, err := p.Marshal(nil, &envelope{ID: 1, Event: &scroll{Delta: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out envelope
+	if err := p2.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(envelope{ID: 1}, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestUnionErrors(t *testing.T) {
+	type notEvent struct {
+		A int `plenc:"1"`
+	}
+
+	tests := []struct {
+		name    string
+		members []plenccodec.UnionMember
+		exp     string
+	}{
+		{
+			name: "duplicate index",
+			members: []plenccodec.UnionMember{
+				{Index: 1, Type: reflect.TypeFor[click]()},
+				{Index: 1, Type: reflect.TypeFor[*scroll]()},
+			},
+			exp: "multiple types in interface plenccodec_test.event have index 1",
+		},
+		{
+			name: "does not implement",
+			members: []plenccodec.UnionMember{
+				{Index: 1, Type: reflect.TypeFor[notEvent]()},
+			},
+			exp: "type plenccodec_test.notEvent does not implement interface plenccodec_test.event",
+		},
+		{
+			name: "zero index",
+			members: []plenccodec.UnionMember{
+				{Index: 0, Type: reflect.TypeFor[click]()},
+			},
+			exp: "invalid index 0 for plenccodec_test.click in interface plenccodec_test.event",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var p plenc.Plenc
+			p.RegisterDefaultCodecs()
+			p.RegisterUnion(reflect.TypeFor[event](), test.members...)
+			_, err := p.CodecForType(reflect.TypeFor[event]())
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != test.exp {
+				t.Fatalf("error %q not as expected", err)
+			}
+		})
+	}
+
+	t.Run("not registered", func(t *testing.T) {
+		var p plenc.Plenc
+		p.RegisterDefaultCodecs()
+		_, err := p.CodecForType(reflect.TypeFor[envelope]())
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+type drag struct {
+	X int `plenc:"1"`
+}
+
+func (drag) isEvent() {}
+
+func TestUnionEncodeErrors(t *testing.T) {
+	p := newUnionPlenc()
+
+	tests := []struct {
+		name string
+		in   any
+		exp  string
+	}{
+		{
+			name: "not registered",
+			in:   &envelope{ID: 1, Event: drag{X: 1}},
+			exp:  "type plenccodec_test.drag is not registered for interface plenccodec_test.event",
+		},
+		{
+			name: "nil pointer",
+			in:   &envelope{ID: 1, Event: (*scroll)(nil)},
+			exp:  "cannot encode nil *plenccodec_test.scroll in interface plenccodec_test.event",
+		},
+		{
+			name: "in slice",
+			in:   &batch{Events: []event{click{}, drag{}}},
+			exp:  "type plenccodec_test.drag is not registered for interface plenccodec_test.event",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := p.Marshal(nil, test.in); err == nil || err.Error() != test.exp {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if _, err := p.Size(test.in); err == nil || err.Error() != test.exp {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestUnionDescriptor(t *testing.T) {
+	// Note we don't include the batch type here as descriptors can't describe
+	// recursive types
+	var p plenc.Plenc
+	p.RegisterDefaultCodecs()
+	p.RegisterUnion(reflect.TypeFor[event](),
+		plenccodec.UnionMember{Index: 1, Type: reflect.TypeFor[click]()},
+		plenccodec.UnionMember{Index: 2, Type: reflect.TypeFor[*scroll]()},
+		plenccodec.UnionMember{Index: 3, Type: reflect.TypeFor[keyPress]()},
+	)
+
+	type wrapper struct {
+		Events []event `plenc:"1"`
+	}
+
+	c, err := p.CodecForType(reflect.TypeFor[wrapper]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	in := wrapper{Events: []event{
+		click{X: 1, Y: 2},
+		&scroll{Delta: 1.5},
+		keyPress("q"),
+	}}
+	data, err := p.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var j plenccodec.JSONOutput
+	if err := d.Read(&j, data); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{
+  "Events": [
+    {
+      "click": {
+        "X": 1,
+        "Y": 2
+      }
+    },
+    {
+      "scroll": {
+        "Delta": 1.5
+      }
+    },
+    {
+      "keyPress": "q"
+    }
+  ]
+}
+`
+	if diff := cmp.Diff(exp, string(j.Done())); diff != "" {
+		t.Fatal(diff)
+	}
+}
@@ -0,0 +1,275 @@
+package plenccodec
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// Patterns for values Descriptor.Read outputs as strings
+const (
+	durationPattern = `^-?([0-9]+(\.[0-9]+)?(ns|µs|ms|s|m|h))+$`
+	decimalPattern  = `^-?[0-9]+(\.[0-9]+)?$`
+	bigIntPattern   = `^-?[0-9]+$`
+	bigRatPattern   = `^-?[0-9]+(/[0-9]+)?$`
+)
+
+// JSONSchema returns a JSON Schema (draft 2020-12) document describing the
+// JSON that Descriptor.Read writes to a JSONOutput for data described by d.
+//
+// Struct fields are never required, as zero values are not written. Times are
+// date-time strings, maps with string keys are objects, and other maps are
+// arrays of key-value objects. FieldTypeJSONObject and FieldTypeJSONArray
+// fields may hold any object or array. Fields with ExplicitPresence may also
+// be null, which Descriptor.EncodeJSON accepts. Structs that are referred to
+// by FieldTypeRef descriptors are defined under "$defs".
+func (d *Descriptor) JSONSchema() ([]byte, error) {
+	w := jsonSchemaWriter{
+		defs:     make(map[string]any),
+		defNames: make(map[*Descriptor]string),
+		used:     make(map[string]bool),
+	}
+	w.findRefTargets(d, nil)
+
+	schema, err := w.schema(d, nil)
+	if err != nil {
+		return nil, err
+	}
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	if d.TypeName != "" {
+		schema["title"] = d.TypeName
+	}
+	if len(w.defs) > 0 {
+		schema["$defs"] = w.defs
+	}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+type jsonSchemaWriter struct {
+	// defs holds the schemas of structs that are referred to, and defNames
+	// the name of each in defs.
+	defs     map[string]any
+	defNames map[*Descriptor]string
+	used     map[string]bool
+}
+
+// findRefTargets names the structs FieldTypeRef descriptors refer to. As in
+// resolveRefs, scope holds the enclosing structs.
+func (w *jsonSchemaWriter) findRefTargets(d *Descriptor, scope []*Descriptor) {
+	if d.Type == FieldTypeRef {
+		if target := refTarget(d, scope); target != nil {
+			if _, ok := w.defNames[target]; !ok {
+				// Different types can have the same name
+				name := target.TypeName
+				for i := 2; w.used[name]; i++ {
+					name = target.TypeName + "_" + strconv.Itoa(i)
+				}
+				w.defNames[target] = name
+				w.used[name] = true
+			}
+		}
+		return
+	}
+	if d.Type == FieldTypeStruct && d.TypeName != "" {
+		scope = append(scope, d)
+	}
+	for i := range d.Elements {
+		w.findRefTargets(&d.Elements[i], scope)
+	}
+}
+
+// refTarget returns the struct a FieldTypeRef descriptor refers to, or nil
+// if there is no such struct.
+func refTarget(d *Descriptor, scope []*Descriptor) *Descriptor {
+	for _, s := range slices.Backward(scope) {
+		if s.TypeName == d.TypeName {
+			return s
+		}
+	}
+	return nil
+}
+
+// schema returns the schema for d, allowing null if d has ExplicitPresence.
+func (w *jsonSchemaWriter) schema(d *Descriptor, scope []*Descriptor) (map[string]any, error) {
+	s, err := w.typeSchema(d, scope)
+	if err != nil {
+		return nil, err
+	}
+	if !d.ExplicitPresence {
+		return s, nil
+	}
+	if t, ok := s["type"].(string); ok {
+		// Keywords other than type don't apply to null, so we can just add
+		// null to the allowed types.
+		s["type"] = []string{t, "null"}
+		return s, nil
+	}
+	return map[string]any{
+		"anyOf": []any{s, map[string]any{"type": "null"}},
+	}, nil
+}
+
+func (w *jsonSchemaWriter) typeSchema(d *Descriptor, scope []*Descriptor) (map[string]any, error) {
+	switch d.Type {
+	case FieldTypeInt:
+		switch d.LogicalType {
+		case LogicalTypeDuration:
+			return map[string]any{"type": "string", "pattern": durationPattern}, nil
+		case LogicalTypeDecimal:
+			return map[string]any{"type": "string", "pattern": decimalPattern}, nil
+		}
+		return map[string]any{"type": "integer"}, nil
+
+	case FieldTypeFlatInt:
+		if d.LogicalType == LogicalTypeTimestamp {
+			return map[string]any{"type": "string", "format": "date-time"}, nil
+		}
+		return map[string]any{"type": "integer"}, nil
+
+	case FieldTypeUint, FieldTypeFixed64:
+		return map[string]any{"type": "integer", "minimum": 0}, nil
+
+	case FieldTypeFixed32:
+		return map[string]any{"type": "integer", "minimum": 0, "maximum": math.MaxUint32}, nil
+
+	case FieldTypeSFixed32:
+		return map[string]any{"type": "integer", "minimum": math.MinInt32, "maximum": math.MaxInt32}, nil
+
+	case FieldTypeSFixed64:
+		return map[string]any{"type": "integer"}, nil
+
+	case FieldTypeFloat32, FieldTypeFloat64:
+		return map[string]any{"type": "number"}, nil
+
+	case FieldTypeString:
+		return stringSchema(d.LogicalType), nil
+
+	case FieldTypeBool:
+		return map[string]any{"type": "boolean"}, nil
+
+	case FieldTypeTime, FieldTypeProtoTimestamp:
+		return map[string]any{"type": "string", "format": "date-time"}, nil
+
+	case FieldTypeSlice:
+		if len(d.Elements) != 1 {
+			return nil, fmt.Errorf("slice %s should have one element, not %d", d.Name, len(d.Elements))
+		}
+		elt := &d.Elements[0]
+		if d.isValidJSONMap() {
+			return w.mapSchema(elt, scope)
+		}
+		items, err := w.schema(elt, scope)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": items}, nil
+
+	case FieldTypeStruct:
+		if d.TypeName != "" {
+			scope = append(scope, d)
+		}
+		properties, err := w.properties(d, scope)
+		if err != nil {
+			return nil, err
+		}
+		s := map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		name, ok := w.defNames[d]
+		if !ok {
+			return s, nil
+		}
+		w.defs[name] = s
+		return map[string]any{"$ref": "#/$defs/" + name}, nil
+
+	case FieldTypeUnion:
+		// The value is an object with a single field named after the
+		// concrete type
+		properties, err := w.properties(d, scope)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+			"maxProperties":        1,
+		}, nil
+
+	case FieldTypeJSONObject:
+		return map[string]any{"type": "object"}, nil
+
+	case FieldTypeJSONArray:
+		return map[string]any{"type": "array"}, nil
+
+	case FieldTypeRef:
+		name, ok := w.defNames[refTarget(d, scope)]
+		if !ok {
+			return nil, fmt.Errorf("no enclosing struct %q for reference %q", d.TypeName, d.Name)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}, nil
+	}
+
+	return nil, fmt.Errorf("unrecognised field type %s", d.Type)
+}
+
+func (w *jsonSchemaWriter) properties(d *Descriptor, scope []*Descriptor) (map[string]any, error) {
+	properties := make(map[string]any, len(d.Elements))
+	for i := range d.Elements {
+		elt := &d.Elements[i]
+		s, err := w.schema(elt, scope)
+		if err != nil {
+			return nil, err
+		}
+		properties[elt.Name] = s
+	}
+	return properties, nil
+}
+
+// mapSchema returns the schema for a map with string keys, which
+// Descriptor.Read outputs as an object. entry is the map entry struct.
+func (w *jsonSchemaWriter) mapSchema(entry *Descriptor, scope []*Descriptor) (map[string]any, error) {
+	key, value := &entry.Elements[0], &entry.Elements[1]
+	values, err := w.schema(value, append(scope, entry))
+	if err != nil {
+		return nil, err
+	}
+	s := map[string]any{"type": "object", "additionalProperties": values}
+	if key.LogicalType != LogicalTypeNone {
+		s["propertyNames"] = stringSchema(key.LogicalType)
+	}
+	return s, nil
+}
+
+// stringSchema returns the schema for a FieldTypeString with the given
+// logical type. See logicalString.
+func stringSchema(lt LogicalType) map[string]any {
+	s := map[string]any{"type": "string"}
+	switch lt {
+	case LogicalTypeBinary:
+		s["contentEncoding"] = "base64"
+	case LogicalTypeIPAddr:
+		s["anyOf"] = []any{
+			map[string]any{"format": "ipv4"},
+			map[string]any{"format": "ipv6"},
+		}
+	case LogicalTypeBigInt:
+		s["pattern"] = bigIntPattern
+	case LogicalTypeBigRat:
+		s["pattern"] = bigRatPattern
+	case LogicalTypeURL:
+		s["format"] = "uri-reference"
+	case LogicalTypeDecimal:
+		s["pattern"] = decimalPattern
+	}
+	return s
+}
@@ -0,0 +1,362 @@
+package plenccodec_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/netip"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+type schemaSub struct {
+	A string `plenc:"1"`
+}
+
+type schemaThing struct {
+	A int                  `plenc:"1"`
+	B uint32               `plenc:"2"`
+	C float64              `plenc:"3"`
+	D string               `plenc:"4"`
+	E bool                 `plenc:"5"`
+	F time.Time            `plenc:"6"`
+	G []byte               `plenc:"7"`
+	H []int32              `plenc:"8"`
+	I *int                 `plenc:"9"`
+	J schemaSub            `plenc:"10"`
+	K *schemaSub           `plenc:"11"`
+	L []schemaSub          `plenc:"12"`
+	M map[string]int       `plenc:"13"`
+	N map[int]string       `plenc:"14"`
+	O time.Duration        `plenc:"15"`
+	P int64                `plenc:"16,decimal=2"`
+	Q netip.Addr           `plenc:"17"`
+	R *big.Int             `plenc:"18"`
+	S map[string]schemaSub `plenc:"19"`
+	T uint64               `plenc:"20,fixed"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	c, err := plenc.CodecForType(reflect.TypeFor[schemaThing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+	data, err := d.JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "schemaThing",
+  "type": "object",
+  "additionalProperties": false,
+  "properties": {
+    "A": {"type": "integer"},
+    "B": {"type": "integer", "minimum": 0},
+    "C": {"type": "number"},
+    "D": {"type": "string"},
+    "E": {"type": "boolean"},
+    "F": {"type": "string", "format": "date-time"},
+    "G": {"type": "string"},
+    "H": {"type": "array", "items": {"type": "integer"}},
+    "I": {"type": ["integer", "null"]},
+    "J": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {"A": {"type": "string"}}
+    },
+    "K": {
+      "type": ["object", "null"],
+      "additionalProperties": false,
+      "properties": {"A": {"type": "string"}}
+    },
+    "L": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "properties": {"A": {"type": "string"}}
+      }
+    },
+    "M": {"type": "object", "additionalProperties": {"type": "integer"}},
+    "N": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "properties": {
+          "key": {"type": "integer"},
+          "value": {"type": "string"}
+        }
+      }
+    },
+    "O": {"type": "string", "pattern": "^-?([0-9]+(\\.[0-9]+)?(ns|µs|ms|s|m|h))+$"},
+    "P": {"type": "string", "pattern": "^-?[0-9]+(\\.[0-9]+)?$"},
+    "Q": {"type": "string", "anyOf": [{"format": "ipv4"}, {"format": "ipv6"}]},
+    "R": {"type": ["string", "null"], "pattern": "^-?[0-9]+$"},
+    "S": {
+      "type": "object",
+      "additionalProperties": {
+        "type": "object",
+        "additionalProperties": false,
+        "properties": {"A": {"type": "string"}}
+      }
+    },
+    "T": {"type": "integer", "minimum": 0}
+  }
+}`
+	var expSchema, schema any
+	if err := json.Unmarshal([]byte(exp), &expSchema); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expSchema, schema); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestJSONSchemaRecursive(t *testing.T) {
+	c, err := plenc.CodecForType(reflect.TypeFor[treeNode]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+	data, err := d.JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "treeNode",
+  "$ref": "#/$defs/treeNode",
+  "$defs": {
+    "treeNode": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "Value": {"type": "integer"},
+        "Children": {
+          "type": "array",
+          "items": {"anyOf": [{"$ref": "#/$defs/treeNode"}, {"type": "null"}]}
+        },
+        "Next": {"anyOf": [{"$ref": "#/$defs/treeNode"}, {"type": "null"}]},
+        "Named": {
+          "type": "object",
+          "additionalProperties": {"anyOf": [{"$ref": "#/$defs/treeNode"}, {"type": "null"}]}
+        },
+        "Other": {
+          "type": ["object", "null"],
+          "additionalProperties": false,
+          "properties": {
+            "Name": {"type": "string"},
+            "Tree": {"anyOf": [{"$ref": "#/$defs/treeNode"}, {"type": "null"}]}
+          }
+        }
+      }
+    }
+  }
+}`
+	var expSchema, schema any
+	if err := json.Unmarshal([]byte(exp), &expSchema); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expSchema, schema); diff != "" {
+		t.Fatal(diff)
+	}
+
+	bad := plenccodec.Descriptor{Type: plenccodec.FieldTypeRef, TypeName: "nowhere", Name: "A"}
+	if _, err := bad.JSONSchema(); err == nil || err.Error() != `no enclosing struct "nowhere" for reference "A"` {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// TestJSONSchemaMatchesRead checks the JSON Descriptor.Read writes for random
+// values is valid against the schema.
+func TestJSONSchemaMatchesRead(t *testing.T) {
+	c, err := plenc.CodecForType(reflect.TypeFor[schemaThing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+	data, err := d.JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	f := fuzz.New().NilChance(0.2).Funcs(
+		func(a *netip.Addr, c fuzz.Continue) {
+			var b [16]byte
+			c.Read(b[:])
+			if c.RandBool() {
+				*a = netip.AddrFrom4([4]byte(b[:4]))
+			} else {
+				*a = netip.AddrFrom16(b)
+			}
+		},
+		func(x *big.Int, c fuzz.Continue) {
+			x.SetInt64(c.Int63() - c.Int63())
+		},
+		func(v *time.Time, c fuzz.Continue) {
+			*v = time.Unix(c.Int63n(1e10), c.Int63n(1e9)).UTC()
+		},
+	)
+	for range 100 {
+		var in schemaThing
+		f.Fuzz(&in)
+		msg, err := plenc.Marshal(nil, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var j plenccodec.JSONOutput
+		if err := d.Read(&j, msg); err != nil {
+			t.Fatal(err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(j.Done()))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if err := validateSchema(schema, schema, v, ""); err != "" {
+			t.Fatalf("%s\n%s", err, j.Done())
+		}
+	}
+}
+
+// validateSchema is a minimal JSON Schema validator that understands the
+// keywords JSONSchema uses. It returns a description of the first problem.
+func validateSchema(root, s map[string]any, v any, path string) string {
+	if ref, ok := s["$ref"].(string); ok {
+		def := root["$defs"].(map[string]any)[strings.TrimPrefix(ref, "#/$defs/")]
+		if problem := validateSchema(root, def.(map[string]any), v, path); problem != "" {
+			return problem
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]any); ok {
+		var problems []string
+		for _, sub := range anyOf {
+			problem := validateSchema(root, sub.(map[string]any), v, path)
+			if problem == "" {
+				problems = nil
+				break
+			}
+			problems = append(problems, problem)
+		}
+		if len(problems) > 0 {
+			return strings.Join(problems, " and ")
+		}
+	}
+
+	if typ, ok := s["type"]; ok {
+		var types []any
+		if t, ok := typ.(string); ok {
+			types = []any{t}
+		} else {
+			types = typ.([]any)
+		}
+		var vt string
+		switch v := v.(type) {
+		case nil:
+			vt = "null"
+		case bool:
+			vt = "boolean"
+		case string:
+			vt = "string"
+		case json.Number:
+			vt = "integer"
+			if strings.ContainsAny(string(v), ".eE") {
+				vt = "number"
+			}
+		case []any:
+			vt = "array"
+		case map[string]any:
+			vt = "object"
+		}
+		ok := false
+		for _, t := range types {
+			ok = ok || t == vt || (t == "number" && vt == "integer")
+		}
+		if !ok {
+			return path + ": " + vt + " is not " + jsonString(typ)
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		if pattern, ok := s["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(v) {
+			return path + ": " + v + " does not match " + pattern
+		}
+		switch s["format"] {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				return path + ": " + err.Error()
+			}
+		case "ipv4":
+			if a, err := netip.ParseAddr(v); err != nil || !a.Is4() {
+				return path + ": " + v + " is not ipv4"
+			}
+		case "ipv6":
+			if a, err := netip.ParseAddr(v); err != nil || !a.Is6() {
+				return path + ": " + v + " is not ipv6"
+			}
+		}
+	case json.Number:
+		if minimum, ok := s["minimum"].(float64); ok && strings.HasPrefix(string(v), "-") && minimum >= 0 {
+			return path + ": " + string(v) + " is below the minimum"
+		}
+	case []any:
+		if items, ok := s["items"].(map[string]any); ok {
+			for _, item := range v {
+				if problem := validateSchema(root, items, item, path+"[]"); problem != "" {
+					return problem
+				}
+			}
+		}
+	case map[string]any:
+		properties, _ := s["properties"].(map[string]any)
+		for name, value := range v {
+			if sub, ok := properties[name]; ok {
+				if problem := validateSchema(root, sub.(map[string]any), value, path+"."+name); problem != "" {
+					return problem
+				}
+				continue
+			}
+			switch additional := s["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return path + ": unexpected property " + name
+				}
+			case map[string]any:
+				if problem := validateSchema(root, additional, value, path+"."+name); problem != "" {
+					return problem
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func jsonString(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
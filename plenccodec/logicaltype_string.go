@@ -0,0 +1,39 @@
+// Code generated by "stringer -type LogicalType"; DO NOT EDIT.
+
+package plenccodec
+
+import "strconv"
+
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[LogicalTypeNone-0]
+	_ = x[LogicalTypeTimestamp-1]
+	_ = x[LogicalTypeDate-2]
+	_ = x[LogicalTypeTime-3]
+	_ = x[LogicalTypeMap-4]
+	_ = x[LogicalTypeMapEntry-5]
+	_ = x[LogicalTypeText-6]
+	_ = x[LogicalTypeBinary-7]
+	_ = x[LogicalTypeDuration-8]
+	_ = x[LogicalTypeIPAddr-9]
+	_ = x[LogicalTypeIPPrefix-10]
+	_ = x[LogicalTypeBigInt-11]
+	_ = x[LogicalTypeBigRat-12]
+	_ = x[LogicalTypeURL-13]
+	_ = x[LogicalTypeDecimal-14]
+	_ = x[LogicalTypeBytes-15]
+}
+
+const _LogicalType_name = "LogicalTypeNoneLogicalTypeTimestampLogicalTypeDateLogicalTypeTimeLogicalTypeMapLogicalTypeMapEntryLogicalTypeTextLogicalTypeBinaryLogicalTypeDurationLogicalTypeIPAddrLogicalTypeIPPrefixLogicalTypeBigIntLogicalTypeBigRatLogicalTypeURLLogicalTypeDecimalLogicalTypeBytes"
+
+var _LogicalType_index = [...]uint16{0, 15, 35, 50, 65, 79, 98, 113, 130, 149, 166, 185, 202, 219, 233, 251, 267}
+
+func (i LogicalType) String() string {
+	idx := int(i) - 0
+	if i < 0 || idx >= len(_LogicalType_index)-1 {
+		return "LogicalType(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _LogicalType_name[_LogicalType_index[idx]:_LogicalType_index[idx+1]]
+}
@@ -20,6 +20,13 @@ type MapCodec struct {
 	kPool      sync.Pool
 	kZero      unsafe.Pointer
 	vZero      unsafe.Pointer
+	// Codecs are given the map pointer itself for maps, so we dereference map
+	// values.
+	derefValue bool
+	// protoFields is set if maps that are fields of a struct use the protobuf
+	// layout. The layout only works for fields, as each entry is written as a
+	// separate field.
+	protoFields bool
 }
 
 func BuildMapCodec(p CodecBuilder, registry CodecRegistry, typ reflect.Type, tag string) (Codec, error) {
@@ -59,13 +66,30 @@ func BuildMapCodec(p CodecBuilder, registry CodecRegistry, typ reflect.Type, tag
 		c.vZero = unsafe.Pointer(&z[0])
 	}
 
-	if tag == "proto" {
-		return ProtoMapCodec{&c}, nil
-	}
+	c.derefValue = typ.Elem().Kind() == reflect.Map
+	c.protoFields = tag == "proto"
 
 	return &c, nil
 }
 
+// FieldCodec returns the codec to use when the map is a field of a struct.
+func (c *MapCodec) FieldCodec() Codec {
+	if c.protoFields {
+		return ProtoMapCodec{c}
+	}
+	return c
+}
+
+// elem returns a pointer to the value at the current position of iter, to pass
+// to the value codec when writing.
+func (c *MapCodec) elem(iter unsafe.Pointer) unsafe.Pointer {
+	v := mapiterelem(iter)
+	if c.derefValue {
+		v = *(*unsafe.Pointer)(v)
+	}
+	return v
+}
+
 func (c *MapCodec) newKey() any {
 	return c.keyCodec.New()
 }
@@ -88,7 +112,7 @@ func (c *MapCodec) size(ptr unsafe.Pointer) (size int) {
 		if k == nil {
 			break
 		}
-		v := mapiterelem(iter)
+		v := c.elem(iter)
 
 		s := c.sizeForEntry(k, v)
 		size += plenccore.SizeVarUint(uint64(s)) + s
@@ -128,7 +152,7 @@ func (c *MapCodec) append(data []byte, ptr unsafe.Pointer) []byte {
 		if k == nil {
 			break
 		}
-		v := mapiterelem(iter)
+		v := c.elem(iter)
 
 		// Add the length of each entry, then the key and value
 		data = plenccore.AppendVarUint(data, uint64(c.sizeForEntry(k, v)))
@@ -143,7 +167,13 @@ func (c *MapCodec) append(data []byte, ptr unsafe.Pointer) []byte {
 
 var zero [1024]byte
 
+// Read reads map data. It accepts both the plenc WTSlice layout and the
+// protobuf layout, where each entry is written as a separate WTLength field
+// with the same index. In the protobuf layout Read is called once per entry.
 func (c *MapCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if wt == plenccore.WTLength {
+		return c.readProtoEntry(data, ptr)
+	}
 	if len(data) == 0 {
 		return 0, nil
 	}
@@ -195,6 +225,23 @@ func (c *MapCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType)
 	return offset, nil
 }
 
+// readProtoEntry reads a single map entry written in the protobuf layout. An
+// empty entry is valid: it has a zero key and a zero value.
+func (c *MapCodec) readProtoEntry(data []byte, ptr unsafe.Pointer) (n int, err error) {
+	// ptr is a pointer to a map pointer
+	if *(*unsafe.Pointer)(ptr) == nil {
+		*(*unsafe.Pointer)(ptr) = unsafe.Pointer(reflect.MakeMap(c.rtype).Pointer())
+	}
+	mp := *(*unsafe.Pointer)(ptr)
+
+	// We need some space to hold keys and values as we read them out. We can
+	// re-use the space on each iteration as the data is copied into the map
+	// We also save some memory & time if we cache them in some pools
+	k := c.kPool.Get().(unsafe.Pointer)
+	defer c.kPool.Put(k)
+	return c.readMapEntry(mp, k, data)
+}
+
 // readMapEntry reads out a single map entry. mp is the map pointer. k is an
 // area to read key values into. data is the raw data for this map entry
 func (c *MapCodec) readMapEntry(mp, k unsafe.Pointer, data []byte) (int, error) {
@@ -204,7 +251,10 @@ func (c *MapCodec) readMapEntry(mp, k unsafe.Pointer, data []byte) (int, error)
 	}
 
 	if index == 1 {
-		// Key is present - read it
+		// Key is present - read it. The key space is re-used, so we clear it
+		// first as fields of struct keys that aren't present in the data
+		// aren't written.
+		typedmemclr(unpackEFace(c.rtype.Key()).data, k)
 		n, err := c.keyCodec.Read(data[offset:fieldEnd], k, wt)
 		if err != nil {
 			return 0, fmt.Errorf("failed reading key field of %s. %w", c.rtype.Name(), err)
@@ -315,6 +365,9 @@ func (c *MapCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
 	return c.append(data, ptr)
 }
 
+// ProtoMapCodec writes a map in the protobuf layout, where each entry is a
+// separate field with the same index. It only works for fields of a struct, so
+// MapCodec.FieldCodec returns it for maps built with the proto tag.
 type ProtoMapCodec struct {
 	*MapCodec
 }
@@ -329,7 +382,7 @@ func (c ProtoMapCodec) Size(ptr unsafe.Pointer, tag []byte) (size int) {
 		if k == nil {
 			break
 		}
-		v := mapiterelem(iter)
+		v := c.elem(iter)
 
 		s := c.sizeForEntry(k, v)
 		size += len(tag) + plenccore.SizeVarUint(uint64(s)) + s
@@ -356,7 +409,7 @@ func (c ProtoMapCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byt
 		if k == nil {
 			break
 		}
-		v := mapiterelem(iter)
+		v := c.elem(iter)
 
 		data = append(data, tag...)
 		data = plenccore.AppendVarUint(data, uint64(c.sizeForEntry(k, v)))
@@ -369,25 +422,6 @@ func (c ProtoMapCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byt
 	return data
 }
 
-func (c ProtoMapCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
-	if len(data) == 0 {
-		return 0, nil
-	}
-
-	// ptr is a pointer to a map pointer
-	if *(*unsafe.Pointer)(ptr) == nil {
-		*(*unsafe.Pointer)(ptr) = unsafe.Pointer(reflect.MakeMap(c.rtype).Pointer())
-	}
-	mp := *(*unsafe.Pointer)(ptr)
-
-	// We need some space to hold keys and values as we read them out. We can
-	// re-use the space on each iteration as the data is copied into the map
-	// We also save some memory & time if we cache them in some pools
-	k := c.kPool.Get().(unsafe.Pointer)
-	defer c.kPool.Put(k)
-	return c.readMapEntry(mp, k, data)
-}
-
 func (c ProtoMapCodec) WireType() plenccore.WireType {
 	return plenccore.WTLength
 }
@@ -1,12 +1,15 @@
 package plenccodec_test
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	fuzz "github.com/google/gofuzz"
 	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccore"
 )
 
 func TestMap(t *testing.T) {
@@ -176,6 +179,150 @@ func TestMapFuzz(t *testing.T) {
 	}
 }
 
+func TestMapProto(t *testing.T) {
+	type thing struct {
+		M map[string]int `plenc:"1"`
+		N map[int]string `plenc:"2,proto"`
+		I int            `plenc:"3"`
+	}
+
+	var proto plenc.Plenc
+	proto.ProtoCompatibleArrays = true
+	proto.RegisterDefaultCodecs()
+
+	in := thing{
+		M: map[string]int{"a": 1, "b": 0, "": 3},
+		N: map[int]string{1: "one", 0: "", 2: ""},
+		I: 42,
+	}
+
+	// Maps written in either layout can be read by either reader
+	for _, writer := range []*plenc.Plenc{&proto, nil} {
+		var data []byte
+		var err error
+		if writer == nil {
+			data, err = plenc.Marshal(nil, &in)
+		} else {
+			data, err = writer.Marshal(nil, &in)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out thing
+		if err := proto.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in, out); diff != "" {
+			t.Fatal(diff)
+		}
+
+		out = thing{}
+		if err := plenc.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in, out); diff != "" {
+			t.Fatal(diff)
+		}
+	}
+}
+
+// TestMapProtoNotField checks maps that aren't fields of a struct, which can't
+// use the protobuf layout.
+func TestMapProtoNotField(t *testing.T) {
+	var proto plenc.Plenc
+	proto.ProtoCompatibleArrays = true
+	proto.RegisterDefaultCodecs()
+	var plain plenc.Plenc
+	plain.RegisterDefaultCodecs()
+
+	for _, p := range []*plenc.Plenc{&proto, &plain} {
+		t.Run(fmt.Sprintf("proto=%t", p.ProtoCompatibleArrays), func(t *testing.T) {
+			m := map[string]int{"a": 1, "b": 2}
+			data, err := p.Marshal(nil, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var mOut map[string]int
+			if err := p.Unmarshal(data, &mOut); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(m, mOut); diff != "" {
+				t.Fatal(diff)
+			}
+
+			mm := map[string]map[string]int{"x": {"a": 1, "b": 2}, "y": nil, "z": {"c": 3}}
+			data, err = p.Marshal(nil, mm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var mmOut map[string]map[string]int
+			if err := p.Unmarshal(data, &mmOut); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(mm, mmOut, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(diff)
+			}
+
+			type thing struct {
+				M map[string]map[string]int `plenc:"1"`
+			}
+			data, err = p.Marshal(nil, &thing{M: mm})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var tOut thing
+			if err := p.Unmarshal(data, &tOut); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(thing{M: mm}, tOut, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(diff)
+			}
+
+			// Slices of maps aren't supported, as maps are written like
+			// slices.
+			s := []map[string]int{{"a": 1}, {"b": 2}}
+			_, err = p.Marshal(nil, &s)
+			if err == nil || err.Error() != "slices of slices of structs or strings are not supported" {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestMapProtoEncoding(t *testing.T) {
+	// This is how protobuf encodes map<string, sint64> m = 1 with entries
+	// {"a": 1} and {"": 0}. Protobuf may write the zero entry with empty key
+	// and value fields, or omit them entirely.
+	var data []byte
+	data = plenccore.AppendTag(data, plenccore.WTLength, 1)
+	data = append(data, 5, 0x0a, 0x01, 'a', 0x10, 0x02)
+	data = plenccore.AppendTag(data, plenccore.WTLength, 1)
+	data = append(data, 0)
+
+	type thing struct {
+		M map[string]int `plenc:"1"`
+	}
+	var out thing
+	if err := plenc.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(thing{M: map[string]int{"a": 1, "": 0}}, out); diff != "" {
+		t.Fatal(diff)
+	}
+
+	var p plenc.Plenc
+	p.ProtoCompatibleArrays = true
+	p.RegisterDefaultCodecs()
+	encoded, err := p.Marshal(nil, &thing{M: map[string]int{"a": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(data[:7], encoded); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func BenchmarkMap(b *testing.B) {
 	m := map[string]string{
 		"AAA":  "AAA",
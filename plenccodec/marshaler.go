@@ -0,0 +1,187 @@
+package plenccodec
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// PlencMarshaler is implemented by types that encode themselves. Plenc uses
+// these methods for the type in place of its own codecs, so no codec needs to
+// be registered. The methods may have value or pointer receivers.
+type PlencMarshaler interface {
+	// WireType returns the wire type of the encoding. It must be the same for
+	// every value of the type, and is called on the zero value. It must be
+	// WTVarInt, WT64, WT32 or WTLength.
+	WireType() plenccore.WireType
+	// SizePlenc returns the number of bytes AppendPlenc will append. The
+	// value is omitted if this is zero.
+	SizePlenc() int
+	// AppendPlenc appends the encoded value to data. Plenc adds the tag and,
+	// for WTLength types, the length.
+	AppendPlenc(data []byte) []byte
+}
+
+// PlencUnmarshaler is implemented by types that decode themselves. The data
+// is exactly the data written by AppendPlenc. Types that implement
+// PlencMarshaler but not PlencUnmarshaler can't be unmarshalled.
+type PlencUnmarshaler interface {
+	UnmarshalPlenc(data []byte) error
+}
+
+// PlencDescriber may be implemented by types that implement PlencMarshaler to
+// describe their encoding. It is called on the zero value. Without it the
+// type is described as bytes or an unsigned int, depending on the wire type.
+type PlencDescriber interface {
+	PlencDescriptor() Descriptor
+}
+
+var marshalerType = reflect.TypeFor[PlencMarshaler]()
+
+// IsMarshaler returns true if typ implements PlencMarshaler with either value
+// or pointer receivers. Pointer and map types are not included: plenc builds
+// codecs for them from the codec of the underlying type.
+func IsMarshaler(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Interface:
+		return false
+	}
+	return reflect.PointerTo(typ).Implements(marshalerType)
+}
+
+// MarshalerCodec is a codec for a type that implements PlencMarshaler, and
+// optionally PlencUnmarshaler and PlencDescriber.
+type MarshalerCodec struct {
+	rtype reflect.Type
+	// These are the itabs for a pointer to the type. A pointer type has all
+	// the methods of the type, whatever the receivers.
+	marshaler   unsafe.Pointer
+	unmarshaler unsafe.Pointer
+	describer   unsafe.Pointer
+	zero        unsafe.Pointer
+	wireType    plenccore.WireType
+}
+
+// BuildMarshalerCodec builds a codec for typ, which must implement
+// PlencMarshaler.
+func BuildMarshalerCodec(typ reflect.Type) (Codec, error) {
+	if !IsMarshaler(typ) {
+		return nil, fmt.Errorf("%s does not implement PlencMarshaler", typ)
+	}
+
+	zero := reflect.New(typ)
+	c := MarshalerCodec{
+		rtype: typ,
+		zero:  zero.UnsafePointer(),
+	}
+
+	m := zero.Interface().(PlencMarshaler)
+	c.marshaler = (*iface)(unsafe.Pointer(&m)).tab
+	if u, ok := zero.Interface().(PlencUnmarshaler); ok {
+		c.unmarshaler = (*iface)(unsafe.Pointer(&u)).tab
+	}
+	if d, ok := zero.Interface().(PlencDescriber); ok {
+		c.describer = (*iface)(unsafe.Pointer(&d)).tab
+	}
+
+	c.wireType = m.WireType()
+	switch c.wireType {
+	case plenccore.WTVarInt, plenccore.WT64, plenccore.WT32, plenccore.WTLength:
+	default:
+		return nil, fmt.Errorf("%s has unsupported wire type %d for a PlencMarshaler", typ, c.wireType)
+	}
+
+	return &c, nil
+}
+
+func (c *MarshalerCodec) m(ptr unsafe.Pointer) PlencMarshaler {
+	var m PlencMarshaler
+	i := (*iface)(unsafe.Pointer(&m))
+	i.tab = c.marshaler
+	i.data = ptr
+	return m
+}
+
+func (c *MarshalerCodec) Omit(ptr unsafe.Pointer) bool {
+	return c.m(ptr).SizePlenc() == 0
+}
+
+func (c *MarshalerCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if c.unmarshaler == nil {
+		return 0, fmt.Errorf("%s does not implement PlencUnmarshaler", c.rtype)
+	}
+
+	// For anything but WTLength data runs to the end of the enclosing
+	// struct, so we need to work out how much is ours.
+	n = len(data)
+	if c.wireType != plenccore.WTLength {
+		n, err = plenccore.Skip(data, c.wireType)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s. %w", c.rtype, err)
+		}
+	}
+
+	var u PlencUnmarshaler
+	i := (*iface)(unsafe.Pointer(&u))
+	i.tab = c.unmarshaler
+	i.data = ptr
+	if err := u.UnmarshalPlenc(data[:n]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (c *MarshalerCodec) New() unsafe.Pointer {
+	return reflect.New(c.rtype).UnsafePointer()
+}
+
+func (c *MarshalerCodec) WireType() plenccore.WireType {
+	return c.wireType
+}
+
+func (c *MarshalerCodec) Descriptor() Descriptor {
+	if c.describer != nil {
+		var d PlencDescriber
+		i := (*iface)(unsafe.Pointer(&d))
+		i.tab = c.describer
+		i.data = c.zero
+		return d.PlencDescriptor()
+	}
+
+	d := Descriptor{TypeName: c.rtype.Name()}
+	switch c.wireType {
+	case plenccore.WTVarInt:
+		d.Type = FieldTypeUint
+	case plenccore.WT64:
+		d.Type = FieldTypeFixed64
+	case plenccore.WT32:
+		d.Type = FieldTypeFixed32
+	default:
+		d.Type = FieldTypeString
+	}
+	return d
+}
+
+func (c *MarshalerCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	l := c.m(ptr).SizePlenc()
+	if len(tag) != 0 {
+		if c.wireType == plenccore.WTLength {
+			l += plenccore.SizeVarUint(uint64(l))
+		}
+		l += len(tag)
+	}
+	return l
+}
+
+func (c *MarshalerCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	m := c.m(ptr)
+	if len(tag) != 0 {
+		data = append(data, tag...)
+		if c.wireType == plenccore.WTLength {
+			data = plenccore.AppendVarUint(data, uint64(m.SizePlenc()))
+		}
+	}
+	return m.AppendPlenc(data)
+}
@@ -0,0 +1,158 @@
+package plenccodec_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// version encodes itself as a string like "1.2". It has value receivers for
+// marshalling.
+type version struct {
+	Major, Minor int
+}
+
+func (v version) WireType() plenccore.WireType { return plenccore.WTLength }
+
+func (v version) SizePlenc() int {
+	return len(v.String())
+}
+
+func (v version) AppendPlenc(data []byte) []byte {
+	return append(data, v.String()...)
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func (v *version) UnmarshalPlenc(data []byte) error {
+	_, err := fmt.Sscanf(string(data), "%d.%d", &v.Major, &v.Minor)
+	return err
+}
+
+func (v version) PlencDescriptor() plenccodec.Descriptor {
+	return plenccodec.Descriptor{Type: plenccodec.FieldTypeString, TypeName: "version"}
+}
+
+// flags encodes itself as a varint, and has pointer receivers throughout.
+type flags struct {
+	bits uint64
+}
+
+func (f *flags) WireType() plenccore.WireType { return plenccore.WTVarInt }
+func (f *flags) SizePlenc() int               { return plenccore.SizeVarUint(f.bits) }
+func (f *flags) AppendPlenc(data []byte) []byte {
+	return plenccore.AppendVarUint(data, f.bits)
+}
+
+func (f *flags) UnmarshalPlenc(data []byte) error {
+	v, n := plenccore.ReadVarUint(data)
+	if n != len(data) {
+		return fmt.Errorf("bad flags")
+	}
+	f.bits = v
+	return nil
+}
+
+func TestMarshaler(t *testing.T) {
+	type thing struct {
+		A version   `plenc:"1"`
+		B flags     `plenc:"2"`
+		C *version  `plenc:"3"`
+		D []version `plenc:"4"`
+		E []flags   `plenc:"5"`
+		F int       `plenc:"6"`
+	}
+
+	f := fuzz.New().NilChance(0.2).Funcs(
+		func(v *version, c fuzz.Continue) {
+			v.Major, v.Minor = c.Intn(100), c.Intn(100)
+		},
+		func(fl *flags, c fuzz.Continue) {
+			fl.bits = c.Uint64()
+		},
+	)
+
+	for range 1000 {
+		var in thing
+		f.Fuzz(&in)
+
+		data, err := plenc.Marshal(nil, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out thing
+		if err := plenc.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in, out, cmp.AllowUnexported(flags{})); diff != "" {
+			t.Fatal(diff)
+		}
+	}
+
+	// The version is written as a string, so can be read as one
+	data, err := plenc.Marshal(nil, &thing{A: version{Major: 1, Minor: 23}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		A string `plenc:"1"`
+	}
+	if err := plenc.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.A != "1.23" {
+		t.Fatalf("unexpected value %q", s.A)
+	}
+
+	c, err := plenc.CodecForType(reflect.TypeFor[thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+	if diff := cmp.Diff(plenccodec.Descriptor{Index: 1, Name: "A", Type: plenccodec.FieldTypeString, TypeName: "version"}, d.Elements[0]); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(plenccodec.Descriptor{Index: 2, Name: "B", Type: plenccodec.FieldTypeUint, TypeName: "flags"}, d.Elements[1]); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+type writeOnly struct{}
+
+func (writeOnly) WireType() plenccore.WireType   { return plenccore.WTVarInt }
+func (writeOnly) SizePlenc() int                 { return 1 }
+func (writeOnly) AppendPlenc(data []byte) []byte { return append(data, 1) }
+
+type badWireType struct{}
+
+func (badWireType) WireType() plenccore.WireType   { return plenccore.WTSlice }
+func (badWireType) SizePlenc() int                 { return 0 }
+func (badWireType) AppendPlenc(data []byte) []byte { return data }
+
+func TestMarshalerErrors(t *testing.T) {
+	type thing struct {
+		A writeOnly `plenc:"1"`
+	}
+	data, err := plenc.Marshal(nil, &thing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out thing
+	err = plenc.Unmarshal(data, &out)
+	if err == nil || err.Error() != "failed reading field 1 of thing. plenccodec_test.writeOnly does not implement PlencUnmarshaler" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	_, err = plenc.CodecForType(reflect.TypeFor[badWireType]())
+	if err == nil || err.Error() != "plenccodec_test.badWireType has unsupported wire type 3 for a PlencMarshaler" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
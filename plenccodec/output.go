@@ -1,6 +1,7 @@
 package plenccodec
 
 import (
+	"encoding/json"
 	"strconv"
 	"time"
 )
@@ -184,6 +185,87 @@ func (j *JSONOutput) Time(t time.Time) {
 	j.punctuate()
 }
 
+// AnyOutput converts Descriptor output to a tree of generic Go values. Objects
+// become map[string]any and arrays become []any. Signed integers are int64,
+// unsigned integers are uint64, floats are float64, and times are time.Time.
+// Numbers held in JSON fields that plenc stores as raw text are json.Number.
+type AnyOutput struct {
+	stack []anyContainer
+	value any
+}
+
+type anyContainer struct {
+	isArray bool
+	array   []any
+	object  map[string]any
+	key     string
+	haveKey bool
+}
+
+// Done returns the value that has been built.
+func (a *AnyOutput) Done() any {
+	return a.value
+}
+
+func (a *AnyOutput) Reset() {
+	a.stack = a.stack[:0]
+	a.value = nil
+}
+
+func (a *AnyOutput) add(v any) {
+	if len(a.stack) == 0 {
+		a.value = v
+		return
+	}
+	c := &a.stack[len(a.stack)-1]
+	if c.isArray {
+		c.array = append(c.array, v)
+		return
+	}
+	if !c.haveKey {
+		// Map keys are output as strings rather than via NameField
+		c.key, _ = v.(string)
+		c.haveKey = true
+		return
+	}
+	c.object[c.key] = v
+	c.key, c.haveKey = "", false
+}
+
+func (a *AnyOutput) StartObject() {
+	a.stack = append(a.stack, anyContainer{object: make(map[string]any)})
+}
+
+func (a *AnyOutput) EndObject() {
+	c := a.stack[len(a.stack)-1]
+	a.stack = a.stack[:len(a.stack)-1]
+	a.add(c.object)
+}
+
+func (a *AnyOutput) StartArray() {
+	a.stack = append(a.stack, anyContainer{isArray: true, array: []any{}})
+}
+
+func (a *AnyOutput) EndArray() {
+	c := a.stack[len(a.stack)-1]
+	a.stack = a.stack[:len(a.stack)-1]
+	a.add(c.array)
+}
+
+func (a *AnyOutput) NameField(name string) {
+	c := &a.stack[len(a.stack)-1]
+	c.key, c.haveKey = name, true
+}
+
+func (a *AnyOutput) Int64(v int64)     { a.add(v) }
+func (a *AnyOutput) Uint64(v uint64)   { a.add(v) }
+func (a *AnyOutput) Float64(v float64) { a.add(v) }
+func (a *AnyOutput) Float32(v float32) { a.add(float64(v)) }
+func (a *AnyOutput) String(v string)   { a.add(v) }
+func (a *AnyOutput) Bool(v bool)       { a.add(v) }
+func (a *AnyOutput) Time(t time.Time)  { a.add(t) }
+func (a *AnyOutput) Raw(v string)      { a.add(json.Number(v)) }
+
 const hex = "0123456789abcdef"
 
 func (j *JSONOutput) appendString(data []byte, v string) []byte {
@@ -0,0 +1,275 @@
+package plenccodec
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// ProtoOptions controls the .proto file written by Descriptor.Proto
+type ProtoOptions struct {
+	// Package is the protobuf package name. If empty there is no package
+	// statement.
+	Package string
+	// CompatibleArrays should be set if the data is written with
+	// Plenc.ProtoCompatibleArrays set. Otherwise slices and maps of strings,
+	// structs and other length-delimited types use plenc's WTSlice encoding,
+	// which protobuf can't read.
+	CompatibleArrays bool
+}
+
+// Proto returns a proto3 .proto file that describes the data described by d,
+// which must be a struct. Where plenc's encoding of a field can't be read by
+// protobuf the field is still written, and the problem is reported in the
+// returned list.
+func (d *Descriptor) Proto(opts ProtoOptions) ([]byte, []Incompatibility, error) {
+	if d.Type != FieldTypeStruct && d.Type != FieldTypeUnion {
+		return nil, nil, fmt.Errorf("can only write protobuf for structs, not %s", d.Type)
+	}
+
+	w := protoWriter{opts: opts, defined: make(map[string]*Descriptor)}
+	w.message("", protoName(d.TypeName, "Message"), d)
+
+	var b strings.Builder
+	b.WriteString("syntax = \"proto3\";\n")
+	if opts.Package != "" {
+		fmt.Fprintf(&b, "\npackage %s;\n", opts.Package)
+	}
+	if len(w.imports) > 0 {
+		b.WriteString("\n")
+		for _, imp := range w.imports {
+			fmt.Fprintf(&b, "import %q;\n", imp)
+		}
+	}
+	for _, m := range w.messages {
+		b.WriteString("\n")
+		b.WriteString(m.String())
+	}
+
+	return []byte(b.String()), w.problems, nil
+}
+
+type protoWriter struct {
+	opts     ProtoOptions
+	imports  []string
+	messages []*strings.Builder
+	defined  map[string]*Descriptor
+	problems []Incompatibility
+	// scope lists the messages being written, outermost first, so that refs
+	// can find the message for their type.
+	scope []protoScope
+}
+
+type protoScope struct {
+	typeName string
+	name     string
+}
+
+func (w *protoWriter) report(path, format string, args ...any) {
+	w.problems = append(w.problems, Incompatibility{
+		Path:   path,
+		Reason: fmt.Sprintf(format, args...),
+	})
+}
+
+func (w *protoWriter) addImport(imp string) {
+	if !slices.Contains(w.imports, imp) {
+		w.imports = append(w.imports, imp)
+	}
+}
+
+// message writes a message for a struct or union. Messages are identified by
+// name, so each is only written once. Different types may have the same name,
+// for example if they are in different packages, so if we've already written
+// a message with a different type under the name we add a number to it.
+func (w *protoWriter) message(path, name string, d *Descriptor) string {
+	base := name
+	for i := 2; w.defined[name] != nil; i++ {
+		if prev := w.defined[name]; prev.Type == d.Type && reflect.DeepEqual(prev.Elements, d.Elements) {
+			return name
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	w.defined[name] = d
+
+	w.scope = append(w.scope, protoScope{typeName: d.TypeName, name: name})
+	defer func() { w.scope = w.scope[:len(w.scope)-1] }()
+
+	// Reserve our place in the output before writing any messages our fields
+	// refer to.
+	var b strings.Builder
+	w.messages = append(w.messages, &b)
+
+	fmt.Fprintf(&b, "message %s {\n", name)
+	indent := "  "
+	if d.Type == FieldTypeUnion {
+		b.WriteString("  oneof value {\n")
+		indent = "    "
+	}
+
+	for i := range d.Elements {
+		elt := &d.Elements[i]
+		eltPath := fieldPath(path, elt)
+		label, typ := w.fieldType(eltPath, name, elt)
+		if d.Type == FieldTypeUnion && label != "" {
+			w.report(eltPath, "%s members of a oneof are not allowed in protobuf", label)
+			label, typ = "", "bytes"
+		}
+		if label != "" {
+			label += " "
+		}
+		fmt.Fprintf(&b, "%s%s%s %s = %d;\n", indent, label, typ, protoName(elt.Name, "field"), elt.Index)
+	}
+
+	if d.Type == FieldTypeUnion {
+		b.WriteString("  }\n")
+	}
+	b.WriteString("}\n")
+	return name
+}
+
+// fieldType returns the label (optional, repeated or empty) and type of a
+// field. parent is the name of the message containing the field.
+func (w *protoWriter) fieldType(path, parent string, d *Descriptor) (label, typ string) {
+	if d.ExplicitPresence {
+		switch d.Type {
+		case FieldTypeStruct, FieldTypeUnion, FieldTypeRef, FieldTypeSlice, FieldTypeTime, FieldTypeProtoTimestamp:
+			// Messages always have explicit presence, and repeated fields
+			// can't have it.
+		default:
+			label = "optional"
+		}
+	}
+
+	switch d.Type {
+	case FieldTypeInt:
+		return label, "sint64"
+	case FieldTypeFlatInt:
+		return label, "int64"
+	case FieldTypeUint:
+		return label, "uint64"
+	case FieldTypeFloat32:
+		return label, "float"
+	case FieldTypeFloat64:
+		return label, "double"
+	case FieldTypeString:
+		switch d.LogicalType {
+		case LogicalTypeBytes, LogicalTypeBinary, LogicalTypeIPAddr, LogicalTypeIPPrefix, LogicalTypeBigInt, LogicalTypeBigRat, LogicalTypeDecimal:
+			return label, "bytes"
+		}
+		return label, "string"
+	case FieldTypeBool:
+		return label, "bool"
+	case FieldTypeFixed32:
+		return label, "fixed32"
+	case FieldTypeFixed64:
+		return label, "fixed64"
+	case FieldTypeSFixed32:
+		return label, "sfixed32"
+	case FieldTypeSFixed64:
+		return label, "sfixed64"
+
+	case FieldTypeTime:
+		// TimeCodec is laid out like google.protobuf.Timestamp, but the
+		// fields are zig-zag encoded.
+		return label, w.message("", "PlencTime", &Descriptor{
+			Type: FieldTypeStruct,
+			Elements: []Descriptor{
+				{Index: 1, Name: "seconds", Type: FieldTypeInt},
+				{Index: 2, Name: "nanos", Type: FieldTypeInt},
+			},
+		})
+	case FieldTypeProtoTimestamp:
+		w.addImport("google/protobuf/timestamp.proto")
+		return label, "google.protobuf.Timestamp"
+
+	case FieldTypeJSONObject, FieldTypeJSONArray:
+		w.report(path, "%s uses a plenc-only encoding", d.Type)
+		return label, "bytes"
+
+	case FieldTypeStruct, FieldTypeUnion:
+		return label, w.message(path, protoName(d.TypeName, parent+protoName(d.Name, "")), d)
+	case FieldTypeRef:
+		// The enclosing struct's message is already defined
+		for i := len(w.scope) - 1; i >= 0; i-- {
+			if w.scope[i].typeName == d.TypeName {
+				return label, w.scope[i].name
+			}
+		}
+		w.report(path, "no enclosing struct %s for reference", d.TypeName)
+		return label, "bytes"
+
+	case FieldTypeSlice:
+		if len(d.Elements) != 1 {
+			w.report(path, "slice descriptors should have exactly one element")
+			return "repeated", "bytes"
+		}
+		// Anonymous structs within the slice are named after the field
+		elt := d.Elements[0]
+		if elt.Name == "" {
+			elt.Name = d.Name
+		}
+
+		if !w.opts.CompatibleArrays && !d.isPacked() {
+			if d.LogicalType == LogicalTypeMap {
+				w.report(path, "map uses plenc's WTSlice encoding")
+			} else {
+				w.report(path, "slice uses plenc's WTSlice encoding")
+			}
+		}
+
+		if d.LogicalType == LogicalTypeMap && isProtoMapEntry(&elt) {
+			_, key := w.fieldType(path+"[].key", parent, &elt.Elements[0])
+			_, value := w.fieldType(path+"[].value", parent, &elt.Elements[1])
+			return "", fmt.Sprintf("map<%s, %s>", key, value)
+		}
+
+		if elt.Type == FieldTypeSlice {
+			w.report(path, "slices of slices have no protobuf equivalent")
+			return "repeated", "bytes"
+		}
+
+		_, typ := w.fieldType(path+"[]", parent, &elt)
+		return "repeated", typ
+	}
+
+	w.report(path, "unexpected type %s", d.Type)
+	return label, "bytes"
+}
+
+// isProtoMapEntry returns true if d is a map entry that can be written as a
+// protobuf map.
+func isProtoMapEntry(d *Descriptor) bool {
+	if d.LogicalType != LogicalTypeMapEntry || len(d.Elements) != 2 {
+		return false
+	}
+	switch d.Elements[0].Type {
+	case FieldTypeInt, FieldTypeFlatInt, FieldTypeUint, FieldTypeString, FieldTypeBool,
+		FieldTypeFixed32, FieldTypeFixed64, FieldTypeSFixed32, FieldTypeSFixed64:
+	default:
+		return false
+	}
+	return d.Elements[1].wireType() != plenccore.WTSlice && d.Elements[1].Type != FieldTypeSlice
+}
+
+// protoName converts a Go name into a valid protobuf identifier. If name is
+// empty it returns def.
+func protoName(name, def string) string {
+	if name == "" {
+		return def
+	}
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || r < unicode.MaxASCII && (unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return strings.TrimRight(b.String(), "_")
+}
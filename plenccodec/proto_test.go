@@ -0,0 +1,285 @@
+package plenccodec_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+type protoSub struct {
+	A int    `plenc:"1"`
+	B string `plenc:"2"`
+}
+
+type protoThing struct {
+	A int                 `plenc:"1"`
+	B int64               `plenc:"2,flat"`
+	C uint32              `plenc:"3"`
+	D float32             `plenc:"4"`
+	E float64             `plenc:"5"`
+	F string              `plenc:"6"`
+	G bool                `plenc:"7"`
+	H uint64              `plenc:"8,fixed"`
+	I int32               `plenc:"9,fixed"`
+	J *int                `plenc:"10"`
+	K protoSub            `plenc:"11"`
+	L []protoSub          `plenc:"12"`
+	M []int               `plenc:"13"`
+	N map[string]protoSub `plenc:"14"`
+	O time.Time           `plenc:"15"`
+	P []struct {
+		Q float64 `plenc:"1"`
+	} `plenc:"16"`
+	R [][]string `plenc:"17"`
+}
+
+func TestProto(t *testing.T) {
+	var p plenc.Plenc
+	p.ProtoCompatibleArrays = true
+	p.ProtoCompatibleTime = true
+	p.RegisterDefaultCodecs()
+
+	c, err := p.CodecForType(reflect.TypeFor[protoThing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	out, problems, err := d.Proto(plenccodec.ProtoOptions{Package: "plenc.test", CompatibleArrays: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const exp = `syntax = "proto3";
+
+package plenc.test;
+
+import "google/protobuf/timestamp.proto";
+
+message protoThing {
+  sint64 A = 1;
+  int64 B = 2;
+  uint64 C = 3;
+  float D = 4;
+  double E = 5;
+  string F = 6;
+  bool G = 7;
+  fixed64 H = 8;
+  sfixed32 I = 9;
+  optional sint64 J = 10;
+  protoSub K = 11;
+  repeated protoSub L = 12;
+  repeated sint64 M = 13;
+  map<string, protoSub> N = 14;
+  google.protobuf.Timestamp O = 15;
+  repeated protoThingP P = 16;
+  repeated bytes R = 17;
+}
+
+message protoSub {
+  sint64 A = 1;
+  string B = 2;
+}
+
+message protoThingP {
+  double Q = 1;
+}
+`
+	if diff := cmp.Diff(exp, string(out)); diff != "" {
+		t.Fatal(diff)
+	}
+
+	expProblems := []plenccodec.Incompatibility{
+		{Path: "R", Reason: "slices of slices have no protobuf equivalent"},
+	}
+	if diff := cmp.Diff(expProblems, problems); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestProtoPlencOnly(t *testing.T) {
+	type thing struct {
+		A []string       `plenc:"1"`
+		B map[string]int `plenc:"2"`
+		C time.Time      `plenc:"3"`
+		D map[string]any `plenc:"4"`
+		E []int          `plenc:"5"`
+	}
+
+	var p plenc.Plenc
+	p.RegisterDefaultCodecs()
+	p.RegisterCodec(reflect.TypeFor[map[string]any](), plenccodec.JSONMapCodec{})
+	c, err := p.CodecForType(reflect.TypeFor[thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	out, problems, err := d.Proto(plenccodec.ProtoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const exp = `syntax = "proto3";
+
+message thing {
+  repeated string A = 1;
+  map<string, sint64> B = 2;
+  PlencTime C = 3;
+  bytes D = 4;
+  repeated sint64 E = 5;
+}
+
+message PlencTime {
+  sint64 seconds = 1;
+  sint64 nanos = 2;
+}
+`
+	if diff := cmp.Diff(exp, string(out)); diff != "" {
+		t.Fatal(diff)
+	}
+
+	expProblems := []plenccodec.Incompatibility{
+		{Path: "A", Reason: "slice uses plenc's WTSlice encoding"},
+		{Path: "B", Reason: "map uses plenc's WTSlice encoding"},
+		{Path: "D", Reason: "FieldTypeJSONObject uses a plenc-only encoding"},
+	}
+	if diff := cmp.Diff(expProblems, problems); diff != "" {
+		t.Fatal(diff)
+	}
+
+	if _, _, err := (&plenccodec.Descriptor{Type: plenccodec.FieldTypeInt}).Proto(plenccodec.ProtoOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestProtoRecursive(t *testing.T) {
+	c, err := plenc.CodecForType(reflect.TypeFor[treeNode]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	out, _, err := d.Proto(plenccodec.ProtoOptions{CompatibleArrays: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const exp = `syntax = "proto3";
+
+message treeNode {
+  sint64 Value = 1;
+  repeated treeNode Children = 2;
+  treeNode Next = 3;
+  map<string, treeNode> Named = 4;
+  otherNode Other = 5;
+}
+
+message otherNode {
+  string Name = 1;
+  treeNode Tree = 2;
+}
+`
+	if diff := cmp.Diff(exp, string(out)); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestProtoBytes(t *testing.T) {
+	type thing struct {
+		A []byte  `plenc:"1"`
+		B [4]byte `plenc:"2"`
+		C string  `plenc:"3"`
+	}
+
+	c, err := plenc.CodecForType(reflect.TypeFor[thing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	out, problems, err := d.Proto(plenccodec.ProtoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const exp = `syntax = "proto3";
+
+message thing {
+  bytes A = 1;
+  bytes B = 2;
+  string C = 3;
+}
+`
+	if diff := cmp.Diff(exp, string(out)); diff != "" {
+		t.Fatal(diff)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+}
+
+func TestProtoSameName(t *testing.T) {
+	// Types in different packages can have the same name.
+	item := plenccodec.Descriptor{
+		Type:     plenccodec.FieldTypeStruct,
+		TypeName: "Item",
+		Elements: []plenccodec.Descriptor{
+			{Index: 1, Name: "X", Type: plenccodec.FieldTypeInt},
+		},
+	}
+	otherItem := plenccodec.Descriptor{
+		Type:     plenccodec.FieldTypeStruct,
+		TypeName: "Item",
+		Elements: []plenccodec.Descriptor{
+			{Index: 1, Name: "Y", Type: plenccodec.FieldTypeString},
+			{Index: 2, Name: "Next", Type: plenccodec.FieldTypeRef, TypeName: "Item"},
+		},
+	}
+	field := func(index int, name string, d plenccodec.Descriptor) plenccodec.Descriptor {
+		d.Index, d.Name = index, name
+		return d
+	}
+	d := plenccodec.Descriptor{
+		Type:     plenccodec.FieldTypeStruct,
+		TypeName: "Thing",
+		Elements: []plenccodec.Descriptor{
+			field(1, "A", item),
+			field(2, "B", otherItem),
+			field(3, "C", item),
+		},
+	}
+
+	out, problems, err := d.Proto(plenccodec.ProtoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const exp = `syntax = "proto3";
+
+message Thing {
+  Item A = 1;
+  Item2 B = 2;
+  Item C = 3;
+}
+
+message Item {
+  sint64 X = 1;
+}
+
+message Item2 {
+  string Y = 1;
+  Item2 Next = 2;
+}
+`
+	if diff := cmp.Diff(exp, string(out)); diff != "" {
+		t.Fatal(diff)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+}
@@ -0,0 +1,405 @@
+package plenccodec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"net/url"
+	"time"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// DurationCodec is a codec for time.Duration. It is encoded like an int64,
+// but is described with LogicalTypeDuration.
+type DurationCodec struct {
+	IntCodec[int64]
+}
+
+func (DurationCodec) New() unsafe.Pointer {
+	return unsafe.Pointer(new(time.Duration))
+}
+
+func (DurationCodec) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeInt, LogicalType: LogicalTypeDuration}
+}
+
+// IPAddrCodec is a codec for netip.Addr. The address is encoded as 4 or 16
+// bytes followed by any IPv6 zone, as written by netip.Addr.MarshalBinary.
+type IPAddrCodec struct{}
+
+func (IPAddrCodec) Omit(ptr unsafe.Pointer) bool {
+	return !(*netip.Addr)(ptr).IsValid()
+}
+
+func (IPAddrCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if err := (*netip.Addr)(ptr).UnmarshalBinary(data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (IPAddrCodec) New() unsafe.Pointer {
+	return unsafe.Pointer(new(netip.Addr))
+}
+
+func (IPAddrCodec) WireType() plenccore.WireType {
+	return plenccore.WTLength
+}
+
+func (IPAddrCodec) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeString, LogicalType: LogicalTypeIPAddr}
+}
+
+func (IPAddrCodec) size(a netip.Addr) int {
+	switch {
+	case a.Is4():
+		return 4
+	case a.Is6():
+		return 16 + len(a.Zone())
+	}
+	return 0
+}
+
+func (c IPAddrCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	l := c.size(*(*netip.Addr)(ptr))
+	if len(tag) != 0 {
+		l += len(tag) + plenccore.SizeVarUint(uint64(l))
+	}
+	return l
+}
+
+func (c IPAddrCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	a := *(*netip.Addr)(ptr)
+	if len(tag) != 0 {
+		data = append(data, tag...)
+		data = plenccore.AppendVarUint(data, uint64(c.size(a)))
+	}
+	data, _ = a.AppendBinary(data)
+	return data
+}
+
+// IPPrefixCodec is a codec for netip.Prefix. The prefix is encoded as the
+// address followed by a byte with the prefix length, as written by
+// netip.Prefix.MarshalBinary.
+type IPPrefixCodec struct{}
+
+func (IPPrefixCodec) Omit(ptr unsafe.Pointer) bool {
+	return !(*netip.Prefix)(ptr).IsValid()
+}
+
+func (IPPrefixCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if err := (*netip.Prefix)(ptr).UnmarshalBinary(data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (IPPrefixCodec) New() unsafe.Pointer {
+	return unsafe.Pointer(new(netip.Prefix))
+}
+
+func (IPPrefixCodec) WireType() plenccore.WireType {
+	return plenccore.WTLength
+}
+
+func (IPPrefixCodec) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeString, LogicalType: LogicalTypeIPPrefix}
+}
+
+func (IPPrefixCodec) size(p netip.Prefix) int {
+	return IPAddrCodec{}.size(p.Addr()) + 1
+}
+
+func (c IPPrefixCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	l := c.size(*(*netip.Prefix)(ptr))
+	if len(tag) != 0 {
+		l += len(tag) + plenccore.SizeVarUint(uint64(l))
+	}
+	return l
+}
+
+func (c IPPrefixCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	p := *(*netip.Prefix)(ptr)
+	if len(tag) != 0 {
+		data = append(data, tag...)
+		data = plenccore.AppendVarUint(data, uint64(c.size(p)))
+	}
+	data, _ = p.AppendBinary(data)
+	return data
+}
+
+// BigIntCodec is a codec for big.Int. Use it with *big.Int fields too. The
+// value is encoded as a sign byte, 0 for positive and 1 for negative,
+// followed by the big-endian bytes of the absolute value.
+type BigIntCodec struct{}
+
+func (BigIntCodec) Omit(ptr unsafe.Pointer) bool {
+	return (*big.Int)(ptr).Sign() == 0
+}
+
+func (BigIntCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if err := readBigInt(data, (*big.Int)(ptr)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (BigIntCodec) New() unsafe.Pointer {
+	return unsafe.Pointer(new(big.Int))
+}
+
+func (BigIntCodec) WireType() plenccore.WireType {
+	return plenccore.WTLength
+}
+
+func (BigIntCodec) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeString, LogicalType: LogicalTypeBigInt}
+}
+
+func (BigIntCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	l := sizeBigInt((*big.Int)(ptr))
+	if len(tag) != 0 {
+		l += len(tag) + plenccore.SizeVarUint(uint64(l))
+	}
+	return l
+}
+
+func (BigIntCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	x := (*big.Int)(ptr)
+	if len(tag) != 0 {
+		data = append(data, tag...)
+		data = plenccore.AppendVarUint(data, uint64(sizeBigInt(x)))
+	}
+	return appendBigInt(data, x)
+}
+
+func sizeBigInt(x *big.Int) int {
+	return 1 + (x.BitLen()+7)/8
+}
+
+func appendBigInt(data []byte, x *big.Int) []byte {
+	var sign byte
+	if x.Sign() < 0 {
+		sign = 1
+	}
+	data = append(data, sign)
+	l := len(data)
+	data = append(data, make([]byte, (x.BitLen()+7)/8)...)
+	x.FillBytes(data[l:])
+	return data
+}
+
+func readBigInt(data []byte, x *big.Int) error {
+	if len(data) == 0 {
+		x.SetInt64(0)
+		return nil
+	}
+	x.SetBytes(data[1:])
+	switch data[0] {
+	case 0:
+	case 1:
+		x.Neg(x)
+	default:
+		return fmt.Errorf("invalid sign byte %d for big.Int", data[0])
+	}
+	return nil
+}
+
+// BigRatCodec is a codec for big.Rat. Use it with *big.Rat fields too. The
+// numerator is encoded as for BigIntCodec, prefixed by its length as a
+// varint. The big-endian bytes of the denominator follow.
+type BigRatCodec struct{}
+
+func (BigRatCodec) Omit(ptr unsafe.Pointer) bool {
+	return (*big.Rat)(ptr).Sign() == 0
+}
+
+func (BigRatCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if err := readBigRat(data, (*big.Rat)(ptr)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (BigRatCodec) New() unsafe.Pointer {
+	return unsafe.Pointer(new(big.Rat))
+}
+
+func (BigRatCodec) WireType() plenccore.WireType {
+	return plenccore.WTLength
+}
+
+func (BigRatCodec) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeString, LogicalType: LogicalTypeBigRat}
+}
+
+func (BigRatCodec) size(r *big.Rat) int {
+	l := sizeBigInt(r.Num())
+	return plenccore.SizeVarUint(uint64(l)) + l + (r.Denom().BitLen()+7)/8
+}
+
+func (c BigRatCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	l := c.size((*big.Rat)(ptr))
+	if len(tag) != 0 {
+		l += len(tag) + plenccore.SizeVarUint(uint64(l))
+	}
+	return l
+}
+
+func (c BigRatCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	r := (*big.Rat)(ptr)
+	if len(tag) != 0 {
+		data = append(data, tag...)
+		data = plenccore.AppendVarUint(data, uint64(c.size(r)))
+	}
+	data = plenccore.AppendVarUint(data, uint64(sizeBigInt(r.Num())))
+	data = appendBigInt(data, r.Num())
+	return append(data, r.Denom().Bytes()...)
+}
+
+func readBigRat(data []byte, r *big.Rat) error {
+	if len(data) == 0 {
+		r.SetInt64(0)
+		return nil
+	}
+	l, n := plenccore.ReadVarUint(data)
+	if n <= 0 || l > uint64(len(data)-n) {
+		return fmt.Errorf("invalid numerator length for big.Rat")
+	}
+	var num, denom big.Int
+	if err := readBigInt(data[n:n+int(l)], &num); err != nil {
+		return err
+	}
+	denom.SetBytes(data[n+int(l):])
+	if denom.Sign() == 0 {
+		return fmt.Errorf("zero denominator for big.Rat")
+	}
+	r.SetFrac(&num, &denom)
+	return nil
+}
+
+// URLCodec is a codec for url.URL. The URL is encoded as a string.
+type URLCodec struct{}
+
+func (URLCodec) Omit(ptr unsafe.Pointer) bool {
+	return *(*url.URL)(ptr) == url.URL{}
+}
+
+func (URLCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	u, err := url.Parse(string(data))
+	if err != nil {
+		return 0, err
+	}
+	*(*url.URL)(ptr) = *u
+	return len(data), nil
+}
+
+func (URLCodec) New() unsafe.Pointer {
+	return unsafe.Pointer(new(url.URL))
+}
+
+func (URLCodec) WireType() plenccore.WireType {
+	return plenccore.WTLength
+}
+
+func (URLCodec) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeString, LogicalType: LogicalTypeURL}
+}
+
+func (URLCodec) Size(ptr unsafe.Pointer, tag []byte) int {
+	l := len((*url.URL)(ptr).String())
+	if len(tag) != 0 {
+		l += len(tag) + plenccore.SizeVarUint(uint64(l))
+	}
+	return l
+}
+
+func (URLCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
+	s := (*url.URL)(ptr).String()
+	if len(tag) != 0 {
+		data = append(data, tag...)
+		data = plenccore.AppendVarUint(data, uint64(len(s)))
+	}
+	return append(data, s...)
+}
+
+// logicalString converts the encoded data of a FieldTypeString with the
+// given logical type into the string Descriptor.Read outputs.
+func logicalString(lt LogicalType, data string) (string, error) {
+	switch lt {
+	case LogicalTypeBinary:
+		return base64.StdEncoding.EncodeToString([]byte(data)), nil
+	case LogicalTypeIPAddr:
+		var a netip.Addr
+		if err := a.UnmarshalBinary([]byte(data)); err != nil {
+			return "", err
+		}
+		return a.String(), nil
+	case LogicalTypeIPPrefix:
+		var p netip.Prefix
+		if err := p.UnmarshalBinary([]byte(data)); err != nil {
+			return "", err
+		}
+		return p.String(), nil
+	case LogicalTypeBigInt:
+		var x big.Int
+		if err := readBigInt([]byte(data), &x); err != nil {
+			return "", err
+		}
+		return x.String(), nil
+	case LogicalTypeBigRat:
+		var r big.Rat
+		if err := readBigRat([]byte(data), &r); err != nil {
+			return "", err
+		}
+		return r.RatString(), nil
+	case LogicalTypeDecimal:
+		coefficient, exponent, err := readDecimal([]byte(data))
+		if err != nil {
+			return "", err
+		}
+		return formatDecimal(coefficient, int(exponent)), nil
+	}
+	return data, nil
+}
+
+// logicalBytes is the reverse of logicalString. It converts a string as
+// output by Descriptor.Read into the encoded data.
+func logicalBytes(dst []byte, lt LogicalType, s string) ([]byte, error) {
+	switch lt {
+	case LogicalTypeBinary:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode base64 binary data. %w", err)
+		}
+		return append(dst, b...), nil
+	case LogicalTypeIPAddr:
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, err
+		}
+		return a.AppendBinary(dst)
+	case LogicalTypeIPPrefix:
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		return p.AppendBinary(dst)
+	case LogicalTypeBigInt:
+		x, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse %q as an integer", s)
+		}
+		return appendBigInt(dst, x), nil
+	case LogicalTypeBigRat:
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse %q as a rational number", s)
+		}
+		return BigRatCodec{}.Append(dst, unsafe.Pointer(r), nil), nil
+	}
+	return append(dst, s...), nil
+}
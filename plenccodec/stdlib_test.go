@@ -0,0 +1,176 @@
+package plenccodec_test
+
+import (
+	"math/big"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+type stdlibThing struct {
+	A time.Duration   `plenc:"1"`
+	B netip.Addr      `plenc:"2"`
+	C netip.Prefix    `plenc:"3"`
+	D *big.Int        `plenc:"4"`
+	E big.Int         `plenc:"5"`
+	F *big.Rat        `plenc:"6"`
+	G url.URL         `plenc:"7"`
+	H []netip.Addr    `plenc:"8"`
+	I *url.URL        `plenc:"9"`
+	J []*big.Int      `plenc:"10"`
+	K []time.Duration `plenc:"11"`
+}
+
+var stdlibComparers = cmp.Options{
+	cmp.Comparer(func(a, b netip.Addr) bool { return a == b }),
+	cmp.Comparer(func(a, b netip.Prefix) bool { return a == b }),
+	cmp.Comparer(func(a, b big.Int) bool { return a.Cmp(&b) == 0 }),
+	cmp.Comparer(func(a, b *big.Int) bool {
+		if a == nil || b == nil {
+			return a == b
+		}
+		return a.Cmp(b) == 0
+	}),
+	cmp.Comparer(func(a, b *big.Rat) bool {
+		if a == nil || b == nil {
+			return a == b
+		}
+		return a.Cmp(b) == 0
+	}),
+}
+
+func TestStdlibCodecs(t *testing.T) {
+	f := fuzz.New().NilChance(0.2).Funcs(
+		func(a *netip.Addr, c fuzz.Continue) {
+			switch c.Intn(3) {
+			case 0:
+				*a = netip.Addr{}
+			case 1:
+				var b [4]byte
+				c.Fuzz(&b)
+				*a = netip.AddrFrom4(b)
+			case 2:
+				var b [16]byte
+				c.Fuzz(&b)
+				*a = netip.AddrFrom16(b)
+				if c.RandBool() {
+					*a = a.WithZone("eth0")
+				}
+			}
+		},
+		func(p *netip.Prefix, c fuzz.Continue) {
+			var a netip.Addr
+			c.Fuzz(&a)
+			if !a.IsValid() {
+				*p = netip.Prefix{}
+				return
+			}
+			*p = netip.PrefixFrom(a.WithZone(""), c.Intn(a.BitLen()+1))
+		},
+		func(i *big.Int, c fuzz.Continue) {
+			i.SetInt64(c.Int63())
+			i.Lsh(i, uint(c.Intn(100)))
+			if c.RandBool() {
+				i.Neg(i)
+			}
+		},
+		func(r *big.Rat, c fuzz.Continue) {
+			r.SetFrac64(c.Int63()-c.Int63(), c.Int63()+1)
+		},
+		func(u *url.URL, c fuzz.Continue) {
+			if c.RandBool() {
+				*u = url.URL{}
+				return
+			}
+			*u = url.URL{Scheme: "https", Host: "example.com", Path: "/" + c.RandString(), RawQuery: "a=b"}
+		},
+	)
+
+	for range 1000 {
+		var in stdlibThing
+		f.Fuzz(&in)
+
+		data, err := plenc.Marshal(nil, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out stdlibThing
+		if err := plenc.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(in, out, stdlibComparers); diff != "" {
+			t.Fatal(diff)
+		}
+	}
+}
+
+func TestStdlibJSON(t *testing.T) {
+	in := stdlibThing{
+		A: 1500 * time.Millisecond,
+		B: netip.MustParseAddr("10.0.0.1"),
+		C: netip.MustParsePrefix("fe80::/10"),
+		D: big.NewInt(-12345678901234),
+		F: big.NewRat(-3, 4),
+		G: url.URL{Scheme: "https", Host: "example.com", Path: "/a b"},
+		H: []netip.Addr{netip.MustParseAddr("::1"), netip.MustParseAddr("fe80::1%eth0")},
+		K: []time.Duration{time.Hour, -time.Microsecond},
+	}
+	in.E.SetString("123456789012345678901234567890", 10)
+
+	data, err := plenc.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := plenc.CodecForType(reflect.TypeFor[stdlibThing]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Descriptor()
+
+	var j plenccodec.JSONOutput
+	if err := d.Read(&j, data); err != nil {
+		t.Fatal(err)
+	}
+	expJSON := `{
+  "A": "1.5s",
+  "B": "10.0.0.1",
+  "C": "fe80::/10",
+  "D": "-12345678901234",
+  "E": "123456789012345678901234567890",
+  "F": "-3/4",
+  "G": "https://example.com/a%20b",
+  "H": [
+    "::1",
+    "fe80::1%eth0"
+  ],
+  "K": [
+    "1h0m0s",
+    "-1µs"
+  ]
+}
+`
+	if diff := cmp.Diff(expJSON, string(j.Done())); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// The JSON can be encoded back to the same data
+	data2, err := d.EncodeJSON(nil, []byte(expJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out stdlibThing
+	if err := plenc.Unmarshal(data2, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out, stdlibComparers); diff != "" {
+		t.Fatal(diff)
+	}
+}
@@ -100,7 +100,7 @@ func (c BytesCodec) Omit(ptr unsafe.Pointer) bool {
 }
 
 func (BytesCodec) Descriptor() Descriptor {
-	return Descriptor{Type: FieldTypeString}
+	return Descriptor{Type: FieldTypeString, LogicalType: LogicalTypeBytes}
 }
 
 func (c BytesCodec) Size(ptr unsafe.Pointer, tag []byte) int {
@@ -119,6 +119,40 @@ func (c BytesCodec) Append(data []byte, ptr unsafe.Pointer, tag []byte) []byte {
 	return c.append(data, ptr)
 }
 
+// ZeroCopyStringCodec is a codec for strings that does not copy the data when
+// reading. The strings it reads point directly into the buffer passed to
+// Unmarshal. This saves an allocation per string, but the strings will change
+// if the buffer is modified or re-used, so it is only safe to use if the buffer
+// is left untouched for as long as the decoded values are in use.
+type ZeroCopyStringCodec struct {
+	StringCodec
+}
+
+// Read decodes a string without copying
+func (ZeroCopyStringCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	*(*string)(ptr) = bytesToString(data)
+	return len(data), nil
+}
+
+// ZeroCopyBytesCodec is a codec for byte slices that does not copy the data
+// when reading. The slices it reads point directly into the buffer passed to
+// Unmarshal, so it has the same caveats as ZeroCopyStringCodec. The capacity
+// of the slices is limited to their length, so appending to them does not
+// overwrite the buffer.
+type ZeroCopyBytesCodec struct {
+	BytesCodec
+}
+
+// Read decodes a []byte without copying
+func (ZeroCopyBytesCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
+	if len(data) == 0 {
+		*(*[]byte)(ptr) = nil
+		return 0, nil
+	}
+	*(*[]byte)(ptr) = data[:len(data):len(data)]
+	return len(data), nil
+}
+
 type Interner interface {
 	WithInterning() Codec
 }
@@ -130,7 +164,7 @@ type InternedStringCodec struct {
 func (c InternedStringCodec) Read(data []byte, ptr unsafe.Pointer, wt plenccore.WireType) (n int, err error) {
 	// Note this will copy the string if it stores it, so we can do this unsafe trick
 	// without worrying about the underlying data changing.
-	s := unique.Make(unsafe.String(unsafe.SliceData(data), len(data))).Value()
+	s := unique.Make(bytesToString(data)).Value()
 
 	*(*string)(ptr) = s
 	return len(data), nil
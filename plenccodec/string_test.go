@@ -198,6 +198,58 @@ func BenchmarkInternedString(b *testing.B) {
 	}
 }
 
+func TestZeroCopy(t *testing.T) {
+	type thing struct {
+		A string   `plenc:"1"`
+		B []byte   `plenc:"2"`
+		C []string `plenc:"3"`
+		D string   `plenc:"4,intern"`
+		E []byte   `plenc:"5"`
+	}
+
+	var p plenc.Plenc
+	p.ZeroCopy = true
+	p.RegisterDefaultCodecs()
+
+	in := thing{
+		A: "hello",
+		B: []byte("bytes"),
+		C: []string{"a", "b"},
+		D: "interned",
+	}
+	data, err := p.Marshal(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out thing
+	if err := p.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Fatal(diff)
+	}
+
+	if cap(out.B) != len(out.B) {
+		t.Errorf("capacity of bytes should be limited to their length. cap %d, len %d", cap(out.B), len(out.B))
+	}
+
+	// The strings and bytes are pointing into the data, so they change if
+	// the data changes. Interned strings do not.
+	for i := range data {
+		data[i] = 'x'
+	}
+	exp := thing{
+		A: "xxxxx",
+		B: []byte("xxxxx"),
+		C: []string{"x", "x"},
+		D: "interned",
+	}
+	if diff := cmp.Diff(exp, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func TestStringSlice(t *testing.T) {
 	v := []string{
 		"M珣X觻%ƾƽ9J9S腸H滩Ýk",
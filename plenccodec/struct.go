@@ -3,6 +3,7 @@ package plenccodec
 import (
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
@@ -17,13 +18,48 @@ type wrappedCodecRegistry struct {
 	typ   reflect.Type
 	tag   string
 	codec Codec
+	// building holds the codecs being built, in the order the builds started.
+	// Any that load the codec we're building contain it. We keep those codecs
+	// to ourselves, as they describe the struct as a reference to an enclosing
+	// struct. Other codecs go in the real registry.
+	building []buildingCodec
+	local    map[wrappedKey]Codec
+}
+
+type wrappedKey struct {
+	typ reflect.Type
+	tag string
+}
+
+type buildingCodec struct {
+	key        wrappedKey
+	referenced bool
 }
 
 func (w *wrappedCodecRegistry) Load(typ reflect.Type, tag string) Codec {
 	if typ == w.typ && tag == w.tag {
-		return w.codec
+		w.referenced()
+		return refCodec{Codec: w.codec, name: typ.Name()}
+	}
+	key := wrappedKey{typ: typ, tag: tag}
+	if c, ok := w.local[key]; ok {
+		w.referenced()
+		return c
+	}
+	c := w.CodecRegistry.Load(typ, tag)
+	if c == nil {
+		// The caller will build the codec and pass it to StoreOrSwap
+		w.building = append(w.building, buildingCodec{key: key})
+	}
+	return c
+}
+
+// referenced marks all the codecs being built as containing the codec we're
+// building.
+func (w *wrappedCodecRegistry) referenced() {
+	for i := range w.building {
+		w.building[i].referenced = true
 	}
-	return w.CodecRegistry.Load(typ, tag)
 }
 
 func (w *wrappedCodecRegistry) StoreOrSwap(typ reflect.Type, tag string, codec Codec) Codec {
@@ -33,9 +69,42 @@ func (w *wrappedCodecRegistry) StoreOrSwap(typ reflect.Type, tag string, codec C
 		w.codec = codec
 		return old
 	}
+	key := wrappedKey{typ: typ, tag: tag}
+	for i, b := range slices.Backward(w.building) {
+		if b.key != key {
+			continue
+		}
+		w.building = slices.Delete(w.building, i, i+1)
+		if b.referenced {
+			if w.local == nil {
+				w.local = make(map[wrappedKey]Codec)
+			}
+			w.local[key] = codec
+			return codec
+		}
+		break
+	}
 	return w.CodecRegistry.StoreOrSwap(typ, tag, codec)
 }
 
+// FieldCodecer is implemented by codecs that need a different codec when they
+// are a field of a struct.
+type FieldCodecer interface {
+	FieldCodec() Codec
+}
+
+// refCodec is the codec for a struct within the codec for the same struct.
+// It describes the struct as a FieldTypeRef, so the descriptors of recursive
+// types are finite.
+type refCodec struct {
+	Codec
+	name string
+}
+
+func (c refCodec) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeRef, TypeName: c.name}
+}
+
 func BuildStructCodec(p CodecBuilder, registry CodecRegistry, typ reflect.Type, tag string) (Codec, error) {
 	if typ.Kind() != reflect.Struct {
 		return nil, fmt.Errorf("type must be a struct to build a struct codec")
@@ -53,6 +122,7 @@ func BuildStructCodec(p CodecBuilder, registry CodecRegistry, typ reflect.Type,
 
 	var maxIndex int
 	var count int
+	var reserved []int
 	for i := range typ.NumField() {
 		sf := typ.Field(i)
 
@@ -79,6 +149,13 @@ func BuildStructCodec(p CodecBuilder, registry CodecRegistry, typ reflect.Type,
 			return nil, fmt.Errorf("could not parse plenc tag on field %d %s of %s. %w", i, sf.Name, typ.Name(), err)
 		}
 
+		if postfix == "reserved" {
+			// This field reserves an index that was used by a removed field.
+			// It isn't encoded.
+			reserved = append(reserved, index)
+			continue
+		}
+
 		field := &c.fields[count]
 		count++
 		field.offset = sf.Offset
@@ -110,6 +187,10 @@ func BuildStructCodec(p CodecBuilder, registry CodecRegistry, typ reflect.Type,
 			}
 		}
 
+		if fcc, ok := fc.(FieldCodecer); ok {
+			fc = fcc.FieldCodec()
+		}
+
 		field.codec = fc
 		field.tag = plenccore.AppendTag(nil, fc.WireType(), field.index)
 		if sf.Type.Kind() == reflect.Map {
@@ -123,6 +204,9 @@ func BuildStructCodec(p CodecBuilder, registry CodecRegistry, typ reflect.Type,
 		if c.fieldsByIndex[f.index].codec != nil {
 			return nil, fmt.Errorf("failed building codec for %s. Multiple fields have index %d", typ.Name(), f.index)
 		}
+		if slices.Contains(reserved, f.index) {
+			return nil, fmt.Errorf("failed building codec for %s. Field %s uses reserved index %d", typ.Name(), f.name, f.index)
+		}
 		c.fieldsByIndex[f.index] = shortDesc{
 			codec:  f.codec,
 			offset: f.offset,
@@ -167,6 +167,10 @@ func (tc TimeCompatCodec) append(data []byte, ptr unsafe.Pointer) []byte {
 	return data
 }
 
+func (TimeCompatCodec) Descriptor() Descriptor {
+	return Descriptor{Type: FieldTypeProtoTimestamp, LogicalType: LogicalTypeTimestamp}
+}
+
 func (c TimeCompatCodec) Size(ptr unsafe.Pointer, tag []byte) int {
 	l := c.size(ptr)
 	if len(tag) != 0 {
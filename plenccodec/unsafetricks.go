@@ -14,6 +14,12 @@ type sliceHeader struct {
 	Cap  int
 }
 
+// bytesToString returns a string that shares its memory with b. The string
+// will change if b is modified.
+func bytesToString(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
 // typedslicecopy copies a slice of elemType values from src to dst,
 // returning the number of elements copied.
 //
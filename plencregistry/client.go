@@ -0,0 +1,152 @@
+package plencregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+// Client talks to a registry served by NewHandler. Schemas never change once
+// registered, so the client caches the schemas it fetches by ID.
+type Client struct {
+	// BaseURL is the URL NewHandler is served at.
+	BaseURL string
+	// HTTPClient is used to make requests. NewClient sets it to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	mu    sync.Mutex
+	cache map[int]Schema
+}
+
+// NewClient returns a Client for the registry served at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Register registers d as the next version of subject. See Registry.Register.
+func (c *Client) Register(ctx context.Context, subject string, d plenccodec.Descriptor) (Schema, error) {
+	body, err := json.Marshal(&d)
+	if err != nil {
+		return Schema{}, err
+	}
+	var s Schema
+	if err := c.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", body, &s); err != nil {
+		return Schema{}, err
+	}
+	c.store(s)
+	return s, nil
+}
+
+// Schema returns the schema with the given ID.
+func (c *Client) Schema(ctx context.Context, id int) (Schema, error) {
+	c.mu.Lock()
+	s, ok := c.cache[id]
+	c.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	if err := c.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &s); err != nil {
+		return Schema{}, err
+	}
+	c.store(s)
+	return s, nil
+}
+
+// Subjects returns the names of all the subjects in the registry.
+func (c *Client) Subjects(ctx context.Context) ([]string, error) {
+	var subjects []string
+	err := c.do(ctx, http.MethodGet, "/subjects", nil, &subjects)
+	return subjects, err
+}
+
+// Versions returns the versions registered under subject.
+func (c *Client) Versions(ctx context.Context, subject string) ([]int, error) {
+	var versions []int
+	err := c.do(ctx, http.MethodGet, "/subjects/"+url.PathEscape(subject)+"/versions", nil, &versions)
+	return versions, err
+}
+
+// Version returns a version of subject. Version 0 means the latest version.
+func (c *Client) Version(ctx context.Context, subject string, version int) (Schema, error) {
+	v := "latest"
+	if version != 0 {
+		v = strconv.Itoa(version)
+	}
+	var s Schema
+	if err := c.do(ctx, http.MethodGet, "/subjects/"+url.PathEscape(subject)+"/versions/"+v, nil, &s); err != nil {
+		return Schema{}, err
+	}
+	c.store(s)
+	return s, nil
+}
+
+func (c *Client) store(s Schema) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cache == nil {
+		c.cache = make(map[int]Schema)
+	}
+	c.cache[s.ID] = s
+}
+
+// do makes a request and decodes the JSON response into out. Error responses
+// are converted back to ErrNotFound, ErrInvalid and *IncompatibleError where
+// possible.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out any) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("registry request %s %s failed with status %s", method, path, resp.Status)
+		}
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return fmt.Errorf("%s %w", strings.TrimSuffix(e.Error, " "+ErrNotFound.Error()), ErrNotFound)
+		case http.StatusBadRequest:
+			if rest, ok := strings.CutPrefix(e.Error, ErrInvalid.Error()+" "); ok {
+				return fmt.Errorf("%w %s", ErrInvalid, rest)
+			}
+		case http.StatusConflict:
+			if e.IncompatibleError != nil {
+				return e.IncompatibleError
+			}
+		}
+		return fmt.Errorf("registry request %s %s failed. %s", method, path, e.Error)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode registry response. %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package plencregistry_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/philpearl/plenc/plenccodec"
+	"github.com/philpearl/plenc/plencregistry"
+)
+
+func TestClient(t *testing.T) {
+	r, err := plencregistry.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(plencregistry.NewHandler(r))
+	defer s.Close()
+
+	ctx := context.Background()
+	c := plencregistry.NewClient(s.URL + "/")
+
+	v1, err := c.Register(ctx, "users/v", descriptorFor[userV1](t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := c.Register(ctx, "users/v", descriptorFor[userV2](t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.ID != 1 || v2.ID != 2 || v2.Version != 2 || v2.Subject != "users/v" {
+		t.Fatalf("unexpected schemas %#v %#v", v1, v2)
+	}
+
+	_, err = c.Register(ctx, "users/v", descriptorFor[userV3](t))
+	var incompatible *plencregistry.IncompatibleError
+	if !errors.As(err, &incompatible) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if exp := "schema is not compatible with version 1 of users/v. Avatar: index 3 was used for Age (FieldTypeInt) and is now used for Avatar (FieldTypeString)"; err.Error() != exp {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	subjects, err := c.Subjects(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"users/v"}, subjects); diff != "" {
+		t.Fatal(diff)
+	}
+
+	versions, err := c.Versions(ctx, "users/v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{1, 2}, versions); diff != "" {
+		t.Fatal(diff)
+	}
+
+	latest, err := c.Version(ctx, "users/v", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(v2, latest); diff != "" {
+		t.Fatal(diff)
+	}
+	first, err := c.Version(ctx, "users/v", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(v1, first); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// A fresh client fetches schemas by ID
+	c = plencregistry.NewClient(s.URL)
+	got, err := c.Schema(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(v1, got); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// and caches them
+	s.Close()
+	if _, err := c.Schema(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	r, err := plencregistry.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(plencregistry.NewHandler(r))
+	defer s.Close()
+
+	ctx := context.Background()
+	c := plencregistry.NewClient(s.URL)
+
+	if _, err := c.Schema(ctx, 7); !errors.Is(err, plencregistry.ErrNotFound) || err.Error() != "schema 7 not found" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := c.Version(ctx, "nobody", 0); !errors.Is(err, plencregistry.ErrNotFound) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := c.Versions(ctx, "nobody"); !errors.Is(err, plencregistry.ErrNotFound) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	invalid := plenccodec.Descriptor{Type: plenccodec.FieldTypeStruct, Elements: []plenccodec.Descriptor{
+		{Index: 0, Name: "A", Type: plenccodec.FieldTypeInt},
+	}}
+	if _, err := c.Register(ctx, "users", invalid); !errors.Is(err, plencregistry.ErrInvalid) || err.Error() != "invalid descriptor. A: invalid index 0" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// The problems in the body of a conflict have lower case keys like
+	// everything else.
+	if _, err := c.Register(ctx, "users", descriptorFor[userV1](t)); err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(descriptorFor[userV3](t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(s.URL+"/subjects/users/versions", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conflict map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&conflict)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("unexpected status %s", resp.Status)
+	}
+	if diff := cmp.Diff([]any{map[string]any{
+		"path":   "Avatar",
+		"reason": "index 3 was used for Age (FieldTypeInt) and is now used for Avatar (FieldTypeString)",
+	}}, conflict["problems"]); diff != "" {
+		t.Error(diff)
+	}
+
+	resp, err = http.Post(s.URL+"/subjects/users/versions", "application/json", strings.NewReader("{"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status %s", resp.Status)
+	}
+
+	resp, err = http.Get(s.URL + "/subjects/users/versions/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status %s", resp.Status)
+	}
+}
@@ -0,0 +1,23 @@
+package plencregistry
+
+import (
+	"fmt"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// AppendEnvelope appends the schema ID of a message to data as a varint.
+// Append the plenc-encoded message after it.
+func AppendEnvelope(data []byte, id int) []byte {
+	return plenccore.AppendVarUint(data, uint64(id))
+}
+
+// ReadEnvelope reads the schema ID written by AppendEnvelope from the start of
+// data, and returns it with the rest of the data, which is the message.
+func ReadEnvelope(data []byte) (id int, msg []byte, err error) {
+	v, n := plenccore.ReadVarUint(data)
+	if n <= 0 {
+		return 0, nil, fmt.Errorf("invalid schema ID in message envelope")
+	}
+	return int(v), data[n:], nil
+}
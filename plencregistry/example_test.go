@@ -0,0 +1,81 @@
+package plencregistry_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"reflect"
+
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+	"github.com/philpearl/plenc/plencregistry"
+)
+
+func Example() {
+	type Hat struct {
+		Type string  `plenc:"1"`
+		Size float32 `plenc:"2"`
+	}
+
+	dir, err := os.MkdirTemp("", "plencregistry")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := plencregistry.Open(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	s := httptest.NewServer(plencregistry.NewHandler(r))
+	defer s.Close()
+
+	ctx := context.Background()
+	c := plencregistry.NewClient(s.URL)
+
+	// The producer registers the descriptor of its type, and puts the schema
+	// ID in front of each message.
+	codec, err := plenc.CodecForType(reflect.TypeFor[Hat]())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	schema, err := c.Register(ctx, "hats", codec.Descriptor())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	msg := plencregistry.AppendEnvelope(nil, schema.ID)
+	msg, err = plenc.Marshal(msg, &Hat{Type: "Fedora", Size: 6})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// The consumer doesn't have the Hat type. It fetches the descriptor to
+	// decode the message.
+	id, data, err := plencregistry.ReadEnvelope(msg)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	schema, err = c.Schema(ctx, id)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var j plenccodec.JSONOutput
+	if err := schema.Descriptor.Read(&j, data); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%s", j.Done())
+
+	// Output: {
+	//   "Type": "Fedora",
+	//   "Size": 6
+	// }
+}
@@ -0,0 +1,126 @@
+package plencregistry
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+// maxDescriptorSize limits the size of descriptors the handler accepts.
+const maxDescriptorSize = 1 << 20
+
+// NewHandler returns an http.Handler that serves r. The API is JSON based.
+//
+//   - POST /subjects/{subject}/versions registers the Descriptor in the
+//     request body and returns the Schema.
+//   - GET /subjects lists the subjects.
+//   - GET /subjects/{subject}/versions lists the versions of a subject.
+//   - GET /subjects/{subject}/versions/{version} returns a Schema. The version
+//     may be "latest".
+//   - GET /schemas/ids/{id} returns the Schema with the ID.
+//
+// Errors are returned as an object with an "error" message. An invalid request
+// gives status 400. An incompatible descriptor gives status 409, and the object
+// also has the fields of IncompatibleError.
+func NewHandler(r *Registry) http.Handler {
+	h := handler{r: r}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /subjects/{subject}/versions", h.register)
+	mux.HandleFunc("GET /subjects", h.subjects)
+	mux.HandleFunc("GET /subjects/{subject}/versions", h.versions)
+	mux.HandleFunc("GET /subjects/{subject}/versions/{version}", h.version)
+	mux.HandleFunc("GET /schemas/ids/{id}", h.schema)
+	return mux
+}
+
+type handler struct {
+	r *Registry
+}
+
+// errorResponse is the body of error responses.
+type errorResponse struct {
+	Error string `json:"error"`
+	*IncompatibleError
+}
+
+func (h handler) register(w http.ResponseWriter, req *http.Request) {
+	var d plenccodec.Descriptor
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxDescriptorSize)).Decode(&d); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s, err := h.r.Register(req.PathValue("subject"), d)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+func (h handler) subjects(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, h.r.Subjects())
+}
+
+func (h handler) versions(w http.ResponseWriter, req *http.Request) {
+	versions, err := h.r.Versions(req.PathValue("subject"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+func (h handler) version(w http.ResponseWriter, req *http.Request) {
+	var version int
+	if v := req.PathValue("version"); v != "latest" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			writeError(w, http.StatusBadRequest, errors.New("version must be a positive number or \"latest\""))
+			return
+		}
+	}
+	s, err := h.r.Version(req.PathValue("subject"), version)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+func (h handler) schema(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("schema ID must be a number"))
+		return
+	}
+	s, err := h.r.Schema(id)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// writeError writes err as an errorResponse. Not found, invalid and
+// incompatible errors override the status.
+func writeError(w http.ResponseWriter, status int, err error) {
+	resp := errorResponse{Error: err.Error()}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.As(err, &resp.IncompatibleError):
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,257 @@
+// Package plencregistry is a schema registry for plenc. It stores the
+// Descriptors of plenc types by subject and version, and gives each schema a
+// small numeric ID. Producers register the descriptor of the type they write
+// and put the ID in front of each message, and consumers fetch the descriptor
+// by ID to decode messages, even if they don't have the Go type.
+//
+// A Registry stores schemas in a local directory. NewHandler serves a Registry
+// over HTTP, and Client talks to that handler.
+package plencregistry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/philpearl/plenc/plenccodec"
+)
+
+// Schema is a descriptor registered under a subject.
+type Schema struct {
+	// ID identifies the schema across all subjects.
+	ID int `json:"id"`
+	// Subject is the name the schema is registered under. Typically it names
+	// a topic or a file type.
+	Subject string `json:"subject"`
+	// Version counts the schemas registered under the subject, starting at 1.
+	Version    int                   `json:"version"`
+	Descriptor plenccodec.Descriptor `json:"descriptor"`
+}
+
+// ErrNotFound is returned when a schema, subject or version does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrInvalid is returned when a subject or descriptor can't be registered
+// because it is not valid.
+var ErrInvalid = errors.New("invalid")
+
+// IncompatibleError is returned when a descriptor can't be registered because
+// it is not compatible with an earlier version of the subject.
+type IncompatibleError struct {
+	Subject string `json:"subject"`
+	// Version is the earlier version the descriptor is not compatible with.
+	Version  int                          `json:"version"`
+	Problems []plenccodec.Incompatibility `json:"problems"`
+}
+
+func (e *IncompatibleError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		problems[i] = p.String()
+	}
+	return fmt.Sprintf("schema is not compatible with version %d of %s. %s", e.Version, e.Subject, strings.Join(problems, ", "))
+}
+
+// Registry stores schemas as JSON files in a directory. It is safe for
+// concurrent use, but only one Registry should use a directory at a time.
+type Registry struct {
+	dir string
+
+	mu       sync.Mutex
+	byID     map[int]*Schema
+	subjects map[string][]*Schema
+	nextID   int
+}
+
+// Open opens the registry stored in dir, creating the directory if it does not
+// exist.
+func Open(dir string) (*Registry, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	r := &Registry{
+		dir:      dir,
+		byID:     make(map[int]*Schema),
+		subjects: make(map[string][]*Schema),
+		nextID:   1,
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if _, err := strconv.Atoi(name); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var s Schema
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("could not parse %s. %w", e.Name(), err)
+		}
+		r.add(&s)
+	}
+
+	for _, versions := range r.subjects {
+		slices.SortFunc(versions, func(a, b *Schema) int { return a.Version - b.Version })
+		for i, s := range versions {
+			if s.Version != i+1 {
+				return nil, fmt.Errorf("version %d of %s is missing", i+1, s.Subject)
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r *Registry) add(s *Schema) {
+	r.byID[s.ID] = s
+	r.subjects[s.Subject] = append(r.subjects[s.Subject], s)
+	if s.ID >= r.nextID {
+		r.nextID = s.ID + 1
+	}
+}
+
+// Register adds d to the registry as the next version of subject. If d is
+// already registered under subject then Register returns the existing schema.
+// Otherwise d must be compatible with every earlier version of the subject, as
+// checked by plenccodec.CheckCompatible. If it is not, Register returns an
+// *IncompatibleError.
+func (r *Registry) Register(subject string, d plenccodec.Descriptor) (Schema, error) {
+	if subject == "" {
+		return Schema{}, fmt.Errorf("%w subject. It must not be empty", ErrInvalid)
+	}
+	// Comparing the descriptor with itself finds invalid and duplicate
+	// indexes and references without a target.
+	if problems := plenccodec.CheckCompatible(d, d); len(problems) != 0 {
+		return Schema{}, fmt.Errorf("%w descriptor. %s", ErrInvalid, problems[0])
+	}
+	data, err := json.Marshal(&d)
+	if err != nil {
+		return Schema{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := r.subjects[subject]
+	for _, s := range versions {
+		// Compare the JSON so names must match as well as the encoding.
+		existing, err := json.Marshal(&s.Descriptor)
+		if err != nil {
+			return Schema{}, err
+		}
+		if string(existing) == string(data) {
+			return *s, nil
+		}
+	}
+
+	for _, s := range versions {
+		if problems := plenccodec.CheckCompatible(s.Descriptor, d); len(problems) != 0 {
+			return Schema{}, &IncompatibleError{Subject: subject, Version: s.Version, Problems: problems}
+		}
+	}
+
+	s := &Schema{
+		ID:         r.nextID,
+		Subject:    subject,
+		Version:    len(versions) + 1,
+		Descriptor: d,
+	}
+	if err := r.write(s); err != nil {
+		return Schema{}, err
+	}
+	r.add(s)
+	return *s, nil
+}
+
+// write stores a schema in the registry directory. It writes to a temporary
+// file first so a failure can't leave a partial schema behind.
+func (r *Registry) write(s *Schema) error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	f, err := os.CreateTemp(r.dir, ".schema-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(r.dir, strconv.Itoa(s.ID)+".json"))
+}
+
+// Schema returns the schema with the given ID.
+func (r *Registry) Schema(id int) (Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.byID[id]
+	if !ok {
+		return Schema{}, fmt.Errorf("schema %d %w", id, ErrNotFound)
+	}
+	return *s, nil
+}
+
+// Subjects returns the names of all the subjects in the registry, in order.
+func (r *Registry) Subjects() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subjects := make([]string, 0, len(r.subjects))
+	for subject := range r.subjects {
+		subjects = append(subjects, subject)
+	}
+	slices.Sort(subjects)
+	return subjects
+}
+
+// Versions returns the versions registered under subject.
+func (r *Registry) Versions(subject string) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	schemas, ok := r.subjects[subject]
+	if !ok {
+		return nil, fmt.Errorf("subject %q %w", subject, ErrNotFound)
+	}
+	versions := make([]int, len(schemas))
+	for i, s := range schemas {
+		versions[i] = s.Version
+	}
+	return versions, nil
+}
+
+// Version returns a version of subject. Version 0 means the latest version.
+func (r *Registry) Version(subject string, version int) (Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	schemas, ok := r.subjects[subject]
+	if !ok {
+		return Schema{}, fmt.Errorf("subject %q %w", subject, ErrNotFound)
+	}
+	if version == 0 {
+		version = len(schemas)
+	}
+	if version < 1 || version > len(schemas) {
+		return Schema{}, fmt.Errorf("version %d of subject %q %w", version, subject, ErrNotFound)
+	}
+	return *schemas[version-1], nil
+}
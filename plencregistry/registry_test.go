@@ -0,0 +1,210 @@
+package plencregistry_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/philpearl/plenc"
+	"github.com/philpearl/plenc/plenccodec"
+	"github.com/philpearl/plenc/plencregistry"
+)
+
+type userV1 struct {
+	ID   int    `plenc:"1"`
+	Name string `plenc:"2"`
+	Age  int    `plenc:"3"`
+}
+
+// userV2 drops Age and adds Email
+type userV2 struct {
+	ID    int    `plenc:"1"`
+	Name  string `plenc:"2"`
+	Email string `plenc:"4"`
+}
+
+// userV3 re-uses the index of Age for a field of a different type
+type userV3 struct {
+	ID     int    `plenc:"1"`
+	Name   string `plenc:"2"`
+	Email  string `plenc:"4"`
+	Avatar []byte `plenc:"3"`
+}
+
+func descriptorFor[T any](t *testing.T) plenccodec.Descriptor {
+	t.Helper()
+	c, err := plenc.CodecForType(reflect.TypeFor[T]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Descriptor()
+}
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	r, err := plencregistry.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v1, err := r.Register("users", descriptorFor[userV1](t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := r.Register("users", descriptorFor[userV2](t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := r.Register("others", descriptorFor[userV1](t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.ID != 1 || v1.Version != 1 || v2.ID != 2 || v2.Version != 2 || other.ID != 3 || other.Version != 1 {
+		t.Fatalf("unexpected IDs and versions %d/%d %d/%d %d/%d", v1.ID, v1.Version, v2.ID, v2.Version, other.ID, other.Version)
+	}
+
+	// Registering the same descriptor again gives the existing schema
+	again, err := r.Register("users", descriptorFor[userV1](t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(v1, again); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// userV3 is compatible with v2, but not with v1
+	_, err = r.Register("users", descriptorFor[userV3](t))
+	var incompatible *plencregistry.IncompatibleError
+	if !errors.As(err, &incompatible) || incompatible.Version != 1 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if exp := "schema is not compatible with version 1 of users. Avatar: index 3 was used for Age (FieldTypeInt) and is now used for Avatar (FieldTypeString)"; err.Error() != exp {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if _, err := r.Register("", descriptorFor[userV1](t)); !errors.Is(err, plencregistry.ErrInvalid) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	invalid := plenccodec.Descriptor{Type: plenccodec.FieldTypeStruct, Elements: []plenccodec.Descriptor{
+		{Index: 1, Name: "A", Type: plenccodec.FieldTypeInt},
+		{Index: 1, Name: "B", Type: plenccodec.FieldTypeString},
+	}}
+	_, err = r.Register("invalid", invalid)
+	if !errors.Is(err, plencregistry.ErrInvalid) || err.Error() != "invalid descriptor. B: index 1 is used more than once" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	check := func(t *testing.T, r *plencregistry.Registry) {
+		if diff := cmp.Diff([]string{"others", "users"}, r.Subjects()); diff != "" {
+			t.Error(diff)
+		}
+		versions, err := r.Versions("users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]int{1, 2}, versions); diff != "" {
+			t.Error(diff)
+		}
+		s, err := r.Schema(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(v2, s); diff != "" {
+			t.Error(diff)
+		}
+		latest, err := r.Version("users", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(v2, latest); diff != "" {
+			t.Error(diff)
+		}
+		first, err := r.Version("users", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(v1, first); diff != "" {
+			t.Error(diff)
+		}
+
+		if _, err := r.Schema(4); !errors.Is(err, plencregistry.ErrNotFound) {
+			t.Errorf("unexpected error %v", err)
+		}
+		if _, err := r.Version("users", 3); !errors.Is(err, plencregistry.ErrNotFound) {
+			t.Errorf("unexpected error %v", err)
+		}
+		if _, err := r.Versions("nobody"); !errors.Is(err, plencregistry.ErrNotFound) {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+
+	t.Run("open", func(t *testing.T) { check(t, r) })
+
+	// The schemas are still there when the registry is re-opened
+	r, err = plencregistry.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("reopen", func(t *testing.T) { check(t, r) })
+
+	// New IDs follow on from the stored schemas
+	v3, err := r.Register("others", descriptorFor[userV2](t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v3.ID != 4 || v3.Version != 2 {
+		t.Fatalf("unexpected ID and version %d/%d", v3.ID, v3.Version)
+	}
+}
+
+func TestRegistryMissingVersion(t *testing.T) {
+	dir := t.TempDir()
+	r, err := plencregistry.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Register("users", descriptorFor[userV1](t)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Register("users", descriptorFor[userV2](t)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "1.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plencregistry.Open(dir); err == nil || err.Error() != "version 1 of users is missing" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	in := userV1{ID: 1, Name: "sam"}
+	data := plencregistry.AppendEnvelope(nil, 300)
+	data, err := plenc.Marshal(data, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, msg, err := plencregistry.ReadEnvelope(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 300 {
+		t.Fatalf("unexpected ID %d", id)
+	}
+	var out userV1
+	if err := plenc.Unmarshal(msg, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Fatal(diff)
+	}
+
+	if _, _, err := plencregistry.ReadEnvelope(nil); err == nil {
+		t.Fatal("expected an error for an empty message")
+	}
+}
@@ -0,0 +1,139 @@
+package plenc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"unsafe"
+
+	"github.com/philpearl/plenc/plenccore"
+)
+
+// DefaultMaxMessageSize is the default limit on the size of a message read by a
+// Decoder.
+const DefaultMaxMessageSize = 64 << 20
+
+// Encoder writes a stream of plenc messages to an io.Writer. Each message is
+// preceded by its length as an unsigned varint. This is the same as the
+// "delimited" convention used with protobuf, so streams can be read by
+// protobuf's delimited readers.
+type Encoder struct {
+	p   *Plenc
+	w   io.Writer
+	buf []byte
+}
+
+// NewEncoder returns an Encoder that writes to w using the default Plenc
+// instance.
+func NewEncoder(w io.Writer) *Encoder {
+	return defaultPlenc.NewEncoder(w)
+}
+
+// NewEncoder returns an Encoder that writes to w using p.
+func (p *Plenc) NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{p: p, w: w}
+}
+
+// Encode writes value to the stream as a single length-prefixed message. Each
+// message is written with a single call to Write on the underlying writer.
+func (e *Encoder) Encode(value any) (err error) {
+	defer recoverEncodeError(&err)
+	ptr, c, err := e.p.preamble(value)
+	if err != nil {
+		return err
+	}
+
+	e.buf = e.buf[:0]
+	if ptr == nil || c.Omit(ptr) {
+		e.buf = plenccore.AppendVarUint(e.buf, 0)
+	} else {
+		e.buf = plenccore.AppendVarUint(e.buf, uint64(c.Size(ptr, nil)))
+		e.buf = c.Append(e.buf, ptr, nil)
+	}
+
+	_, err = e.w.Write(e.buf)
+	return err
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// Decoder reads a stream of length-prefixed plenc messages, as written by an
+// Encoder, from an io.Reader. The Decoder re-uses a single buffer for reading
+// messages unless the Plenc instance has ZeroCopy set.
+type Decoder struct {
+	// MaxMessageSize limits the size of the messages the Decoder will read.
+	// Decode returns an error if it finds a larger message. NewDecoder sets
+	// this to DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	p   *Plenc
+	r   byteReader
+	buf []byte
+}
+
+// NewDecoder returns a Decoder that reads from r using the default Plenc
+// instance. If r does not implement io.ByteReader it is wrapped in a
+// bufio.Reader, so the Decoder may read beyond the last message it returns.
+func NewDecoder(r io.Reader) *Decoder {
+	return defaultPlenc.NewDecoder(r)
+}
+
+// NewDecoder returns a Decoder that reads from r using p. See NewDecoder.
+func (p *Plenc) NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{MaxMessageSize: DefaultMaxMessageSize, p: p, r: br}
+}
+
+// Decode reads the next message from the stream into value, which must be a
+// non-nil pointer. It returns io.EOF if the stream ends cleanly before the
+// start of a message, and io.ErrUnexpectedEOF if it ends part way through one.
+// As with Unmarshal, fields of value that are not present in the message are
+// left unchanged.
+func (d *Decoder) Decode(value any) error {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("you must pass in a non-nil pointer")
+	}
+
+	c, err := d.p.CodecForType(rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	l, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		return fmt.Errorf("failed to read message length. %w", err)
+	}
+	if l > uint64(d.MaxMessageSize) {
+		return fmt.Errorf("message length %d exceeds maximum message size %d", l, d.MaxMessageSize)
+	}
+
+	// With ZeroCopy the decoded value refers to the buffer, so we can't re-use
+	// it for the next message.
+	if d.p.ZeroCopy || uint64(cap(d.buf)) < l {
+		d.buf = make([]byte, l)
+	}
+	d.buf = d.buf[:l]
+	if _, err := io.ReadFull(d.r, d.buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			// We've read the length, so the message is incomplete
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	_, err = c.Read(d.buf, unsafe.Pointer(rv.Pointer()), c.WireType())
+	return err
+}
@@ -0,0 +1,95 @@
+package plenc_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/philpearl/plenc"
+)
+
+type record struct {
+	ID   int      `plenc:"1"`
+	Name string   `plenc:"2"`
+	Tags []string `plenc:"3"`
+}
+
+func TestStream(t *testing.T) {
+	in := []record{
+		{ID: 1, Name: "one", Tags: []string{"a", "b"}},
+		{},
+		{ID: 3, Name: string(bytes.Repeat([]byte("x"), 1000))},
+		{ID: -4},
+	}
+
+	var buf bytes.Buffer
+	enc := plenc.NewEncoder(&buf)
+	for i := range in {
+		if err := enc.Encode(&in[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readers := map[string]func() io.Reader{
+		"bytes":   func() io.Reader { return bytes.NewReader(buf.Bytes()) },
+		"onebyte": func() io.Reader { return iotest.OneByteReader(bytes.NewReader(buf.Bytes())) },
+	}
+
+	for name, r := range readers {
+		t.Run(name, func(t *testing.T) {
+			dec := plenc.NewDecoder(r())
+			var out []record
+			for {
+				var r record
+				if err := dec.Decode(&r); err != nil {
+					if err == io.EOF {
+						break
+					}
+					t.Fatal(err)
+				}
+				out = append(out, r)
+			}
+
+			if diff := cmp.Diff(in, out); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestStreamTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := plenc.NewEncoder(&buf).Encode(&record{ID: 1, Name: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	for i := 1; i < len(data); i++ {
+		var r record
+		err := plenc.NewDecoder(bytes.NewReader(data[:i])).Decode(&r)
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected unexpected EOF with %d bytes, got %v", i, err)
+		}
+	}
+}
+
+func TestStreamMaxMessageSize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := plenc.NewEncoder(&buf).Encode(&record{Name: "this is too long"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := plenc.NewDecoder(&buf)
+	dec.MaxMessageSize = 10
+	var r record
+	err := dec.Decode(&r)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if exp := "message length 18 exceeds maximum message size 10"; err.Error() != exp {
+		t.Fatalf("error %q not as expected", err)
+	}
+}